@@ -0,0 +1,135 @@
+package avro
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/leboncoin/avrocado/internal/schema"
+)
+
+// The struct fields are decoded from the record fields named after one of their aliases, given by the alias tag
+// option (ex: `avro:"full_name,alias=name,alias=fullname"`) to read the data written before a rename, and from the
+// record fields declaring their name as alias in the schema. A record field matching the name of a struct field
+// is never taken by an alias.
+
+// tagAliases returns the names given by the alias options of a struct field tag
+func tagAliases(options []string) []string {
+	var aliases []string
+	for _, option := range options {
+		if strings.HasPrefix(option, "alias=") {
+			aliases = append(aliases, strings.TrimPrefix(option, "alias="))
+		}
+	}
+	return aliases
+}
+
+// aliasedField finds the record field decoded into a struct field through an alias
+func aliasedField(s *schema.Schema, fields *structFields, field structField) *schema.Field {
+	for _, f := range s.Fields {
+		if _, taken := fields.lookup(f.Name); taken {
+			continue
+		}
+		if f.HasName(field.name) {
+			return f
+		}
+		for _, alias := range field.aliases {
+			if f.HasName(alias) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// renameAliases renames the fields of a datum decoded with the schema s to the names of the struct fields of the
+// output type reading them through an alias, for mapstructure to find them
+func renameAliases(native interface{}, s *schema.Schema, to reflect.Type) {
+	s, native = unwrapUnion(s, native)
+	to = indirectType(to)
+	if to == nil || native == nil {
+		return
+	}
+	switch {
+	case s.IsRecord() && to.Kind() == reflect.Struct:
+		record, ok := native.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := fieldsOf(to)
+		for _, field := range fields.fields {
+			f := lookupSchemaField(s, field.name)
+			if f == nil {
+				if f = aliasedField(s, fields, field); f == nil {
+					continue
+				}
+				if value, ok := record[f.Name]; ok {
+					delete(record, f.Name)
+					record[field.name] = value
+				}
+				renameAliases(record[field.name], f.Type, field.field.Type)
+				continue
+			}
+			renameAliases(record[f.Name], f.Type, field.field.Type)
+		}
+	case s.Type == schema.Array && (to.Kind() == reflect.Slice || to.Kind() == reflect.Array):
+		items, _ := native.([]interface{})
+		for _, item := range items {
+			renameAliases(item, s.Items, to.Elem())
+		}
+	case s.Type == schema.Map && to.Kind() == reflect.Map:
+		values, _ := native.(map[string]interface{})
+		for _, value := range values {
+			renameAliases(value, s.Values, to.Elem())
+		}
+	}
+}
+
+// readerNames renames the fields and the union branches of a datum decoded with a writer schema to the names
+// they have in the reader schema, the reader declaring the writer names as aliases, so that the datum
+// can be encoded with the reader schema
+func readerNames(native interface{}, reader *schema.Schema) interface{} {
+	switch reader.Type {
+	case schema.Union:
+		union, ok := native.(map[string]interface{})
+		if !ok || len(union) != 1 {
+			return native
+		}
+		for name, value := range union {
+			for _, branch := range reader.Branches {
+				if branch.HasName(name) {
+					return map[string]interface{}{branch.BranchName(): readerNames(value, branch)}
+				}
+			}
+		}
+	case schema.Record, schema.Error:
+		record, ok := native.(map[string]interface{})
+		if !ok {
+			return native
+		}
+		for _, f := range reader.Fields {
+			if _, ok := record[f.Name]; !ok {
+				for _, alias := range f.Aliases {
+					if value, ok := record[alias]; ok {
+						delete(record, alias)
+						record[f.Name] = value
+						break
+					}
+				}
+			}
+			if value, ok := record[f.Name]; ok {
+				record[f.Name] = readerNames(value, f.Type)
+			}
+		}
+	case schema.Array:
+		items, _ := native.([]interface{})
+		for i, item := range items {
+			items[i] = readerNames(item, reader.Items)
+		}
+	case schema.Map:
+		values, _ := native.(map[string]interface{})
+		for key, value := range values {
+			values[key] = readerNames(value, reader.Values)
+		}
+	}
+	return native
+}
@@ -0,0 +1,121 @@
+package avro
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userV1Schema = `{"type": "record", "name": "User", "namespace": "test", "fields": [
+	{"name": "name", "type": "string"},
+	{"name": "friends", "type": {"type": "array", "items": "User"}},
+	{"name": "manager", "type": ["null", "User"], "default": null}
+]}`
+
+const userV2Schema = `{"type": "record", "name": "User", "namespace": "test", "fields": [
+	{"name": "full_name", "type": "string", "aliases": ["name"]},
+	{"name": "friends", "type": {"type": "array", "items": "User"}},
+	{"name": "manager", "type": ["null", "User"], "default": null}
+]}`
+
+// renamedUser reads the data written before the rename of its name field
+type renamedUser struct {
+	FullName string        `avro:"full_name,alias=name,alias=fullname"`
+	Friends  []renamedUser `avro:"friends"`
+	Manager  *renamedUser  `avro:"manager"`
+}
+
+func (renamedUser) AvroName() string { return "test.User" }
+
+// legacyUser keeps the name of the field before its rename
+type legacyUser struct {
+	Name    string       `avro:"name"`
+	Friends []legacyUser `avro:"friends"`
+}
+
+func (legacyUser) AvroName() string { return "test.User" }
+
+func TestCodec_tag_aliases(t *testing.T) {
+	codec, err := NewCodec(userV1Schema)
+	require.NoError(t, err)
+	buf, err := codec.Marshal(map[string]interface{}{
+		"name":    "Ada",
+		"friends": []interface{}{map[string]interface{}{"name": "Bob", "friends": []interface{}{}}},
+		"manager": map[string]interface{}{"test.User": map[string]interface{}{"name": "Eve", "friends": []interface{}{}}},
+	})
+	require.NoError(t, err)
+
+	var decoded renamedUser
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	assert.Equal(t, "Ada", decoded.FullName)
+	require.Len(t, decoded.Friends, 1)
+	assert.Equal(t, "Bob", decoded.Friends[0].FullName)
+	require.NotNil(t, decoded.Manager)
+	assert.Equal(t, "Eve", decoded.Manager.FullName)
+
+	// a field matching a struct field by its name is not taken by an alias
+	var both struct {
+		Name     string `avro:"name"`
+		FullName string `avro:"full_name,alias=name"`
+	}
+	require.NoError(t, codec.Unmarshal(buf, &both))
+	assert.Equal(t, "Ada", both.Name)
+	assert.Empty(t, both.FullName)
+}
+
+func TestCodec_schema_aliases(t *testing.T) {
+	codec, err := NewCodec(userV2Schema)
+	require.NoError(t, err)
+	buf, err := codec.Marshal(renamedUser{FullName: "Ada", Friends: []renamedUser{{FullName: "Bob"}}})
+	require.NoError(t, err)
+
+	var decoded legacyUser
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	assert.Equal(t, legacyUser{Name: "Ada", Friends: []legacyUser{{Name: "Bob"}}}, decoded)
+
+	metadata, err := codec.UnmarshalMetadata(buf, &legacyUser{})
+	require.NoError(t, err)
+	assert.Empty(t, metadata.Unset)
+}
+
+func TestCodecRegistry_Unmarshal_aliases(t *testing.T) {
+	codecV1 := NewMockCodecRegistry("test-alias")
+	require.NoError(t, codecV1.initAndRegister(userV1Schema))
+	codecV2 := NewMockCodecRegistry("test-alias")
+	codecV2.Registry = codecV1.Registry
+	require.NoError(t, codecV2.initAndRegister(userV2Schema))
+
+	buf, err := codecV1.Marshal(legacyUser{Name: "Ada", Friends: []legacyUser{{Name: "Bob"}}})
+	require.NoError(t, err)
+
+	data := make(map[string]interface{})
+	require.NoError(t, codecV2.Unmarshal(buf, &data))
+	assert.Equal(t, "Ada", data["full_name"])
+	friends, _ := data["friends"].([]interface{})
+	require.Len(t, friends, 1)
+	assert.Equal(t, "Bob", friends[0].(map[string]interface{})["full_name"])
+}
+
+func TestCodecRegistry_readerID_aliases(t *testing.T) {
+	reader := func(namespace string) *Codec {
+		codec, err := NewCodec(`{"type": "record", "name": "Member", "namespace": "` + namespace + `", "aliases": ["old.User"],
+			"fields": [{"name": "name", "type": "string"}]}`)
+		require.NoError(t, err)
+		return codec
+	}
+	writer, err := NewCodec(`{"type": "record", "name": "User", "namespace": "old", "fields": [
+		{"name": "name", "type": "string"}
+	]}`)
+	require.NoError(t, err)
+
+	registry := &CodecRegistry{codecByID: make(map[SchemaID]*Codec)}
+	registry.addEncodeCodec(3, reader("a"), false)
+	registry.addEncodeCodec(2, reader("z"), false)
+	registry.addEncodeCodec(4, reader("m"), false)
+
+	// several reader schemas know the writer record under an alias, the lowest ID is always used
+	for i := 0; i < 20; i++ {
+		require.Equal(t, SchemaID(2), registry.readerID(1, writer))
+	}
+}
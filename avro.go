@@ -4,11 +4,14 @@ package avro
 
 import (
 	"encoding/json"
+	"fmt"
+	"math/big"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/fatih/camelcase"
-	"github.com/leboncoin/structs"
+	"github.com/leboncoin/avrocado/internal/schema"
 	"github.com/linkedin/goavro/v2"
 	"github.com/mitchellh/mapstructure"
 )
@@ -96,8 +99,10 @@ type CustomUnmarshaler interface {
 //
 // The Marshaler will understand structure field annotations like
 // * "-" to completely omit the field
-// * "omitempty" which will not use the field value if it is a zero value and replace it by its default value
-//	 if there is one. WARNING: if no default value are provided, the Marshaler will return an error
+// * "omitempty" which will not use the field value if it is a zero value and replace it by the default value
+//	 of the schema field, at every level of the datum. WARNING: if the schema field has no default value,
+//	 the Marshaler will return an error wrapping ErrNoDefault
+// * "default=value" which will replace the zero value of a boolean, number or string field by the given value
 //
 // Marshaler will also handle pointer on values as the default optional value pattern in avro
 // (union with null type and null as default value).
@@ -115,11 +120,25 @@ type Codec struct {
 	goavro.Codec
 	// Namespace is the namespace which will be used to encode nested type
 	Namespace string
-	// TypeNameEncoder will be applied on all type during encoding to transform them from Go name to avro naming convention
+	// TypeNameEncoder will be applied on all type during encoding to transform them from Go name to avro naming convention.
+	// Once the codec has encoded values, it is changed by SetTypeNameEncoder.
 	TypeNameEncoder TypeNameEncoder
+	// DecodeOptions tunes Unmarshal
+	DecodeOptions DecodeOptions
+
+	// parsed is the schema tree, nil when it can't be walked
+	parsed *schema.Schema
+	// parseErr tells why the schema can't be walked
+	parseErr error
+	// plans are the encoders and decoders compiled for the marshaled and unmarshaled types
+	plans *typePlans
 }
 
-// NewCodec creates a codec from a schema
+// NewCodec creates a codec from a schema.
+// The schemas accepted by goavro which avrocado can't walk (as a record nested in a record of the same
+// full name) are encoded and decoded through the goavro maps only: the compiled plans, the schema aliases,
+// the schema defaults of the omitempty fields and the locating of the errors in FieldError are turned off,
+// and CheckType returns the parse error.
 func NewCodec(schemaSpecification string) (*Codec, error) {
 	o, err := goavro.NewCodec(schemaSpecification)
 	if err != nil {
@@ -133,36 +152,101 @@ func NewCodec(schemaSpecification string) (*Codec, error) {
 	} else {
 		namespace = namespaceStruct.Namespace
 	}
-	return &Codec{*o, namespace, DefaultTypeNameEncoder}, nil
+	parsed, parseErr := schema.Parse(schemaSpecification)
+	return &Codec{
+		Codec:           *o,
+		Namespace:       namespace,
+		TypeNameEncoder: DefaultTypeNameEncoder,
+		parsed:          parsed,
+		parseErr:        parseErr,
+		plans:           &typePlans{},
+	}, nil
 }
 
-// Marshal marshals any go type to avro
+// fullName returns the full name of the schema if it is a named type
+func (c *Codec) fullName() string {
+	if c.parsed == nil || !c.parsed.IsNamed() {
+		return ""
+	}
+	return c.parsed.FullName()
+}
+
+// Marshal marshals any go type to avro.
+// The structs are encoded by a plan compiled and cached for their type, the other values and the
+// constructs the plans don't handle going through goavro native maps.
 func (c *Codec) Marshal(st interface{}) ([]byte, error) {
-	return c.marshal(&c.Codec, st)
+	return c.AppendMarshal(nil, st)
+}
+
+// AppendMarshal appends the avro encoding of any go type to dst and returns the extended buffer,
+// allowing the buffers to be reused.
+func (c *Codec) AppendMarshal(dst []byte, st interface{}) ([]byte, error) {
+	if buf, ok := c.fastMarshal(dst, st); ok {
+		return buf, nil
+	}
+	return c.marshal(&c.Codec, dst, st)
 }
 
-// Unmarshal unmarshals any go type from avro
+// Unmarshal unmarshals any go type from avro.
+// The structs are decoded by a plan compiled and cached for their type, like Marshal.
+// On error, the output may have been partially set.
 func (c *Codec) Unmarshal(avro []byte, output interface{}) error {
-	return c.unmarshal(&c.Codec, avro, output)
+	rest, err := c.UnmarshalNext(avro, output)
+	if err != nil {
+		return err
+	}
+	return c.DecodeOptions.checkRest(rest)
+}
+
+// UnmarshalNext unmarshals the datum at the beginning of the buffer and returns the bytes following it,
+// allowing to decode back-to-back datums from one buffer.
+func (c *Codec) UnmarshalNext(avro []byte, output interface{}) ([]byte, error) {
+	return c.unmarshalNext(avro, output, nil)
+}
+
+// UnmarshalMetadata unmarshals like Unmarshal, and reports the fields of the datum left unused
+// and the struct fields left unset.
+func (c *Codec) UnmarshalMetadata(avro []byte, output interface{}) (DecodeMetadata, error) {
+	var metadata DecodeMetadata
+	rest, err := c.unmarshalNext(avro, output, &metadata)
+	if err != nil {
+		return metadata, err
+	}
+	return metadata, c.DecodeOptions.checkRest(rest)
+}
+
+func (c *Codec) unmarshalNext(avro []byte, output interface{}, metadata *DecodeMetadata) ([]byte, error) {
+	if metadata == nil && c.DecodeOptions.compiled() {
+		if rest, ok := c.fastUnmarshal(avro, output); ok {
+			return rest, nil
+		}
+	}
+	return c.unmarshal(&c.Codec, avro, output, metadata)
 }
 
 func (c *Codec) addNamespace(typeName string) string {
 	return AddNamespace(c.Namespace, typeName)
 }
 
+// SetTypeNameEncoder changes the TypeNameEncoder of the codec, the plans compiled with the previous one are dropped
+func (c *Codec) SetTypeNameEncoder(typeNameEncoder TypeNameEncoder) {
+	c.TypeNameEncoder = typeNameEncoder
+	c.plans = &typePlans{}
+}
+
 func (c *Codec) encodeTypeName(name string) string {
 	return c.TypeNameEncoder(name)
 }
 
 func (c *Codec) encodeUnionHook(kind reflect.Kind, data interface{}) (interface{}, error) {
+	if isLogicalValue(reflect.TypeOf(data)) {
+		return data, nil
+	}
 	value := reflect.ValueOf(data)
 
 	switch kind {
 	case reflect.Struct:
-		s := structs.New(data)
-		s.TagName = "avro"
-		s.EncodeHook = c.encodeUnionHook
-		data = s.Map()
+		data = c.structMap(value)
 
 	case reflect.Slice:
 		elemType := getBaseType(reflect.TypeOf(data).Elem())
@@ -190,7 +274,8 @@ func (c *Codec) encodeUnionHook(kind reflect.Kind, data interface{}) (interface{
 				}
 
 				typeName := c.getTypeName(pointed)
-				if !isAvroBaseType(typeName) {
+				// a name holding dots is already a full name
+				if !isAvroBaseType(typeName) && !strings.Contains(typeName, ".") {
 					typeName = c.addNamespace(typeName)
 				}
 
@@ -211,6 +296,19 @@ func (c *Codec) encodeUnionHook(kind reflect.Kind, data interface{}) (interface{
 	return data, nil
 }
 
+// logicalTypes are the Go types of the values of the avro logical types, given as is to goavro
+var logicalTypes = map[reflect.Type]bool{
+	reflect.TypeOf(time.Time{}):      true,
+	reflect.TypeOf(time.Duration(0)): true,
+	reflect.TypeOf((*big.Rat)(nil)):  true,
+}
+
+// isLogicalValue tells if the values of a type are the representation of an avro logical type by goavro:
+// time.Time for timestamps and dates, time.Duration for times and *big.Rat for decimals
+func isLogicalValue(t reflect.Type) bool {
+	return logicalTypes[t]
+}
+
 func isAvroBaseType(avroType string) bool {
 	for _, t := range avroBaseTypes {
 		if t == avroType {
@@ -276,6 +374,11 @@ func toStructPtr(obj interface{}) interface{} {
 }
 
 func (c *Codec) getTypeName(val reflect.Value) string {
+	return typeName(val, c.encodeTypeName)
+}
+
+// typeName returns the avro name of a value, given by TypeNamer or by encoding its Go type name
+func typeName(val reflect.Value, encodeTypeName TypeNameEncoder) string {
 	data := val.Interface()
 	// Check if the value implement the interface, with a value as receiver
 	if avroNamer, ok := data.(TypeNamer); ok {
@@ -289,7 +392,7 @@ func (c *Codec) getTypeName(val reflect.Value) string {
 	}
 
 	// otherwise return the type name
-	return c.encodeTypeName(val.Type().Name())
+	return encodeTypeName(val.Type().Name())
 }
 
 func (c Codec) decodeUnionHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
@@ -314,11 +417,29 @@ func (c Codec) decodeUnionHook(from reflect.Type, to reflect.Type, data interfac
 		}
 		return unmarshaler, nil
 	}
+	if record, ok := data.(map[string]interface{}); ok && to.Kind() == reflect.Struct {
+		if fieldsOf(to).hidden {
+			return c.decodeHiddenFields(record, to)
+		}
+		return nestInlinedFields(record, to), nil
+	}
 	// Not union or unexpected type, return data unaltered.
 	return data, nil
 }
 
-func (c *Codec) marshal(codec *goavro.Codec, data interface{}) ([]byte, error) {
+// decoderConfig configures mapstructure to decode the native values of goavro into output
+func (c Codec) decoderConfig(output interface{}) *mapstructure.DecoderConfig {
+	return &mapstructure.DecoderConfig{
+		TagName:          "avro",
+		DecodeHook:       c.decodeUnionHook,
+		Result:           output,
+		ErrorUnused:      c.DecodeOptions.ErrorUnused,
+		WeaklyTypedInput: c.DecodeOptions.WeaklyTypedInput,
+		ZeroFields:       c.DecodeOptions.ZeroFields,
+	}
+}
+
+func (c *Codec) marshal(codec *goavro.Codec, dst []byte, data interface{}) ([]byte, error) {
 	var (
 		value = reflect.ValueOf(data)
 		kind  = value.Kind()
@@ -330,28 +451,54 @@ func (c *Codec) marshal(codec *goavro.Codec, data interface{}) ([]byte, error) {
 		kind = value.Kind()
 		data = value.Interface()
 	}
+	if err := structFieldsError(reflect.TypeOf(data)); err != nil {
+		return nil, err
+	}
 
 	nativeData, err := c.encodeUnionHook(kind, data)
 	if err != nil {
 		return nil, err
 	}
 
-	return codec.BinaryFromNative(nil, nativeData)
+	buf, err := codec.BinaryFromNative(dst, nativeData)
+	if err != nil {
+		return nil, c.encodeError(err, data, nativeData)
+	}
+	return buf, nil
 }
 
-func (c *Codec) unmarshal(codec *goavro.Codec, avro []byte, output interface{}) (err error) {
-	m, _, err := codec.NativeFromBinary(avro)
+func (c *Codec) unmarshal(codec *goavro.Codec, avro []byte, output interface{}, metadata *DecodeMetadata) ([]byte, error) {
+	if err := structFieldsError(outputType(output)); err != nil {
+		return nil, err
+	}
+	m, rest, err := codec.NativeFromBinary(avro)
 	if err != nil {
-		return err
+		return nil, c.decodeError(err, avro, output)
+	}
+	if c.parsed != nil {
+		renameAliases(m, c.parsed, outputType(output))
 	}
-	config := mapstructure.DecoderConfig{
-		TagName:    "avro",
-		DecodeHook: c.decodeUnionHook,
-		Result:     output,
+	config := c.decoderConfig(output)
+	var decoded mapstructure.Metadata
+	if metadata != nil {
+		config.Metadata = &decoded
 	}
-	decoder, err := mapstructure.NewDecoder(&config)
+	decoder, err := mapstructure.NewDecoder(config)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := decoder.Decode(m); err != nil {
+		return rest, c.convertError(err, m, output)
+	}
+	if metadata == nil && !c.DecodeOptions.ErrorUnset {
+		return rest, nil
+	}
+	unset := outputUnsetFields(m, output)
+	if metadata != nil {
+		*metadata = newDecodeMetadata(decoded, unset)
+	}
+	if c.DecodeOptions.ErrorUnset && len(unset) > 0 {
+		return rest, fmt.Errorf("%s: %w", strings.Join(unset, ", "), ErrUnsetFields)
 	}
-	return decoder.Decode(m)
+	return rest, nil
 }
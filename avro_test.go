@@ -1,8 +1,11 @@
 package avro
 
 import (
+	"errors"
+	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/linkedin/goavro/v2"
 	"github.com/stretchr/testify/assert"
@@ -73,6 +76,52 @@ func TestAvroCodec(t *testing.T) {
 	assert.Equal(t, int32(36), decodedMap["age"])
 }
 
+func TestCodec_AppendMarshal(t *testing.T) {
+	codec, err := NewCodec(personSchema)
+	require.NoError(t, err)
+
+	expected, err := codec.Marshal(Person{"Nico", 36})
+	require.NoError(t, err)
+
+	buf := make([]byte, 0, 64)
+	buf, err = codec.AppendMarshal(append(buf, "prefix"...), Person{"Nico", 36})
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte("prefix"), expected...), buf)
+
+	// the values going through goavro maps are appended too
+	buf, err = codec.AppendMarshal(buf[:0], map[string]interface{}{"name": "Nico", "age": 36})
+	require.NoError(t, err)
+	assert.Equal(t, expected, buf)
+}
+
+func TestCodec_UnmarshalNext(t *testing.T) {
+	codec, err := NewCodec(personSchema)
+	require.NoError(t, err)
+
+	buf, err := codec.Marshal(Person{"Nico", 36})
+	require.NoError(t, err)
+	buf, err = codec.AppendMarshal(buf, map[string]interface{}{"name": "Rob", "age": 42})
+	require.NoError(t, err)
+
+	var first Person
+	next, err := codec.UnmarshalNext(buf, &first)
+	require.NoError(t, err)
+	assert.Equal(t, Person{"Nico", 36}, first)
+	second := make(map[string]interface{})
+	rest, err := codec.UnmarshalNext(next, &second)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Rob", "age": int32(42)}, second)
+	assert.Empty(t, rest)
+
+	// the trailing bytes are ignored unless the strict mode is enabled
+	var decoded Person
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	codec.DecodeOptions = DecodeOptions{Strict: true}
+	err = codec.Unmarshal(buf, &decoded)
+	assert.True(t, errors.Is(err, ErrTrailingBytes))
+	require.NoError(t, codec.Unmarshal(buf[:len(buf)-len(next)], &decoded))
+}
+
 type MyStruct struct {
 	MyNull   interface{}
 	MyBool   bool
@@ -1273,3 +1322,68 @@ func Test_convertToBaseType(t *testing.T) {
 		})
 	}
 }
+
+type NamespacedURLs struct {
+	URL string `avro:"url"`
+}
+
+func (NamespacedURLs) AvroName() string {
+	return "com.example.urls"
+}
+
+func TestCodec_Marshal_with_full_custom_name(t *testing.T) {
+	schema := `{
+      "type": "record",
+      "name": "data",
+      "namespace": "com.example",
+      "fields": [
+        {
+          "name": "urls",
+          "type": ["null", {"type": "record", "name": "urls", "fields": [{"name": "url", "type": "string"}]}]
+        }
+      ]
+    }`
+	type data struct {
+		URLs *NamespacedURLs `avro:"urls"`
+	}
+
+	codec, err := NewCodec(schema)
+	require.NoError(t, err)
+
+	expected := data{&NamespacedURLs{"test"}}
+	avro, err := codec.Marshal(expected)
+	require.NoError(t, err, "a full name is not prefixed by the namespace")
+
+	var decoded data
+	require.NoError(t, codec.Unmarshal(avro, &decoded))
+	require.Equal(t, expected, decoded)
+}
+
+type logicalValues struct {
+	At       time.Time     `avro:"at"`
+	Day      time.Time     `avro:"day"`
+	Duration time.Duration `avro:"duration"`
+	Price    *big.Rat      `avro:"price"`
+}
+
+func TestCodec_logical_types(t *testing.T) {
+	codec, err := NewCodec(`{"type": "record", "name": "logical_values", "fields": [
+		{"name": "at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "day", "type": {"type": "int", "logicalType": "date"}},
+		{"name": "duration", "type": {"type": "int", "logicalType": "time-millis"}},
+		{"name": "price", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}}
+	]}`)
+	require.NoError(t, err)
+
+	value := logicalValues{
+		At:       time.Date(2020, 3, 14, 15, 9, 26, 535000000, time.UTC),
+		Day:      time.Date(2020, 3, 14, 0, 0, 0, 0, time.UTC),
+		Duration: 90 * time.Second,
+		Price:    big.NewRat(314, 100),
+	}
+	buf, err := codec.Marshal(value)
+	require.NoError(t, err)
+	var decoded logicalValues
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	assert.Equal(t, value, decoded)
+}
@@ -0,0 +1,89 @@
+// Package avroconfluent adapts the avro codecs of kafka topics to the serdes of the confluent-kafka-go client
+// (github.com/confluentinc/confluent-kafka-go/v2/schemaregistry/serde).
+//
+// The package doesn't import confluent-kafka-go, keeping it (and librdkafka) out of the dependencies of
+// avrocado: Serializer and Deserializer provide the Serialize, Deserialize, DeserializeInto and Close methods
+// of serde.Serializer and serde.Deserializer, the schema registry being configured on the avrocado side.
+// They lack the ConfigureSerializer and ConfigureDeserializer methods, whose parameters are confluent-kafka-go
+// types: they are not assignable to serde.Serializer and serde.Deserializer, and are called directly.
+//
+//	serde, err := avro.NewTopicSerde(registryURL, "people", keySchema, valueSchema)
+//	...
+//	serializer := avroconfluent.NewSerializer(serde, false)
+//	value, err := serializer.Serialize("people", person)
+//	...
+//	err = producer.Produce(&kafka.Message{
+//		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+//		Value:          value,
+//	}, nil)
+package avroconfluent
+
+import (
+	avro "github.com/leboncoin/avrocado"
+)
+
+// Serializer encodes the keys or the values of kafka topics
+type Serializer struct {
+	codecs avro.TopicCodecs
+	isKey  bool
+}
+
+// NewSerializer returns a Serializer encoding the keys of the topics if isKey is set, their values otherwise
+func NewSerializer(codecs avro.TopicCodecs, isKey bool) *Serializer {
+	return &Serializer{codecs: codecs, isKey: isKey}
+}
+
+// Serialize encodes a key or a value of the topic
+func (s *Serializer) Serialize(topic string, msg interface{}) ([]byte, error) {
+	codec, err := s.codecs.TopicCodec(topic, s.isKey)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(msg)
+}
+
+// Close does nothing, the codecs being owned by the caller
+func (s *Serializer) Close() error {
+	return nil
+}
+
+// Deserializer decodes the keys or the values of kafka topics
+type Deserializer struct {
+	codecs avro.TopicCodecs
+	isKey  bool
+}
+
+// NewDeserializer returns a Deserializer decoding the keys of the topics if isKey is set, their values otherwise
+func NewDeserializer(codecs avro.TopicCodecs, isKey bool) *Deserializer {
+	return &Deserializer{codecs: codecs, isKey: isKey}
+}
+
+// Deserialize decodes a key or a value of the topic into the native representation of goavro
+// (map[string]interface{} for the records). A nil payload, ex: a tombstone, gives nil.
+func (d *Deserializer) Deserialize(topic string, payload []byte) (interface{}, error) {
+	if payload == nil {
+		return nil, nil
+	}
+	var msg interface{}
+	if err := d.DeserializeInto(topic, payload, &msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// DeserializeInto decodes a key or a value of the topic into msg. A nil payload leaves msg untouched.
+func (d *Deserializer) DeserializeInto(topic string, payload []byte, msg interface{}) error {
+	if payload == nil {
+		return nil
+	}
+	codec, err := d.codecs.TopicCodec(topic, d.isKey)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(payload, msg)
+}
+
+// Close does nothing, the codecs being owned by the caller
+func (d *Deserializer) Close() error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package avroconfluent
+
+import (
+	"testing"
+
+	avro "github.com/leboncoin/avrocado"
+	"github.com/leboncoin/avrocado/avrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	keySchema   = `{"type": "record", "name": "person_key", "fields": [{"name": "name", "type": "string"}]}`
+	valueSchema = `{"type": "record", "name": "person", "fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int"}
+	]}`
+)
+
+type personKey struct {
+	Name string `avro:"name"`
+}
+
+type person struct {
+	Name string `avro:"name"`
+	Age  int32  `avro:"age"`
+}
+
+// serializer and deserializer are the methods of serde.Serializer and serde.Deserializer provided by the package
+type serializer interface {
+	Serialize(topic string, msg interface{}) ([]byte, error)
+	Close() error
+}
+
+type deserializer interface {
+	Deserialize(topic string, payload []byte) (interface{}, error)
+	DeserializeInto(topic string, payload []byte, msg interface{}) error
+	Close() error
+}
+
+func TestSerializer_Deserializer(t *testing.T) {
+	server := avrotest.NewServer()
+	defer server.Close()
+	serde, err := avro.NewTopicSerdeAndRegister(server.URL, "people", keySchema, valueSchema)
+	require.NoError(t, err)
+
+	var keySerializer, valueSerializer serializer = NewSerializer(serde, true), NewSerializer(serde, false)
+	var keyDeserializer, valueDeserializer deserializer = NewDeserializer(serde, true), NewDeserializer(serde, false)
+	defer keySerializer.Close()
+	defer valueSerializer.Close()
+	defer keyDeserializer.Close()
+	defer valueDeserializer.Close()
+
+	key, err := keySerializer.Serialize("people", personKey{"Nico"})
+	require.NoError(t, err)
+	value, err := valueSerializer.Serialize("people", person{"Nico", 36})
+	require.NoError(t, err)
+
+	var decodedKey personKey
+	require.NoError(t, keyDeserializer.DeserializeInto("people", key, &decodedKey))
+	assert.Equal(t, personKey{"Nico"}, decodedKey)
+	var decodedValue person
+	require.NoError(t, valueDeserializer.DeserializeInto("people", value, &decodedValue))
+	assert.Equal(t, person{"Nico", 36}, decodedValue)
+
+	native, err := valueDeserializer.Deserialize("people", value)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Nico", "age": int32(36)}, native)
+
+	// the tombstones
+	native, err = valueDeserializer.Deserialize("people", nil)
+	require.NoError(t, err)
+	assert.Nil(t, native)
+	require.NoError(t, valueDeserializer.DeserializeInto("people", nil, &decodedValue))
+	assert.Equal(t, person{"Nico", 36}, decodedValue)
+
+	_, err = valueSerializer.Serialize("other", person{"Nico", 36})
+	assert.Error(t, err)
+	_, err = valueDeserializer.Deserialize("other", value)
+	assert.Error(t, err)
+}
@@ -0,0 +1,385 @@
+// Package avrogen generates Go types from avro schemas, ready to be encoded and decoded by the avro package:
+//   - records become structs with avro tags, and named types implement avro.TypeNamer
+//   - unions of null and another type become pointers, other unions are left as interface{}
+//     holding the goavro representation of unions
+//   - enums become string types with a constant per symbol
+//   - the schemas are embedded in constants, and their records implement avro.Schemer
+//
+// The logical types converted by goavro are generated as the Go types it expects: time.Time for the
+// timestamp-millis, timestamp-micros and date types, time.Duration for time-millis and time-micros, and
+// *big.Rat for decimal. As goavro doesn't tell their union branch from their value, the unions of null
+// and a logical type are left as interface{}. The other logical types are generated as their underlying avro type.
+package avrogen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/leboncoin/avrocado/internal/schema"
+)
+
+// initialisms are written in upper case in the generated identifiers, as advised by golint
+var initialisms = map[string]bool{
+	"api": true, "html": true, "http": true, "https": true, "id": true, "ip": true, "json": true,
+	"sql": true, "uri": true, "url": true, "utf8": true, "uuid": true, "xml": true,
+}
+
+// topLevel is a schema added to the generator
+type topLevel struct {
+	raw    string
+	parsed *schema.Schema
+}
+
+// Generator accumulates schemas and generates the Go code of their types
+type Generator struct {
+	// Package is the name of the package of the generated code
+	Package string
+
+	schemas []topLevel
+	// types are the named types by full name, in order of declaration
+	types     map[string]*schema.Schema
+	typeOrder []string
+	// goNames are the Go names of the named types by full name, and the other way around
+	goNames  map[string]string
+	fullName map[string]string
+	// imports are the packages used by the generated code
+	imports map[string]bool
+}
+
+// NewGenerator returns a Generator of code for the given package
+func NewGenerator(pkg string) *Generator {
+	return &Generator{
+		Package:  pkg,
+		types:    make(map[string]*schema.Schema),
+		goNames:  make(map[string]string),
+		fullName: make(map[string]string),
+		imports:  make(map[string]bool),
+	}
+}
+
+// AddSchema adds a schema, which must be a named type, and all the named types it declares.
+// The types already declared by another schema must have the same definition.
+func (g *Generator) AddSchema(spec string) error {
+	parsed, err := schema.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("schema.Parse error: %w", err)
+	}
+	if !parsed.IsNamed() {
+		return fmt.Errorf("the schema must be a record, an enum or a fixed, not %s", parsed.Type)
+	}
+	for _, existing := range g.schemas {
+		if existing.parsed.FullName() == parsed.FullName() {
+			return fmt.Errorf("the schema %s is added twice", parsed.FullName())
+		}
+	}
+
+	var added, redeclared []*schema.Schema
+	for _, named := range namedTypes(parsed) {
+		if _, ok := g.types[named.FullName()]; ok {
+			redeclared = append(redeclared, named)
+			continue
+		}
+		g.types[named.FullName()] = named
+		g.typeOrder = append(g.typeOrder, named.FullName())
+		g.name(named)
+		added = append(added, named)
+	}
+	if err := g.check(added, redeclared); err != nil {
+		g.remove(added)
+		return err
+	}
+	g.schemas = append(g.schemas, topLevel{raw: strings.TrimSpace(spec), parsed: parsed})
+	return nil
+}
+
+// check validates the declarations of the added types and compares the redeclared ones with the existing ones
+func (g *Generator) check(added, redeclared []*schema.Schema) error {
+	for _, named := range added {
+		if _, err := g.declaration(named); err != nil {
+			return err
+		}
+	}
+	for _, named := range redeclared {
+		existing, err := g.declaration(g.types[named.FullName()])
+		if err != nil {
+			return err
+		}
+		declaration, err := g.declaration(named)
+		if err != nil {
+			return err
+		}
+		if existing != declaration {
+			return fmt.Errorf("the type %s has conflicting definitions", named.FullName())
+		}
+	}
+	return nil
+}
+
+// remove forgets the types added by a rejected schema
+func (g *Generator) remove(added []*schema.Schema) {
+	for _, named := range added {
+		delete(g.fullName, g.goNames[named.FullName()])
+		delete(g.goNames, named.FullName())
+		delete(g.types, named.FullName())
+	}
+	g.typeOrder = g.typeOrder[:len(g.typeOrder)-len(added)]
+}
+
+// Generate returns the formatted Go code of all the added schemas
+func (g *Generator) Generate() ([]byte, error) {
+	g.imports = make(map[string]bool)
+	var declarations bytes.Buffer
+	for _, fullName := range g.typeOrder {
+		named := g.types[fullName]
+		if goType, _ := logicalType(named); goType != "" {
+			continue
+		}
+		declaration, err := g.declaration(named)
+		if err != nil {
+			return nil, err
+		}
+		declarations.WriteString(declaration)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by avrogen. DO NOT EDIT.\n\npackage %s\n", g.Package)
+	if len(g.imports) > 0 {
+		imports := make([]string, 0, len(g.imports))
+		for pkg := range g.imports {
+			imports = append(imports, strconv.Quote(pkg))
+		}
+		sort.Strings(imports)
+		fmt.Fprintf(&buf, "\nimport (\n\t%s\n)\n", strings.Join(imports, "\n\t"))
+	}
+
+	for _, s := range g.schemas {
+		goName := g.goNames[s.parsed.FullName()]
+		fmt.Fprintf(&buf, "\n// %sSchema is the avro schema of %s\nconst %sSchema = %s\n", goName, goName, goName, quote(s.raw))
+		if s.parsed.IsRecord() {
+			fmt.Fprintf(&buf, "\n// AvroSchema implements avro.Schemer\nfunc (%s) AvroSchema() string {\n\treturn %sSchema\n}\n", goName, goName)
+		}
+	}
+	buf.Write(declarations.Bytes())
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format.Source error: %w", err)
+	}
+	return code, nil
+}
+
+// name assigns a Go name to a named type, its full name being used if its short name is taken
+func (g *Generator) name(named *schema.Schema) {
+	goName := GoName(named.Name)
+	if _, taken := g.fullName[goName]; taken {
+		goName = GoName(strings.Replace(named.FullName(), ".", "_", -1))
+	}
+	g.goNames[named.FullName()] = goName
+	g.fullName[goName] = named.FullName()
+}
+
+// declaration returns the Go code declaring a named type
+func (g *Generator) declaration(named *schema.Schema) (string, error) {
+	var buf bytes.Buffer
+	goName := g.goNames[named.FullName()]
+	buf.WriteString("\n")
+	writeDoc(&buf, "", fmt.Sprintf("%s is the avro %s %s", goName, named.Type, named.FullName()), named.Doc)
+
+	switch named.Type {
+	case schema.Record, schema.Error:
+		fmt.Fprintf(&buf, "type %s struct {\n", goName)
+		fieldNames := make(map[string]string)
+		for _, field := range named.Fields {
+			fieldName := GoName(field.Name)
+			if other, ok := fieldNames[fieldName]; ok {
+				return "", fmt.Errorf("the fields %s and %s of %s are both named %s in Go", other, field.Name, named.FullName(), fieldName)
+			}
+			fieldNames[fieldName] = field.Name
+			if field.Doc != "" {
+				writeDoc(&buf, "\t", field.Doc)
+			}
+			fmt.Fprintf(&buf, "\t%s %s `avro:%s`\n", fieldName, g.goType(field.Type), strconv.Quote(field.Name))
+		}
+		buf.WriteString("}\n")
+
+	case schema.Enum:
+		fmt.Fprintf(&buf, "type %s string\n\n// The symbols of %s\nconst (\n", goName, goName)
+		for _, symbol := range named.Symbols {
+			fmt.Fprintf(&buf, "\t%s%s %s = %s\n", goName, GoName(titleCase(symbol)), goName, strconv.Quote(symbol))
+		}
+		buf.WriteString(")\n")
+
+	case schema.Fixed:
+		fmt.Fprintf(&buf, "type %s []byte\n", goName)
+	}
+
+	fmt.Fprintf(&buf, "\n// AvroName implements avro.TypeNamer\nfunc (%s) AvroName() string {\n\treturn %s\n}\n", goName, strconv.Quote(named.FullName()))
+	return buf.String(), nil
+}
+
+// goType returns the Go type of an avro type
+func (g *Generator) goType(s *schema.Schema) string {
+	if goType, pkg := logicalType(s); goType != "" {
+		g.imports[pkg] = true
+		return goType
+	}
+	switch s.Type {
+	case schema.Boolean:
+		return "bool"
+	case schema.Int:
+		return "int32"
+	case schema.Long:
+		return "int64"
+	case schema.Float:
+		return "float32"
+	case schema.Double:
+		return "float64"
+	case schema.Bytes:
+		return "[]byte"
+	case schema.String:
+		return "string"
+	case schema.Record, schema.Error, schema.Enum, schema.Fixed:
+		return g.goNames[s.FullName()]
+	case schema.Array:
+		return "[]" + g.goType(s.Items)
+	case schema.Map:
+		return "map[string]" + g.goType(s.Values)
+	case schema.Union:
+		if optional := optionalBranch(s); optional != nil {
+			return "*" + g.goType(optional)
+		}
+	}
+	return "interface{}"
+}
+
+// logicalType returns the Go type of the logical types converted by goavro, and the package declaring it
+func logicalType(s *schema.Schema) (goType, pkg string) {
+	switch {
+	case s.Type == schema.Long && (s.LogicalType == "timestamp-millis" || s.LogicalType == "timestamp-micros"),
+		s.Type == schema.Int && s.LogicalType == "date":
+		return "time.Time", "time"
+	case s.Type == schema.Int && s.LogicalType == "time-millis", s.Type == schema.Long && s.LogicalType == "time-micros":
+		return "time.Duration", "time"
+	case (s.Type == schema.Bytes || s.Type == schema.Fixed) && s.LogicalType == "decimal":
+		return "*big.Rat", "math/big"
+	}
+	return "", ""
+}
+
+// optionalBranch returns the non null branch of an union of null and a type which can be encoded through a pointer:
+// a named type or a primitive type other than bytes, whose union branch name is given by its Go type name.
+func optionalBranch(union *schema.Schema) *schema.Schema {
+	if len(union.Branches) != 2 {
+		return nil
+	}
+	var optional *schema.Schema
+	switch {
+	case union.Branches[0].Type == schema.Null:
+		optional = union.Branches[1]
+	case union.Branches[1].Type == schema.Null:
+		optional = union.Branches[0]
+	default:
+		return nil
+	}
+	if goType, _ := logicalType(optional); goType != "" {
+		return nil
+	}
+	switch optional.Type {
+	case schema.Boolean, schema.Int, schema.Long, schema.Float, schema.Double, schema.String,
+		schema.Record, schema.Error, schema.Enum, schema.Fixed:
+		return optional
+	}
+	return nil
+}
+
+// namedTypes returns the named types declared in a schema, in order of declaration
+func namedTypes(root *schema.Schema) []*schema.Schema {
+	var (
+		named   []*schema.Schema
+		visited = make(map[*schema.Schema]bool)
+		walk    func(s *schema.Schema)
+	)
+	walk = func(s *schema.Schema) {
+		if s == nil || visited[s] {
+			return
+		}
+		visited[s] = true
+		if s.IsNamed() {
+			named = append(named, s)
+		}
+		for _, field := range s.Fields {
+			walk(field.Type)
+		}
+		walk(s.Items)
+		walk(s.Values)
+		for _, branch := range s.Branches {
+			walk(branch)
+		}
+	}
+	walk(root)
+	return named
+}
+
+// GoName converts an avro name to an exported Go identifier: user_id becomes UserID
+func GoName(name string) string {
+	var result strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if initialisms[strings.ToLower(part)] {
+			result.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		result.WriteString(string(runes))
+	}
+	if result.Len() == 0 || !unicode.IsLetter([]rune(result.String())[0]) {
+		return "X" + result.String()
+	}
+	return result.String()
+}
+
+// titleCase lowers the upper case words of a name, as the enum symbols often are: IN_TRANSIT becomes In_Transit
+func titleCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i, part := range parts {
+		if part == strings.ToUpper(part) && !initialisms[strings.ToLower(part)] {
+			runes := []rune(strings.ToLower(part))
+			if len(runes) > 0 {
+				runes[0] = unicode.ToUpper(runes[0])
+			}
+			parts[i] = string(runes)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// writeDoc writes a comment made of the given paragraphs
+func writeDoc(buf *bytes.Buffer, indent string, paragraphs ...string) {
+	for i, paragraph := range paragraphs {
+		if paragraph == "" {
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintf(buf, "%s//\n", indent)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(paragraph), "\n") {
+			fmt.Fprintf(buf, "%s// %s\n", indent, strings.TrimSpace(line))
+		}
+	}
+}
+
+// quote returns a Go string literal, raw if possible to keep the schema readable
+func quote(s string) string {
+	if strings.Contains(s, "`") || strings.Contains(s, "\r") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
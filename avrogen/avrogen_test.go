@@ -0,0 +1,95 @@
+package avrogen
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerator_Generate(t *testing.T) {
+	spec, err := ioutil.ReadFile("testdata/order.avsc")
+	require.NoError(t, err)
+	g := NewGenerator("example")
+	require.NoError(t, g.AddSchema(string(spec)))
+
+	code, err := g.Generate()
+	require.NoError(t, err)
+	expected, err := ioutil.ReadFile("internal/example/order.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(code), "internal/example must be regenerated with go generate")
+}
+
+func TestGenerator_AddSchema(t *testing.T) {
+	g := NewGenerator("example")
+	assert.Error(t, g.AddSchema(`"string"`), "a primitive type has no name")
+	assert.Error(t, g.AddSchema(`{"type": "record"}`))
+
+	require.NoError(t, g.AddSchema(`{"type": "record", "name": "a", "fields": [
+	  {"name": "s", "type": {"type": "enum", "name": "s", "symbols": ["X"]}}
+	]}`))
+	require.NoError(t, g.AddSchema(`{"type": "record", "name": "b", "fields": [
+	  {"name": "s", "type": {"type": "enum", "name": "s", "symbols": ["X"]}}
+	]}`), "a type can be declared by several schemas")
+	assert.EqualError(t, g.AddSchema(`{"type": "record", "name": "c", "fields": [
+	  {"name": "s", "type": {"type": "enum", "name": "s", "symbols": ["Y"]}}
+	]}`), "the type s has conflicting definitions")
+	assert.EqualError(t, g.AddSchema(`{"type": "record", "name": "a", "fields": []}`), "the schema a is added twice")
+
+	require.NoError(t, g.AddSchema(`{"type": "record", "name": "d", "namespace": "other", "fields": [
+	  {"name": "s", "type": {"type": "enum", "name": "s", "symbols": ["Z"]}}
+	]}`))
+	code, err := g.Generate()
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "type S string")
+	assert.Contains(t, string(code), "type OtherS string", "the full name is used when the short name is taken")
+	assert.Contains(t, string(code), "S OtherS `avro:\"s\"`")
+
+	assert.EqualError(t, NewGenerator("example").AddSchema(`{"type": "record", "name": "e", "fields": [
+	  {"name": "user_id", "type": "int"}, {"name": "userID", "type": "int"}
+	]}`), "the fields user_id and userID of e are both named UserID in Go")
+}
+
+func TestGoName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"name":       "Name",
+		"user_id":    "UserID",
+		"firstName":  "FirstName",
+		"__private_": "Private",
+		"_":          "X",
+		"v_1":        "V1",
+		"PENDING":    "PENDING",
+		"image_url":  "ImageURL",
+	} {
+		assert.Equal(t, expected, GoName(name), name)
+	}
+}
+
+func TestTitleCase(t *testing.T) {
+	assert.Equal(t, "InTransit", GoName(titleCase("IN_TRANSIT")))
+	assert.Equal(t, "Pending", GoName(titleCase("PENDING")))
+	assert.Equal(t, "CheckedByAPI", GoName(titleCase("checkedBy_API")))
+}
+
+func TestGenerator_logical_types(t *testing.T) {
+	g := NewGenerator("example")
+	require.NoError(t, g.AddSchema(`{"type": "record", "name": "a", "fields": [
+	  {"name": "price", "type": {"type": "fixed", "name": "amount", "size": 8, "logicalType": "decimal", "precision": 10, "scale": 2}},
+	  {"name": "at", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+	  {"name": "elapsed", "type": {"type": "long", "logicalType": "time-micros"}},
+	  {"name": "id", "type": {"type": "string", "logicalType": "uuid"}},
+	  {"name": "day", "type": ["null", {"type": "int", "logicalType": "date"}]}
+	]}`))
+	code, err := g.Generate()
+	require.NoError(t, err)
+	// the aligned fields are compared without their alignment
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	assert.Contains(t, generated, "Price *big.Rat `avro:\"price\"`")
+	assert.NotContains(t, generated, "type Amount", "the decimal fixed types are not declared")
+	assert.Contains(t, generated, "At time.Time `avro:\"at\"`")
+	assert.Contains(t, generated, "Elapsed time.Duration `avro:\"elapsed\"`")
+	assert.Contains(t, generated, "ID string `avro:\"id\"`")
+	assert.Contains(t, generated, "Day interface{} `avro:\"day\"`")
+}
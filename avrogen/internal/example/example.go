@@ -0,0 +1,4 @@
+// Package example holds the code generated from avrogen/testdata, checked by the tests of avrogen
+package example
+
+//go:generate go run ../../../cmd/avrogen -package example -o order.go ../../testdata/order.avsc
@@ -0,0 +1,79 @@
+package example
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	avro "github.com/leboncoin/avrocado"
+	"github.com/leboncoin/avrocado/avrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOrder() Order {
+	shipped := StatusShipped
+	coupon := "WELCOME"
+	email := "jane@example.com"
+	placedAt := time.Date(2020, 3, 14, 15, 9, 26, 535000000, time.UTC)
+	return Order{
+		OrderID:        "42",
+		Quantity:       2,
+		Total:          12.5,
+		Status:         StatusPending,
+		PreviousStatus: &shipped,
+		Coupon:         &coupon,
+		Customer:       Customer{Name: "john"},
+		Referrer:       &Customer{Name: "jane", Email: &email},
+		Items:          []Item{{Sku: "a", Price: 500}, {Sku: "b", Price: 750}},
+		Tags:           map[string]string{"channel": "web"},
+		Checksum:       MD5("0123456789abcdef"),
+		Payment:        map[string]interface{}{"long": int64(1250)},
+		PlacedAt:       placedAt,
+		DeliveryDate:   time.Date(2020, 3, 16, 0, 0, 0, 0, time.UTC),
+		Preparation:    90 * time.Minute,
+		Discount:       big.NewRat(25, 2),
+		ShippedAt:      map[string]interface{}{"long.timestamp-millis": placedAt.Add(time.Hour)},
+	}
+}
+
+func TestOrder_Codec(t *testing.T) {
+	codec, err := avro.NewCodec(OrderSchema)
+	require.NoError(t, err)
+
+	order := newOrder()
+	payload, err := codec.Marshal(order)
+	require.NoError(t, err)
+	var decoded Order
+	require.NoError(t, codec.Unmarshal(payload, &decoded))
+	assert.Equal(t, order, decoded)
+
+	payload, err = codec.Marshal(Order{
+		Status:   StatusShipped,
+		Customer: Customer{Name: "john"},
+		Checksum: MD5("0123456789abcdef"),
+		PlacedAt: time.Unix(0, 0).UTC(),
+		Discount: new(big.Rat),
+	})
+	require.NoError(t, err, "the optional fields can be nil")
+	decoded = Order{}
+	require.NoError(t, codec.Unmarshal(payload, &decoded))
+	assert.Nil(t, decoded.Referrer)
+}
+
+func TestOrder_CodecRegistry(t *testing.T) {
+	server := avrotest.NewServer()
+	defer server.Close()
+	registry, err := avro.NewSchemaRegistry(server.URL)
+	require.NoError(t, err)
+	codecRegistry, err := avro.NewCodecRegistryWithClient(registry, "orders-value", "")
+	require.NoError(t, err)
+	codecRegistry.AutoRegister = true
+
+	order := newOrder()
+	payload, err := codecRegistry.Marshal(order)
+	require.NoError(t, err, "the schema is given by the generated AvroSchema")
+	var decoded Order
+	require.NoError(t, codecRegistry.Unmarshal(payload, &decoded))
+	assert.Equal(t, order, decoded)
+}
@@ -0,0 +1,73 @@
+// Package avrokafkago encodes and decodes the keys and the values of the messages of the kafka-go client
+// (github.com/segmentio/kafka-go) with the avro codecs of their topic.
+//
+// The package doesn't import kafka-go, keeping it out of the dependencies of avrocado: the helpers
+// produce and take the Key and Value fields of kafka.Message.
+//
+//	serde, err := avro.NewTopicSerde(registryURL, "people", keySchema, valueSchema)
+//	...
+//	key, value, err := avrokafkago.Marshal(serde, "people", personKey, person)
+//	...
+//	err = writer.WriteMessages(ctx, kafka.Message{Topic: "people", Key: key, Value: value})
+//	...
+//	msg, err := reader.ReadMessage(ctx)
+//	...
+//	err = avrokafkago.Unmarshal(serde, msg.Topic, msg.Key, msg.Value, &personKey, &person)
+package avrokafkago
+
+import (
+	"fmt"
+
+	avro "github.com/leboncoin/avrocado"
+)
+
+// Marshal encodes the key and the value of a message of the topic.
+// A nil key is not encoded, the message having no key.
+func Marshal(codecs avro.TopicCodecs, topic string, key, value interface{}) ([]byte, []byte, error) {
+	var keyBytes []byte
+	if key != nil {
+		codec, err := codecs.TopicCodec(topic, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		keyBytes, err = codec.Marshal(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("key encoding error: %w", err)
+		}
+	}
+	codec, err := codecs.TopicCodec(topic, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	valueBytes, err := codec.Marshal(value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("value encoding error: %w", err)
+	}
+	return keyBytes, valueBytes, nil
+}
+
+// Unmarshal decodes the key and the value of a message of the topic.
+// The key is skipped when keyTo is nil or when the message has no key, and a nil value (a tombstone)
+// leaves valueTo untouched, as the Deserializer of avroconfluent does.
+func Unmarshal(codecs avro.TopicCodecs, topic string, key, value []byte, keyTo, valueTo interface{}) error {
+	if keyTo != nil && len(key) > 0 {
+		codec, err := codecs.TopicCodec(topic, true)
+		if err != nil {
+			return err
+		}
+		if err := codec.Unmarshal(key, keyTo); err != nil {
+			return fmt.Errorf("key decoding error: %w", err)
+		}
+	}
+	if value == nil {
+		return nil
+	}
+	codec, err := codecs.TopicCodec(topic, false)
+	if err != nil {
+		return err
+	}
+	if err := codec.Unmarshal(value, valueTo); err != nil {
+		return fmt.Errorf("value decoding error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package avrokafkago
+
+import (
+	"testing"
+
+	avro "github.com/leboncoin/avrocado"
+	"github.com/leboncoin/avrocado/avrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	keySchema   = `{"type": "record", "name": "person_key", "fields": [{"name": "name", "type": "string"}]}`
+	valueSchema = `{"type": "record", "name": "person", "fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int"}
+	]}`
+)
+
+type personKey struct {
+	Name string `avro:"name"`
+}
+
+type person struct {
+	Name string `avro:"name"`
+	Age  int32  `avro:"age"`
+}
+
+// message holds the fields of kafka.Message handled by the helpers
+type message struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+func TestMarshal_Unmarshal(t *testing.T) {
+	server := avrotest.NewServer()
+	defer server.Close()
+	serde, err := avro.NewTopicSerdeAndRegister(server.URL, "people", keySchema, valueSchema)
+	require.NoError(t, err)
+
+	msg := message{Topic: "people"}
+	msg.Key, msg.Value, err = Marshal(serde, msg.Topic, personKey{"Nico"}, person{"Nico", 36})
+	require.NoError(t, err)
+
+	var key personKey
+	var value person
+	require.NoError(t, Unmarshal(serde, msg.Topic, msg.Key, msg.Value, &key, &value))
+	assert.Equal(t, personKey{"Nico"}, key)
+	assert.Equal(t, person{"Nico", 36}, value)
+
+	// the messages without key
+	msg.Key, msg.Value, err = Marshal(serde, msg.Topic, nil, person{"Rob", 42})
+	require.NoError(t, err)
+	assert.Nil(t, msg.Key)
+	require.NoError(t, Unmarshal(serde, msg.Topic, msg.Key, msg.Value, &key, &value))
+	assert.Equal(t, person{"Rob", 42}, value)
+	require.NoError(t, Unmarshal(serde, msg.Topic, nil, msg.Value, nil, &value))
+
+	_, _, err = Marshal(serde, msg.Topic, personKey{"Nico"}, map[string]interface{}{"name": 1})
+	assert.Error(t, err)
+	_, _, err = Marshal(serde, "other", nil, person{"Rob", 42})
+	assert.Error(t, err)
+	assert.Error(t, Unmarshal(serde, msg.Topic, []byte{1, 2, 3}, msg.Value, &key, &value))
+
+	// the tombstones have a key and no value
+	msg.Key, _, err = Marshal(serde, msg.Topic, personKey{"Anne"}, person{})
+	require.NoError(t, err)
+	require.NoError(t, Unmarshal(serde, msg.Topic, msg.Key, nil, &key, &value))
+	assert.Equal(t, personKey{"Anne"}, key)
+	assert.Equal(t, person{"Rob", 42}, value, "the value is left untouched")
+}
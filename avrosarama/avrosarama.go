@@ -0,0 +1,92 @@
+// Package avrosarama adapts the avro codecs of a kafka topic to the sarama client
+// (github.com/IBM/sarama, formerly github.com/Shopify/sarama).
+//
+// The package doesn't import sarama, keeping it out of the dependencies of avrocado:
+// Encoder implements sarama.Encoder, and the consumed messages are decoded from their fields.
+//
+//	serde, err := avro.NewTopicSerde(registryURL, "people", keySchema, valueSchema)
+//	...
+//	_, _, err = producer.SendMessage(&sarama.ProducerMessage{
+//		Topic: "people",
+//		Key:   avrosarama.NewKeyEncoder(serde, "people", key),
+//		Value: avrosarama.NewValueEncoder(serde, "people", value),
+//	})
+//	...
+//	err = avrosarama.UnmarshalValue(serde, msg.Topic, msg.Value, &value)
+package avrosarama
+
+import (
+	"sync"
+
+	avro "github.com/leboncoin/avrocado"
+)
+
+// Encoder encodes the key or the value of a message with the codec of its topic, implementing sarama.Encoder.
+// The encoding is done once, by the first call to Encode or Length.
+type Encoder struct {
+	codecs avro.TopicCodecs
+	topic  string
+	isKey  bool
+	data   interface{}
+
+	once sync.Once
+	buf  []byte
+	err  error
+}
+
+// NewEncoder returns an Encoder encoding data with the key or the value codec of the topic
+func NewEncoder(codecs avro.TopicCodecs, topic string, isKey bool, data interface{}) *Encoder {
+	return &Encoder{codecs: codecs, topic: topic, isKey: isKey, data: data}
+}
+
+// NewKeyEncoder returns an Encoder encoding a key of the topic
+func NewKeyEncoder(codecs avro.TopicCodecs, topic string, key interface{}) *Encoder {
+	return NewEncoder(codecs, topic, true, key)
+}
+
+// NewValueEncoder returns an Encoder encoding a value of the topic
+func NewValueEncoder(codecs avro.TopicCodecs, topic string, value interface{}) *Encoder {
+	return NewEncoder(codecs, topic, false, value)
+}
+
+func (e *Encoder) encode() {
+	codec, err := e.codecs.TopicCodec(e.topic, e.isKey)
+	if err != nil {
+		e.err = err
+		return
+	}
+	if e.buf, e.err = codec.Marshal(e.data); e.err != nil {
+		e.buf = nil
+	}
+}
+
+// Encode returns the encoding of the data
+func (e *Encoder) Encode() ([]byte, error) {
+	e.once.Do(e.encode)
+	return e.buf, e.err
+}
+
+// Length returns the length of the encoding, 0 when it fails: the error is then returned by Encode
+func (e *Encoder) Length() int {
+	e.once.Do(e.encode)
+	return len(e.buf)
+}
+
+// Unmarshal decodes the key or the value of a consumed message with the codec of its topic
+func Unmarshal(codecs avro.TopicCodecs, topic string, isKey bool, from []byte, to interface{}) error {
+	codec, err := codecs.TopicCodec(topic, isKey)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(from, to)
+}
+
+// UnmarshalKey decodes the key of a consumed message, ex: UnmarshalKey(serde, msg.Topic, msg.Key, &key)
+func UnmarshalKey(codecs avro.TopicCodecs, topic string, from []byte, to interface{}) error {
+	return Unmarshal(codecs, topic, true, from, to)
+}
+
+// UnmarshalValue decodes the value of a consumed message, ex: UnmarshalValue(serde, msg.Topic, msg.Value, &value)
+func UnmarshalValue(codecs avro.TopicCodecs, topic string, from []byte, to interface{}) error {
+	return Unmarshal(codecs, topic, false, from, to)
+}
@@ -0,0 +1,77 @@
+package avrosarama
+
+import (
+	"testing"
+
+	avro "github.com/leboncoin/avrocado"
+	"github.com/leboncoin/avrocado/avrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	keySchema   = `{"type": "record", "name": "person_key", "fields": [{"name": "name", "type": "string"}]}`
+	valueSchema = `{"type": "record", "name": "person", "fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int"}
+	]}`
+)
+
+type personKey struct {
+	Name string `avro:"name"`
+}
+
+type person struct {
+	Name string `avro:"name"`
+	Age  int32  `avro:"age"`
+}
+
+// saramaEncoder is sarama.Encoder
+type saramaEncoder interface {
+	Encode() ([]byte, error)
+	Length() int
+}
+
+func TestEncoder(t *testing.T) {
+	server := avrotest.NewServer()
+	defer server.Close()
+	serde, err := avro.NewTopicSerdeAndRegister(server.URL, "people", keySchema, valueSchema)
+	require.NoError(t, err)
+
+	var key, value saramaEncoder = NewKeyEncoder(serde, "people", personKey{"Nico"}), NewValueEncoder(serde, "people", person{"Nico", 36})
+	keyBytes, err := key.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, len(keyBytes), key.Length())
+	valueBytes, err := value.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, len(valueBytes), value.Length())
+
+	// the keys and the values are encoded with the schemas of their subject
+	expected, err := serde.Key.Marshal(personKey{"Nico"})
+	require.NoError(t, err)
+	assert.Equal(t, expected, keyBytes)
+	assert.NotEqual(t, keyBytes[:5], valueBytes[:5])
+
+	var decodedKey personKey
+	require.NoError(t, UnmarshalKey(serde, "people", keyBytes, &decodedKey))
+	assert.Equal(t, personKey{"Nico"}, decodedKey)
+	var decodedValue person
+	require.NoError(t, UnmarshalValue(serde, "people", valueBytes, &decodedValue))
+	assert.Equal(t, person{"Nico", 36}, decodedValue)
+}
+
+func TestEncoder_errors(t *testing.T) {
+	server := avrotest.NewServer()
+	defer server.Close()
+	serde, err := avro.NewTopicSerdeAndRegister(server.URL, "people", keySchema, valueSchema)
+	require.NoError(t, err)
+
+	invalid := NewValueEncoder(serde, "people", map[string]interface{}{"name": 1})
+	assert.Equal(t, 0, invalid.Length())
+	_, err = invalid.Encode()
+	assert.Error(t, err)
+
+	_, err = NewValueEncoder(serde, "other", person{"Nico", 36}).Encode()
+	assert.Error(t, err)
+	assert.Error(t, UnmarshalValue(serde, "other", nil, &person{}))
+}
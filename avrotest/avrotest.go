@@ -0,0 +1,311 @@
+// Package avrotest provides a fake Confluent schema registry, serving the registry's REST API
+// on top of an avro.MemorySchemaRegistry, to run tests without any schema registry service:
+//
+//	server := avrotest.NewServer()
+//	defer server.Close()
+//	registry, err := avro.NewSchemaRegistry(server.URL)
+package avrotest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	avro "github.com/leboncoin/avrocado"
+)
+
+// The modes of the schema registry
+const (
+	ModeReadWrite = "READWRITE"
+	ModeReadOnly  = "READONLY"
+	ModeImport    = "IMPORT"
+)
+
+// These numbers are used by the schema registry to communicate errors.
+const (
+	errorCodeRouteNotFound = 404
+	errorCodeInvalidMode   = 42204
+	errorCodeReadOnly      = 42205
+	errorCodeInternal      = 50001
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// Handler serves the REST API of the Confluent schema registry:
+// subjects, versions, schemas by ID, compatibility, config and mode
+type Handler struct {
+	Registry *avro.MemorySchemaRegistry
+
+	lock        sync.RWMutex
+	mode        string
+	subjectMode map[string]string
+}
+
+// NewHandler returns a Handler serving the given registry, a new one being created if nil
+func NewHandler(registry *avro.MemorySchemaRegistry) *Handler {
+	if registry == nil {
+		registry = avro.NewMemorySchemaRegistry()
+	}
+	return &Handler{
+		Registry:    registry,
+		mode:        ModeReadWrite,
+		subjectMode: make(map[string]string),
+	}
+}
+
+// Server is an httptest.Server serving a Handler
+type Server struct {
+	*httptest.Server
+	Handler *Handler
+}
+
+// NewServer starts a fake schema registry on a local port, it must be closed at the end of the test
+func NewServer() *Server {
+	handler := NewHandler(nil)
+	return &Server{Server: httptest.NewServer(handler), Handler: handler}
+}
+
+type schemaRequest struct {
+	Schema string `json:"schema"`
+}
+
+type configRequest struct {
+	Compatibility avro.CompatibilityLevel `json:"compatibility"`
+}
+
+type modeRequest struct {
+	Mode string `json:"mode"`
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments, err := pathSegments(r.URL)
+	if err != nil {
+		writeError(w, avro.ConfluentError{ErrorCode: errorCodeRouteNotFound, Message: err.Error()})
+		return
+	}
+	out, err := h.route(r, segments)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if raw, ok := out.(rawSchema); ok {
+		_, _ = w.Write([]byte(raw))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// rawSchema is a response sent as is instead of being JSON encoded
+type rawSchema string
+
+func (h *Handler) route(r *http.Request, segments []string) (interface{}, error) {
+	n := len(segments)
+	switch {
+	case n == 1 && segments[0] == "subjects" && r.Method == http.MethodGet:
+		return h.Registry.Subjects()
+
+	case n == 2 && segments[0] == "subjects" && r.Method == http.MethodPost:
+		var req schemaRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		// The subject is looked up before the schema is parsed, as done by the schema registry
+		if _, err := h.Registry.Versions(segments[1]); err != nil {
+			return nil, err
+		}
+		isRegistered, schema, err := h.Registry.IsRegistered(segments[1], req.Schema)
+		if err != nil {
+			return nil, err
+		}
+		if !isRegistered {
+			return nil, avro.ConfluentError{ErrorCode: avro.ErrorCodeSchemaNotFound, Message: "Schema not found"}
+		}
+		return schema, nil
+
+	case n == 2 && segments[0] == "subjects" && r.Method == http.MethodDelete:
+		if err := h.checkWritable(segments[1]); err != nil {
+			return nil, err
+		}
+		return h.Registry.DeleteSubject(segments[1])
+
+	case n == 3 && segments[0] == "subjects" && segments[2] == "versions" && r.Method == http.MethodGet:
+		return h.Registry.Versions(segments[1])
+
+	case n == 3 && segments[0] == "subjects" && segments[2] == "versions" && r.Method == http.MethodPost:
+		if err := h.checkWritable(segments[1]); err != nil {
+			return nil, err
+		}
+		var req schemaRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		id, err := h.Registry.RegisterNewSchema(segments[1], req.Schema)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int{"id": id}, nil
+
+	case (n == 4 || n == 5) && segments[0] == "subjects" && segments[2] == "versions":
+		version, err := parseVersion(segments[3])
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case n == 4 && r.Method == http.MethodGet:
+			return h.Registry.GetSchemaBySubject(segments[1], version)
+		case n == 5 && segments[4] == "schema" && r.Method == http.MethodGet:
+			schema, err := h.Registry.GetSchemaBySubject(segments[1], version)
+			return rawSchema(schema.Schema), err
+		case n == 4 && r.Method == http.MethodDelete:
+			if err := h.checkWritable(segments[1]); err != nil {
+				return nil, err
+			}
+			return h.Registry.DeleteSchemaVersion(segments[1], version)
+		}
+
+	case n == 3 && segments[0] == "schemas" && segments[1] == "ids" && r.Method == http.MethodGet:
+		id, err := strconv.Atoi(segments[2])
+		if err != nil {
+			return nil, avro.ConfluentError{ErrorCode: avro.ErrorCodeSchemaNotFound, Message: "Schema not found"}
+		}
+		schema, err := h.Registry.GetSchemaByID(id)
+		return map[string]string{"schema": schema}, err
+
+	case n == 5 && segments[0] == "compatibility" && segments[1] == "subjects" && segments[3] == "versions" && r.Method == http.MethodPost:
+		version, err := parseVersion(segments[4])
+		if err != nil {
+			return nil, err
+		}
+		var req schemaRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		compatible, err := h.Registry.TestCompatibility(segments[2], req.Schema, version)
+		return map[string]bool{"is_compatible": compatible}, err
+
+	case (n == 1 || n == 2) && segments[0] == "config":
+		subject := ""
+		if n == 2 {
+			subject = segments[1]
+		}
+		switch r.Method {
+		case http.MethodGet:
+			return map[string]avro.CompatibilityLevel{"compatibilityLevel": h.Registry.Compatibility(subject)}, nil
+		case http.MethodPut:
+			var req configRequest
+			if err := decode(r, &req); err != nil {
+				return nil, err
+			}
+			return req, h.Registry.SetCompatibility(subject, req.Compatibility)
+		}
+
+	case (n == 1 || n == 2) && segments[0] == "mode":
+		subject := ""
+		if n == 2 {
+			subject = segments[1]
+		}
+		switch r.Method {
+		case http.MethodGet:
+			return modeRequest{h.Mode(subject)}, nil
+		case http.MethodPut:
+			var req modeRequest
+			if err := decode(r, &req); err != nil {
+				return nil, err
+			}
+			return req, h.SetMode(subject, req.Mode)
+		}
+	}
+	return nil, avro.ConfluentError{ErrorCode: errorCodeRouteNotFound, Message: "HTTP 404 Not Found"}
+}
+
+// Mode returns the mode of a subject, or the global one if subject is empty
+func (h *Handler) Mode(subject string) string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if mode, ok := h.subjectMode[subject]; ok {
+		return mode
+	}
+	return h.mode
+}
+
+// SetMode sets the mode of a subject, or the global one if subject is empty.
+// The subjects in READONLY mode reject registrations and deletions.
+func (h *Handler) SetMode(subject, mode string) error {
+	switch mode {
+	case ModeReadWrite, ModeReadOnly, ModeImport:
+	default:
+		return avro.ConfluentError{ErrorCode: errorCodeInvalidMode, Message: fmt.Sprintf("Invalid mode %q", mode)}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if subject == "" {
+		h.mode = mode
+	} else {
+		h.subjectMode[subject] = mode
+	}
+	return nil
+}
+
+func (h *Handler) checkWritable(subject string) error {
+	if h.Mode(subject) == ModeReadOnly {
+		return avro.ConfluentError{ErrorCode: errorCodeReadOnly, Message: fmt.Sprintf("Subject %s is in read-only mode", subject)}
+	}
+	return nil
+}
+
+// pathSegments splits the path of the URL into its unescaped segments
+func pathSegments(u *url.URL) ([]string, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(u.EscapedPath(), "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, unescaped)
+	}
+	return segments, nil
+}
+
+func parseVersion(raw string) (int, error) {
+	if raw == "latest" {
+		return -1, nil
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil || (version < 1 && version != -1) {
+		return 0, avro.ConfluentError{
+			ErrorCode: avro.ErrorCodeInvalidVersion,
+			Message:   "The specified version is not a valid version id. Allowed values are between [1, 2^31-1] and the string \"latest\"",
+		}
+	}
+	return version, nil
+}
+
+func decode(r *http.Request, out interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		return avro.ConfluentError{ErrorCode: errorCodeInternal, Message: fmt.Sprintf("invalid body: %s", err)}
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var ce avro.ConfluentError
+	if !errors.As(err, &ce) {
+		ce = avro.ConfluentError{ErrorCode: errorCodeInternal, Message: err.Error()}
+	}
+	// The HTTP status is given by the first three digits of the error code
+	status := ce.ErrorCode
+	for status > 999 {
+		status /= 10
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ce)
+}
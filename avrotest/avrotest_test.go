@@ -0,0 +1,195 @@
+package avrotest
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	avro "github.com/leboncoin/avrocado"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	userV1 = `{"type":"record","name":"user","fields":[{"name":"name","type":"string"}]}`
+	userV2 = `{"type":"record","name":"user","fields":[{"name":"name","type":"string"},{"name":"age","type":"int","default":0}]}`
+	userV3 = `{"type":"record","name":"user","fields":[{"name":"name","type":"int"}]}`
+)
+
+func assertErrorCode(t *testing.T, err error, code int) {
+	var ce avro.ConfluentError
+	if assert.True(t, errors.As(err, &ce), "%v is not a ConfluentError", err) {
+		assert.Equal(t, code, ce.ErrorCode)
+	}
+}
+
+func do(t *testing.T, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	out, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, strings.TrimSpace(string(out))
+}
+
+func TestServer_client(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, err := avro.NewSchemaRegistry(server.URL)
+	require.NoError(t, err)
+
+	_, err = client.Versions("users-value")
+	assertErrorCode(t, err, avro.ErrorCodeSubjectNotFound)
+	isRegistered, _, err := client.IsRegistered("users-value", userV1)
+	require.NoError(t, err)
+	assert.False(t, isRegistered)
+
+	id1, err := client.RegisterNewSchema("users-value", userV1)
+	require.NoError(t, err)
+	id2, err := client.RegisterNewSchema("users-value", userV2)
+	require.NoError(t, err)
+	again, err := client.RegisterNewSchema("other-value", userV1)
+	require.NoError(t, err)
+	assert.Equal(t, id1, again)
+	_, err = client.RegisterNewSchema("users-value", userV3)
+	assertErrorCode(t, err, avro.ErrorCodeIncompatibleSchema)
+
+	subjects, err := client.Subjects()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"users-value", "other-value"}, subjects)
+	versions, err := client.Versions("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	isRegistered, schema, err := client.IsRegistered("users-value", userV2)
+	require.NoError(t, err)
+	assert.True(t, isRegistered)
+	assert.Equal(t, avro.Schema{Schema: userV2, Subject: "users-value", Version: 2, ID: id2}, schema)
+
+	raw, err := client.GetSchemaByID(id1)
+	require.NoError(t, err)
+	assert.Equal(t, userV1, raw)
+	_, err = client.GetSchemaByID(42)
+	assertErrorCode(t, err, avro.ErrorCodeSchemaNotFound)
+
+	schema, err = client.GetSchemaBySubject("users-value", 1)
+	require.NoError(t, err)
+	assert.Equal(t, id1, schema.ID)
+	_, err = client.GetSchemaBySubject("users-value", 3)
+	assertErrorCode(t, err, avro.ErrorCodeVersionNotFound)
+	schema, err = client.GetLatestSchema("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, 2, schema.Version)
+
+	deleted, err := client.DeleteSubject("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, deleted)
+	_, err = client.GetLatestSchema("users-value")
+	assertErrorCode(t, err, avro.ErrorCodeSubjectNotFound)
+}
+
+func TestServer_codecRegistry(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	codecRegistry, err := avro.NewCodecRegistryAndRegister(server.URL, "users-value", userV1)
+	require.NoError(t, err)
+	type user struct {
+		Name string `avro:"name"`
+	}
+	payload, err := codecRegistry.Marshal(&user{Name: "john"})
+	require.NoError(t, err)
+	var out user
+	require.NoError(t, codecRegistry.Unmarshal(payload, &out))
+	assert.Equal(t, "john", out.Name)
+}
+
+func TestServer_versions(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	_, err := server.Handler.Registry.RegisterNewSchema("users-value", userV1)
+	require.NoError(t, err)
+	_, err = server.Handler.Registry.RegisterNewSchema("users-value", userV2)
+	require.NoError(t, err)
+
+	status, body := do(t, http.MethodGet, server.URL+"/subjects/users-value/versions/latest/schema", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, userV2, body)
+
+	status, body = do(t, http.MethodGet, server.URL+"/subjects/users-value/versions/zero", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Contains(t, body, `"error_code":42202`)
+
+	status, body = do(t, http.MethodDelete, server.URL+"/subjects/users-value/versions/latest", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "2", body)
+	versions, err := server.Handler.Registry.Versions("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, versions)
+
+	status, _ = do(t, http.MethodGet, server.URL+"/unknown", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestServer_compatibility(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	_, err := server.Handler.Registry.RegisterNewSchema("users-value", userV1)
+	require.NoError(t, err)
+
+	status, body := do(t, http.MethodPost, server.URL+"/compatibility/subjects/users-value/versions/latest",
+		`{"schema":`+quote(userV2)+`}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"is_compatible":true}`, body)
+	status, body = do(t, http.MethodPost, server.URL+"/compatibility/subjects/users-value/versions/1",
+		`{"schema":`+quote(userV3)+`}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"is_compatible":false}`, body)
+
+	status, body = do(t, http.MethodGet, server.URL+"/config", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"compatibilityLevel":"BACKWARD"}`, body)
+	status, body = do(t, http.MethodPut, server.URL+"/config/users-value", `{"compatibility":"NONE"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"compatibility":"NONE"}`, body)
+	assert.Equal(t, avro.CompatibilityLevel("NONE"), server.Handler.Registry.Compatibility("users-value"))
+	status, body = do(t, http.MethodPut, server.URL+"/config", `{"compatibility":"SOMETIMES"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Contains(t, body, `"error_code":42203`)
+
+	_, err = server.Handler.Registry.RegisterNewSchema("users-value", userV3)
+	assert.NoError(t, err)
+}
+
+func TestServer_mode(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, err := avro.NewSchemaRegistry(server.URL)
+	require.NoError(t, err)
+
+	status, body := do(t, http.MethodGet, server.URL+"/mode", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"mode":"READWRITE"}`, body)
+	status, body = do(t, http.MethodPut, server.URL+"/mode/users-value", `{"mode":"READONLY"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"mode":"READONLY"}`, body)
+	assert.Equal(t, ModeReadOnly, server.Handler.Mode("users-value"))
+	assert.Equal(t, ModeReadWrite, server.Handler.Mode("other-value"))
+
+	_, err = client.RegisterNewSchema("users-value", userV1)
+	assertErrorCode(t, err, errorCodeReadOnly)
+	_, err = client.RegisterNewSchema("other-value", userV1)
+	assert.NoError(t, err)
+
+	status, body = do(t, http.MethodPut, server.URL+"/mode", `{"mode":"SLEEPING"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Contains(t, body, `"error_code":42204`)
+}
+
+func quote(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,217 @@
+package avro
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/leboncoin/avrocado/internal/schema"
+)
+
+// The mismatches reported by CheckType, wrapped in the FieldErrors of a TypeError
+var (
+	// ErrMissingField is the error of the schema fields without default value and without matching struct field
+	ErrMissingField = errors.New("no value provided and no default value in the schema")
+	// ErrExtraField is the error of the struct fields without matching schema field
+	ErrExtraField = errors.New("the field is not in the schema")
+	// ErrIncompatibleType is the error of the Go types which can't be encoded with the avro type
+	ErrIncompatibleType = errors.New("the Go type is not compatible with the avro type")
+	// ErrUnmatchedBranch is the error of the Go types whose name doesn't match any branch of the union
+	ErrUnmatchedBranch = errors.New("no branch of the union is named after the Go type")
+	// ErrEnumMismatch is the error of the Go types whose avro name is not the name of the enum
+	ErrEnumMismatch = errors.New("the avro name of the Go type is not the name of the enum")
+)
+
+// TypeError lists the mismatches between a Go type and a schema found by CheckType
+type TypeError struct {
+	Type   reflect.Type
+	Fields []*FieldError
+}
+
+func (e *TypeError) Error() string {
+	mismatches := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		mismatches[i] = field.Error()
+	}
+	return fmt.Sprintf("type %v doesn't match the schema: %s", e.Type, strings.Join(mismatches, "; "))
+}
+
+// CheckType statically checks that the values of a Go type can be encoded with the schema of the codec,
+// walking the struct fields, pointers, slices, maps and nested records as Marshal does.
+// It returns a *TypeError listing every missing or extra field, omitempty field without default value,
+// incompatible type, union branch not matching the name of a Go type and enum not matching the TypeNamer
+// name of a Go type, so that the services can fail fast at startup.
+// The logical types and the interface values are not checked.
+func (c *Codec) CheckType(t reflect.Type) error {
+	if c.parsed == nil {
+		if c.parseErr != nil {
+			return fmt.Errorf("schema.Parse error: %w", c.parseErr)
+		}
+		return errors.New("the schema of the codec can't be walked")
+	}
+	checker := typeChecker{codec: c, visited: make(map[typeCheck]bool)}
+	if t.Kind() == reflect.Ptr {
+		// Marshal dereferences the values given by pointer
+		t = t.Elem()
+	}
+	checker.check(t, c.parsed, "")
+	if len(checker.mismatches) > 0 {
+		return &TypeError{Type: t, Fields: checker.mismatches}
+	}
+	return nil
+}
+
+type typeCheck struct {
+	t reflect.Type
+	s *schema.Schema
+}
+
+type typeChecker struct {
+	codec      *Codec
+	visited    map[typeCheck]bool
+	mismatches []*FieldError
+}
+
+func (c *typeChecker) mismatch(path string, s *schema.Schema, t reflect.Type, err error) {
+	c.mismatches = append(c.mismatches, newFieldError(path, s, t, nil, err))
+}
+
+func (c *typeChecker) check(t reflect.Type, s *schema.Schema, path string) {
+	if t.Kind() == reflect.Interface || s.LogicalType != "" || c.visited[typeCheck{t, s}] {
+		return
+	}
+	c.visited[typeCheck{t, s}] = true
+	if reflect.PtrTo(t).Implements(customUnmarshalerType) {
+		return
+	}
+
+	if s.Type == schema.Union {
+		c.checkUnion(t, s, path)
+		return
+	}
+	if t.Kind() == reflect.Ptr {
+		// the pointers are encoded as unions
+		c.mismatch(path, s, t, ErrIncompatibleType)
+		return
+	}
+
+	switch s.Type {
+	case schema.Record, schema.Error:
+		switch {
+		case t.Kind() == reflect.Struct:
+			c.checkRecord(t, s, path)
+		case t.Kind() != reflect.Map || t.Key().Kind() != reflect.String:
+			c.mismatch(path, s, t, ErrIncompatibleType)
+		}
+	case schema.Array:
+		if t.Kind() != reflect.Slice {
+			c.mismatch(path, s, t, ErrIncompatibleType)
+			return
+		}
+		c.check(t.Elem(), s.Items, path+"[]")
+	case schema.Map:
+		if t.Kind() != reflect.Map || t.Key().Kind() != reflect.String {
+			c.mismatch(path, s, t, ErrIncompatibleType)
+			return
+		}
+		c.check(t.Elem(), s.Values, path+"[]")
+	case schema.Enum:
+		if t.Kind() != reflect.String {
+			c.mismatch(path, s, t, ErrIncompatibleType)
+			return
+		}
+		if name, ok := avroName(t); ok && !s.HasName(name) {
+			c.mismatch(path, s, t, ErrEnumMismatch)
+		}
+	default:
+		if !primitiveCompatible(t, s.Type) {
+			c.mismatch(path, s, t, ErrIncompatibleType)
+		}
+	}
+}
+
+// checkUnion checks the types encoded as unions: the pointers, whose pointed type names the branch,
+// and the explicit unions given as map[string]interface{}
+func (c *typeChecker) checkUnion(t reflect.Type, s *schema.Schema, path string) {
+	if t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.Interface {
+		return
+	}
+	if t.Kind() != reflect.Ptr {
+		c.mismatch(path, s, t, ErrIncompatibleType)
+		return
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Interface {
+		return
+	}
+	name, ok := avroName(elem)
+	if !ok {
+		name = c.codec.encodeTypeName(elem.Name())
+	}
+	if !isAvroBaseType(name) && !strings.Contains(name, ".") {
+		name = c.codec.addNamespace(name)
+	}
+	for _, branch := range s.Branches {
+		if branch.BranchName() == name {
+			c.check(elem, branch, path)
+			return
+		}
+	}
+	c.mismatch(path, s, t, ErrUnmatchedBranch)
+}
+
+func (c *typeChecker) checkRecord(t reflect.Type, s *schema.Schema, path string) {
+	fields := fieldsOf(t)
+	if fields.err != nil {
+		c.mismatch(path, s, t, fields.err)
+	}
+	for _, field := range fields.fields {
+		if s.Field(field.name) == nil {
+			c.mismatch(fieldPath(path, field.name), s, field.field.Type, ErrExtraField)
+		}
+	}
+	for _, f := range s.Fields {
+		i, ok := fields.byName[f.Name]
+		if !ok {
+			if !f.HasDefault {
+				c.mismatch(fieldPath(path, f.Name), f.Type, nil, ErrMissingField)
+			}
+			continue
+		}
+		field := fields.fields[i]
+		if field.omitEmpty && !field.defaultValue.IsValid() && !f.HasDefault {
+			c.mismatch(fieldPath(path, f.Name), f.Type, field.field.Type, ErrNoDefault)
+		}
+		c.check(field.field.Type, f.Type, fieldPath(path, f.Name))
+	}
+}
+
+// avroName returns the name given by a TypeNamer type
+func avroName(t reflect.Type) (string, bool) {
+	if namer, ok := reflect.New(t).Interface().(TypeNamer); ok {
+		return namer.AvroName(), true
+	}
+	return "", false
+}
+
+// primitiveCompatible tells if the values of a Go type are encoded by goavro as the primitive type
+func primitiveCompatible(t reflect.Type, avroType schema.Type) bool {
+	kind := t.Kind()
+	switch avroType {
+	case schema.Null:
+		return false
+	case schema.Boolean:
+		return kind == reflect.Bool
+	case schema.Int, schema.Long, schema.Float, schema.Double:
+		// the numbers are converted by goavro, checking their precision at runtime
+		switch kind {
+		case reflect.Int, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	case schema.String, schema.Bytes, schema.Fixed:
+		return kind == reflect.String || (kind == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+	}
+	return false
+}
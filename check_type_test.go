@@ -0,0 +1,130 @@
+package avro
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const checkSchema = `{"type": "record", "name": "Shipment", "namespace": "test", "fields": [
+	{"name": "id", "type": "long"},
+	{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["SENT", "RECEIVED"]}},
+	{"name": "parcels", "type": {"type": "array", "items": {"type": "record", "name": "Parcel", "fields": [
+		{"name": "weight", "type": "double"}
+	]}}},
+	{"name": "tags", "type": {"type": "map", "values": "string"}},
+	{"name": "carrier", "type": ["null", {"type": "record", "name": "carrier", "fields": [
+		{"name": "name", "type": "string"}
+	]}], "default": null},
+	{"name": "note", "type": "string", "default": ""}
+]}`
+
+type Status string
+
+func (Status) AvroName() string { return "test.Status" }
+
+type State string
+
+func (State) AvroName() string { return "test.State" }
+
+type Parcel struct {
+	Weight float64 `avro:"weight"`
+}
+
+type Carrier struct {
+	Name string `avro:"name"`
+}
+
+type Courier struct {
+	Name string `avro:"name"`
+}
+
+type shipment struct {
+	ID      int64             `avro:"id"`
+	Status  Status            `avro:"status"`
+	Parcels []Parcel          `avro:"parcels"`
+	Tags    map[string]string `avro:"tags"`
+	Carrier *Carrier          `avro:"carrier"`
+	Ignored string            `avro:"-"`
+}
+
+type driftedShipment struct {
+	ID      uint8             `avro:"id"`
+	Status  State             `avro:"status"`
+	Parcels []Parcel          `avro:"parcels"`
+	Tags    map[string]string `avro:"tags"`
+	Carrier *Courier          `avro:"carrier"`
+	Email   string            `avro:"email"`
+}
+
+func mismatches(t *testing.T, err error) map[string]error {
+	var typeErr *TypeError
+	require.True(t, errors.As(err, &typeErr), "%v is not a TypeError", err)
+	byPath := make(map[string]error)
+	for _, field := range typeErr.Fields {
+		byPath[field.Path] = field.Err
+	}
+	return byPath
+}
+
+func TestCodec_CheckType(t *testing.T) {
+	codec, err := NewCodec(checkSchema)
+	require.NoError(t, err)
+
+	require.NoError(t, codec.CheckType(reflect.TypeOf(shipment{})))
+	require.NoError(t, codec.CheckType(reflect.TypeOf(&shipment{})))
+	require.NoError(t, codec.CheckType(reflect.TypeOf(map[string]interface{}{})))
+
+	err = codec.CheckType(reflect.TypeOf(driftedShipment{}))
+	byPath := mismatches(t, err)
+	assert.Len(t, byPath, 4)
+	assert.True(t, errors.Is(byPath["id"], ErrIncompatibleType))
+	assert.True(t, errors.Is(byPath["status"], ErrEnumMismatch))
+	assert.True(t, errors.Is(byPath["carrier"], ErrUnmatchedBranch))
+	assert.True(t, errors.Is(byPath["email"], ErrExtraField))
+	assert.Contains(t, err.Error(), "field id (Go type uint8, avro type long)")
+
+	err = codec.CheckType(reflect.TypeOf(struct {
+		ID      int64 `avro:"id"`
+		Parcels []struct {
+			Weight string `avro:"weight"`
+		} `avro:"parcels"`
+		Tags [2]string `avro:"tags"`
+	}{}))
+	byPath = mismatches(t, err)
+	assert.Len(t, byPath, 3)
+	assert.True(t, errors.Is(byPath["status"], ErrMissingField))
+	assert.True(t, errors.Is(byPath["parcels[].weight"], ErrIncompatibleType))
+	assert.True(t, errors.Is(byPath["tags"], ErrIncompatibleType))
+}
+
+func TestCodecRegistry_CheckType(t *testing.T) {
+	codec := NewMockCodecRegistry("test-shipment")
+	require.NoError(t, codec.initAndRegister(checkSchema))
+
+	require.NoError(t, codec.CheckType(reflect.TypeOf(&shipment{})))
+	err := codec.CheckType(reflect.TypeOf(driftedShipment{}))
+	assert.True(t, errors.Is(mismatches(t, err)["email"], ErrExtraField))
+}
+
+func TestCodec_CheckType_unwalkable_schema(t *testing.T) {
+	// goavro accepts the nested record redefining the name of its parent, avrocado can't walk it
+	codec, err := NewCodec(`{"type": "record", "name": "a.r", "fields": [
+		{"name": "x", "type": {"type": "record", "name": "r", "fields": []}}
+	]}`)
+	require.NoError(t, err)
+
+	err = codec.CheckType(reflect.TypeOf(struct{}{}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `type "a.r" is defined twice`)
+
+	// the values are still encoded and decoded through the goavro maps
+	buf, err := codec.Marshal(map[string]interface{}{"x": map[string]interface{}{}})
+	require.NoError(t, err)
+	decoded := make(map[string]interface{})
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{}}, decoded)
+}
@@ -0,0 +1,354 @@
+// Command avrocado queries a schema registry and decodes Confluent framed payloads.
+//
+// Usage:
+//
+//	avrocado [-url URL] <command> [arguments]
+//
+// The URL of the schema registry defaults to $SCHEMA_REGISTRY_URL, or to the local one.
+// The commands are:
+//
+//	subjects                              list the subjects
+//	versions <subject>                    list the versions of a subject
+//	schema -id <id>                       print the schema of an ID
+//	schema <subject> [version]            print a version of a subject (latest by default)
+//	register <subject> <file.avsc>        register a schema and print its ID
+//	check <subject> <file.avsc> [version] check the compatibility of a schema (with the latest version by default)
+//	delete <subject> [version]            delete a subject, or one of its versions
+//	decode [-encoding e] [-file f] [data] print a framed payload as Avro JSON, read from stdin without data nor file
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	avro "github.com/leboncoin/avrocado"
+)
+
+// errIncompatible is returned by the check command so its exit status can be used in scripts
+var errIncompatible = errors.New("the schema is not compatible")
+
+// usages are listed in the order of the help
+var usages = []struct{ name, usage string }{
+	{"subjects", "subjects"},
+	{"versions", "versions <subject>"},
+	{"schema", "schema -id <id> | schema <subject> [version]"},
+	{"register", "register <subject> <file.avsc>"},
+	{"check", "check <subject> <file.avsc> [version]"},
+	{"delete", "delete <subject> [version]"},
+	{"decode", "decode [-encoding hex|base64|binary] [-file path] [data]"},
+}
+
+var commands = map[string]func(c *cli, args []string) error{
+	"subjects": (*cli).subjects,
+	"versions": (*cli).versions,
+	"schema":   (*cli).schema,
+	"register": (*cli).register,
+	"check":    (*cli).check,
+	"delete":   (*cli).delete,
+	"decode":   (*cli).decode,
+}
+
+// usageError returns the usage of a command as an error
+func usageError(name string) error {
+	for _, u := range usages {
+		if u.name == name {
+			return fmt.Errorf("usage: avrocado %s", u.usage)
+		}
+	}
+	return fmt.Errorf("unknown command %q", name)
+}
+
+type cli struct {
+	registry avro.SchemaRegistry
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "avrocado:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("avrocado", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	registryURL := flags.String("url", defaultURL(), "URL of the schema registry")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: avrocado [-url URL] <command> [arguments]")
+		flags.PrintDefaults()
+		fmt.Fprintln(stderr, "Commands:")
+		for _, u := range usages {
+			fmt.Fprintln(stderr, "  "+u.usage)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	command, ok := commands[flags.Arg(0)]
+	if !ok {
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", flags.Arg(0))
+	}
+	registry, err := avro.NewSchemaRegistry(*registryURL)
+	if err != nil {
+		return fmt.Errorf("NewSchemaRegistry error: %w", err)
+	}
+	c := &cli{registry: registry, stdin: stdin, stdout: stdout, stderr: stderr}
+	return command(c, flags.Args()[1:])
+}
+
+func defaultURL() string {
+	if url := os.Getenv("SCHEMA_REGISTRY_URL"); url != "" {
+		return url
+	}
+	return avro.DefaultURL
+}
+
+// parseArgs parses the flags of a command and checks its number of arguments
+func (c *cli) parseArgs(flags *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	flags.SetOutput(c.stderr)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() < min || flags.NArg() > max {
+		return nil, usageError(flags.Name())
+	}
+	return flags.Args(), nil
+}
+
+// parseVersion parses a version number, "latest" designating the latest version
+func parseVersion(args []string, i int) (int, error) {
+	if len(args) <= i || args[i] == "latest" {
+		return -1, nil
+	}
+	version, err := strconv.Atoi(args[i])
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q", args[i])
+	}
+	return version, nil
+}
+
+func (c *cli) subjects(args []string) error {
+	if _, err := c.parseArgs(flag.NewFlagSet("subjects", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+	subjects, err := c.registry.Subjects()
+	if err != nil {
+		return fmt.Errorf("Registry.Subjects error: %w", err)
+	}
+	for _, subject := range subjects {
+		fmt.Fprintln(c.stdout, subject)
+	}
+	return nil
+}
+
+func (c *cli) versions(args []string) error {
+	args, err := c.parseArgs(flag.NewFlagSet("versions", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	versions, err := c.registry.Versions(args[0])
+	if err != nil {
+		return fmt.Errorf("Registry.Versions error for %s: %w", args[0], err)
+	}
+	for _, version := range versions {
+		fmt.Fprintln(c.stdout, version)
+	}
+	return nil
+}
+
+// schema prints the schema of an ID, or the schema, ID and version of a subject as JSON
+func (c *cli) schema(args []string) error {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	id := flags.Int("id", -1, "ID of the schema")
+	args, err := c.parseArgs(flags, args, 0, 2)
+	if err != nil {
+		return err
+	}
+	if *id >= 0 {
+		if len(args) > 0 {
+			return usageError("schema")
+		}
+		schema, err := c.registry.GetSchemaByID(*id)
+		if err != nil {
+			return fmt.Errorf("Registry.GetSchemaByID error for %d: %w", *id, err)
+		}
+		fmt.Fprintln(c.stdout, schema)
+		return nil
+	}
+	if len(args) == 0 {
+		return usageError("schema")
+	}
+	version, err := parseVersion(args, 1)
+	if err != nil {
+		return err
+	}
+	schema, err := c.registry.GetSchemaBySubject(args[0], version)
+	if err != nil {
+		return fmt.Errorf("Registry.GetSchemaBySubject error for %s: %w", args[0], err)
+	}
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(schema)
+}
+
+func (c *cli) register(args []string) error {
+	args, err := c.parseArgs(flag.NewFlagSet("register", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	schema, err := ioutil.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+	id, err := c.registry.RegisterNewSchema(args[0], string(schema))
+	if err != nil {
+		return fmt.Errorf("Registry.RegisterNewSchema error for %s: %w", args[0], err)
+	}
+	fmt.Fprintln(c.stdout, id)
+	return nil
+}
+
+func (c *cli) check(args []string) error {
+	args, err := c.parseArgs(flag.NewFlagSet("check", flag.ContinueOnError), args, 2, 3)
+	if err != nil {
+		return err
+	}
+	checker, ok := c.registry.(avro.CompatibilityChecker)
+	if !ok {
+		return errors.New("the schema registry can't check compatibility")
+	}
+	schema, err := ioutil.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+	version, err := parseVersion(args, 2)
+	if err != nil {
+		return err
+	}
+	isCompatible, err := checker.TestCompatibility(args[0], string(schema), version)
+	if err != nil {
+		return fmt.Errorf("Registry.TestCompatibility error for %s: %w", args[0], err)
+	}
+	if !isCompatible {
+		return errIncompatible
+	}
+	fmt.Fprintln(c.stdout, "compatible")
+	return nil
+}
+
+func (c *cli) delete(args []string) error {
+	args, err := c.parseArgs(flag.NewFlagSet("delete", flag.ContinueOnError), args, 1, 2)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		versions, err := c.registry.DeleteSubject(args[0])
+		if err != nil {
+			return fmt.Errorf("Registry.DeleteSubject error for %s: %w", args[0], err)
+		}
+		for _, version := range versions {
+			fmt.Fprintln(c.stdout, version)
+		}
+		return nil
+	}
+	deleter, ok := c.registry.(avro.VersionDeleter)
+	if !ok {
+		return errors.New("the schema registry can't delete a version")
+	}
+	version, err := parseVersion(args, 1)
+	if err != nil {
+		return err
+	}
+	deleted, err := deleter.DeleteSchemaVersion(args[0], version)
+	if err != nil {
+		return fmt.Errorf("Registry.DeleteSchemaVersion error for %s: %w", args[0], err)
+	}
+	fmt.Fprintln(c.stdout, deleted)
+	return nil
+}
+
+// decode prints a Confluent framed payload as Avro JSON, its schema being resolved from the ID of its header
+func (c *cli) decode(args []string) error {
+	flags := flag.NewFlagSet("decode", flag.ContinueOnError)
+	encoding := flags.String("encoding", "hex", "encoding of the payload: hex, base64 or binary")
+	file := flags.String("file", "", "file to read the payload from")
+	args, err := c.parseArgs(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch {
+	case len(args) == 1 && *file != "":
+		return usageError("decode")
+	case len(args) == 1:
+		data = []byte(args[0])
+	case *file != "":
+		data, err = ioutil.ReadFile(*file)
+	default:
+		data, err = ioutil.ReadAll(c.stdin)
+	}
+	if err != nil {
+		return err
+	}
+	payload, err := decodePayload(*encoding, data)
+	if err != nil {
+		return err
+	}
+
+	header, encoded, err := avro.ParseHeader(payload)
+	if err != nil {
+		return err
+	}
+	codecRegistry, err := avro.NewCodecRegistryWithClient(c.registry, "", "")
+	if err != nil {
+		return err
+	}
+	codec, err := codecRegistry.CodecByID(header.ID)
+	if err != nil {
+		return fmt.Errorf("error when getting codec for schema id %v: %w", header.ID, err)
+	}
+	native, rest, err := codec.NativeFromBinary(encoded)
+	if err != nil {
+		return fmt.Errorf("NativeFromBinary error with schema id %v: %w", header.ID, err)
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("%d bytes remain after the datum", len(rest))
+	}
+	textual, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return fmt.Errorf("TextualFromNative error: %w", err)
+	}
+	fmt.Fprintf(c.stdout, "%s\n", textual)
+	return nil
+}
+
+func decodePayload(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case "binary":
+		return data, nil
+	case "hex":
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	}
+	return nil, fmt.Errorf("unknown encoding %q", encoding)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	avro "github.com/leboncoin/avrocado"
+	"github.com/leboncoin/avrocado/avrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	userV1 = `{"type":"record","name":"user","fields":[{"name":"name","type":"string"}]}`
+	userV2 = `{"type":"record","name":"user","fields":[{"name":"name","type":"string"},{"name":"age","type":"int","default":0}]}`
+	userV3 = `{"type":"record","name":"user","fields":[{"name":"name","type":"int"}]}`
+)
+
+func runCommand(t *testing.T, server *avrotest.Server, stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := run(append([]string{"-url", server.URL}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func writeSchema(t *testing.T, dir, name, schema string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(schema), 0644))
+	return path
+}
+
+func TestRun_registry(t *testing.T) {
+	server := avrotest.NewServer()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "avrocado")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	out, err := runCommand(t, server, "", "register", "users-value", writeSchema(t, dir, "v1.avsc", userV1))
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", out)
+
+	out, err = runCommand(t, server, "", "check", "users-value", writeSchema(t, dir, "v2.avsc", userV2))
+	require.NoError(t, err)
+	assert.Equal(t, "compatible\n", out)
+	_, err = runCommand(t, server, "", "check", "users-value", writeSchema(t, dir, "v3.avsc", userV3), "1")
+	assert.Equal(t, errIncompatible, err)
+
+	_, err = runCommand(t, server, "", "register", "users-value", filepath.Join(dir, "v2.avsc"))
+	require.NoError(t, err)
+	out, err = runCommand(t, server, "", "subjects")
+	require.NoError(t, err)
+	assert.Equal(t, "users-value\n", out)
+	out, err = runCommand(t, server, "", "versions", "users-value")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n2\n", out)
+
+	out, err = runCommand(t, server, "", "schema", "-id", "1")
+	require.NoError(t, err)
+	assert.Equal(t, userV1+"\n", out)
+	out, err = runCommand(t, server, "", "schema", "users-value")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"version": 2`)
+	assert.Contains(t, out, `"id": 2`)
+	_, err = runCommand(t, server, "", "schema", "users-value", "3")
+	assert.Error(t, err)
+
+	out, err = runCommand(t, server, "", "delete", "users-value", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "2\n", out)
+	out, err = runCommand(t, server, "", "delete", "users-value")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", out)
+	out, err = runCommand(t, server, "", "subjects")
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+}
+
+func TestRun_decode(t *testing.T) {
+	server := avrotest.NewServer()
+	defer server.Close()
+	codecRegistry, err := avro.NewCodecRegistryAndRegister(server.URL, "users-value", userV2)
+	require.NoError(t, err)
+	type user struct {
+		Name string `avro:"name"`
+		Age  int32  `avro:"age"`
+	}
+	payload, err := codecRegistry.Marshal(&user{Name: "john", Age: 42})
+	require.NoError(t, err)
+	expected := `{"name":"john","age":42}`
+
+	out, err := runCommand(t, server, "", "decode", hex.EncodeToString(payload))
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, out)
+
+	out, err = runCommand(t, server, base64.StdEncoding.EncodeToString(payload)+"\n", "decode", "-encoding", "base64")
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, out)
+
+	dir, err := ioutil.TempDir("", "avrocado")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "payload.bin")
+	require.NoError(t, ioutil.WriteFile(file, payload, 0644))
+	out, err = runCommand(t, server, "", "decode", "-encoding", "binary", "-file", file)
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, out)
+
+	_, err = runCommand(t, server, "", "decode", hex.EncodeToString(append(payload, 0)))
+	assert.Error(t, err, "trailing bytes are reported")
+	_, err = runCommand(t, server, "", "decode", "01000000")
+	assert.Error(t, err)
+	_, err = runCommand(t, server, "", "decode", "000000")
+	assert.True(t, errors.Is(err, avro.ErrShortPayload), "%v", err)
+}
+
+func TestRun_usage(t *testing.T) {
+	server := avrotest.NewServer()
+	defer server.Close()
+
+	_, err := runCommand(t, server, "", "unknown")
+	assert.EqualError(t, err, `unknown command "unknown"`)
+	_, err = runCommand(t, server, "", "versions")
+	assert.EqualError(t, err, "usage: avrocado versions <subject>")
+	_, err = runCommand(t, server, "", "schema", "-id", "1", "users-value")
+	assert.EqualError(t, err, "usage: avrocado schema -id <id> | schema <subject> [version]")
+}
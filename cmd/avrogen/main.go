@@ -0,0 +1,88 @@
+// Command avrogen generates Go types from avro schemas, read from .avsc files or from a schema registry.
+//
+// Usage:
+//
+//	avrogen [-package name] [-o file.go] [-url URL -subject subject [-version version]] [file.avsc ...]
+//
+// The generated code is written on the standard output unless -o is given.
+// See the package github.com/leboncoin/avrocado/avrogen for the generated types.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	avro "github.com/leboncoin/avrocado"
+	"github.com/leboncoin/avrocado/avrogen"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "avrogen:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("avrogen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	pkg := flags.String("package", "main", "name of the package of the generated code")
+	output := flags.String("o", "", "file to write the generated code to")
+	registryURL := flags.String("url", "", "URL of the schema registry to read the subject from")
+	subject := flags.String("subject", "", "subject of the schema registry to generate")
+	version := flags.Int("version", -1, "version of the subject, the latest one by default")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: avrogen [-package name] [-o file.go] [-url URL -subject subject [-version version]] [file.avsc ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 && *subject == "" {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	generator := avrogen.NewGenerator(*pkg)
+	for _, path := range flags.Args() {
+		spec, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := generator.AddSchema(string(spec)); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if *subject != "" {
+		if *registryURL == "" {
+			return errors.New("the -url of the schema registry is required with -subject")
+		}
+		registry, err := avro.NewSchemaRegistry(*registryURL)
+		if err != nil {
+			return fmt.Errorf("NewSchemaRegistry error: %w", err)
+		}
+		schema, err := registry.GetSchemaBySubject(*subject, *version)
+		if err != nil {
+			return fmt.Errorf("Registry.GetSchemaBySubject error for %s: %w", *subject, err)
+		}
+		if err := generator.AddSchema(schema.Schema); err != nil {
+			return fmt.Errorf("%s: %w", *subject, err)
+		}
+	}
+
+	code, err := generator.Generate()
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = stdout.Write(code)
+		return err
+	}
+	return ioutil.WriteFile(*output, code, 0644)
+}
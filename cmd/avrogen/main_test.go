@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/leboncoin/avrocado/avrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userSchema = `{"type":"record","name":"user","namespace":"com.example","fields":[{"name":"user_id","type":"long"}]}`
+
+func TestRun_files(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avrogen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	schemaPath := filepath.Join(dir, "user.avsc")
+	require.NoError(t, ioutil.WriteFile(schemaPath, []byte(userSchema), 0644))
+	output := filepath.Join(dir, "user.go")
+
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, run([]string{"-package", "users", "-o", output, schemaPath}, &stdout, &stderr))
+	code, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "package users")
+	assert.Contains(t, string(code), "UserID int64 `avro:\"user_id\"`")
+	assert.Empty(t, stdout.String())
+
+	assert.Error(t, run([]string{filepath.Join(dir, "missing.avsc")}, &stdout, &stderr))
+}
+
+func TestRun_registry(t *testing.T) {
+	server := avrotest.NewServer()
+	defer server.Close()
+	_, err := server.Handler.Registry.RegisterNewSchema("users-value", userSchema)
+	require.NoError(t, err)
+
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, run([]string{"-url", server.URL, "-subject", "users-value"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "package main")
+	assert.Contains(t, stdout.String(), "const UserSchema = `"+userSchema+"`")
+
+	assert.Error(t, run([]string{"-subject", "users-value"}, &stdout, &stderr), "the URL is required")
+	assert.Error(t, run([]string{"-url", server.URL, "-subject", "unknown"}, &stdout, &stderr))
+}
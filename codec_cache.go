@@ -0,0 +1,219 @@
+package avro
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CodecCache stores the codecs discovered while decoding, by schema ID.
+// Implementations must be safe for concurrent use.
+type CodecCache interface {
+	Get(id SchemaID) (*Codec, bool)
+	Add(id SchemaID, codec *Codec)
+	// Range calls fn on every cached codec
+	Range(fn func(id SchemaID, codec *Codec))
+}
+
+// CacheOptions configures the decoding cache of a CodecRegistry
+type CacheOptions struct {
+	// MaxEntries bounds the number of cached codecs, the least recently used ones being evicted first.
+	// 0 means no limit.
+	MaxEntries int
+	// TTL is the lifetime of a cached codec, 0 means they never expire
+	TTL time.Duration
+	// NotFoundTTL is the time during which an ID unknown to the schema registry is not looked up again.
+	// It doubles at each new miss of the same ID, up to MaxNotFoundTTL. 0 disables the negative caching.
+	NotFoundTTL    time.Duration
+	MaxNotFoundTTL time.Duration
+}
+
+type lruEntry struct {
+	id      SchemaID
+	codec   *Codec
+	expires time.Time
+}
+
+// lruCodecCache is a CodecCache bounded in size and in time
+type lruCodecCache struct {
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	lock    sync.Mutex
+	entries map[SchemaID]*list.Element
+	order   *list.List
+}
+
+// NewCodecCache returns a least recently used CodecCache holding at most maxEntries codecs (0 for no limit)
+// for at most ttl (0 for no expiration)
+func NewCodecCache(maxEntries int, ttl time.Duration) CodecCache {
+	return &lruCodecCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		entries:    make(map[SchemaID]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *lruCodecCache) Get(id SchemaID) (*Codec, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if c.ttl > 0 && c.now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.codec, true
+}
+
+func (c *lruCodecCache) Add(id SchemaID, codec *Codec) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := &lruEntry{id: id, codec: codec, expires: c.now().Add(c.ttl)}
+	if elem, ok := c.entries[id]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[id] = c.order.PushFront(entry)
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).id)
+	}
+}
+
+func (c *lruCodecCache) Range(fn func(id SchemaID, codec *Codec)) {
+	c.lock.Lock()
+	entries := make([]*lruEntry, 0, c.order.Len())
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		entries = append(entries, elem.Value.(*lruEntry))
+	}
+	c.lock.Unlock()
+	for _, entry := range entries {
+		fn(entry.id, entry.codec)
+	}
+}
+
+// codecCall is a lookup in progress, shared by all the goroutines asking for the same ID
+type codecCall struct {
+	done  chan struct{}
+	codec *Codec
+	err   error
+}
+
+// maxNotFoundEntries bounds the number of IDs remembered as unknown to the schema registry
+const maxNotFoundEntries = 1024
+
+// errLookupPanicked is the error of the callers waiting for a lookup which panicked
+var errLookupPanicked = errors.New("the lookup of the schema ID panicked")
+
+type notFoundEntry struct {
+	until   time.Time
+	backoff time.Duration
+	err     error
+}
+
+// codecLoader deduplicates the concurrent lookups of a schema ID and remembers the IDs
+// unknown to the schema registry
+type codecLoader struct {
+	notFoundTTL    time.Duration
+	maxNotFoundTTL time.Duration
+	now            func() time.Time
+
+	lock     sync.Mutex
+	calls    map[SchemaID]*codecCall
+	notFound map[SchemaID]notFoundEntry
+}
+
+// load calls fetch once for all the concurrent callers asking for the same ID.
+// No lock is held during fetch.
+func (l *codecLoader) load(id SchemaID, fetch func() (*Codec, error)) (*Codec, error) {
+	l.lock.Lock()
+	if l.calls == nil {
+		l.calls = make(map[SchemaID]*codecCall)
+	}
+	if l.notFound == nil {
+		l.notFound = make(map[SchemaID]notFoundEntry)
+	}
+	if l.now == nil {
+		l.now = time.Now
+	}
+	if entry, ok := l.notFound[id]; ok && l.now().Before(entry.until) {
+		l.lock.Unlock()
+		return nil, entry.err
+	}
+	if call, ok := l.calls[id]; ok {
+		l.lock.Unlock()
+		<-call.done
+		return call.codec, call.err
+	}
+	call := &codecCall{done: make(chan struct{}), err: errLookupPanicked}
+	l.calls[id] = call
+	l.lock.Unlock()
+
+	// the call is released even if fetch panics
+	defer l.release(id, call)
+	call.codec, call.err = fetch()
+	return call.codec, call.err
+}
+
+// release ends a lookup, remembering the IDs unknown to the schema registry, and wakes up its waiters
+func (l *codecLoader) release(id SchemaID, call *codecCall) {
+	l.lock.Lock()
+	delete(l.calls, id)
+	switch {
+	case call.err == nil:
+		delete(l.notFound, id)
+	case l.notFoundTTL > 0 && isNotFound(call.err):
+		backoff := l.notFoundTTL
+		if previous, ok := l.notFound[id]; ok {
+			backoff = previous.backoff * 2
+		} else {
+			l.pruneNotFound()
+		}
+		if l.maxNotFoundTTL > 0 && backoff > l.maxNotFoundTTL {
+			backoff = l.maxNotFoundTTL
+		}
+		l.notFound[id] = notFoundEntry{until: l.now().Add(backoff), backoff: backoff, err: call.err}
+	}
+	l.lock.Unlock()
+	close(call.done)
+}
+
+// pruneNotFound makes room for a new unknown ID. The backoff of an ID is forgotten once it has not been
+// looked up for another backoff after its expiration, and the entries expiring first are evicted
+// when maxNotFoundEntries is reached. The lock must be held.
+func (l *codecLoader) pruneNotFound() {
+	now := l.now()
+	for id, entry := range l.notFound {
+		if now.After(entry.until.Add(entry.backoff)) {
+			delete(l.notFound, id)
+		}
+	}
+	for len(l.notFound) >= maxNotFoundEntries {
+		var oldest SchemaID
+		var oldestUntil time.Time
+		for id, entry := range l.notFound {
+			if oldestUntil.IsZero() || entry.until.Before(oldestUntil) {
+				oldest, oldestUntil = id, entry.until
+			}
+		}
+		delete(l.notFound, oldest)
+	}
+}
+
+// isNotFound tells if the error is the schema registry answer to an unknown subject or schema
+func isNotFound(err error) bool {
+	var notFound NotFoundError
+	return errors.As(err, &notFound) && notFound.NotFound()
+}
@@ -0,0 +1,181 @@
+package avro
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecCache_LRU(t *testing.T) {
+	cache := NewCodecCache(2, 0)
+	one, two, three := &Codec{}, &Codec{}, &Codec{}
+
+	cache.Add(1, one)
+	cache.Add(2, two)
+	_, ok := cache.Get(1)
+	require.True(t, ok)
+	cache.Add(3, three)
+
+	_, ok = cache.Get(2)
+	assert.False(t, ok, "the least recently used codec is evicted")
+	codec, ok := cache.Get(1)
+	assert.True(t, ok)
+	assert.True(t, codec == one)
+	_, ok = cache.Get(3)
+	assert.True(t, ok)
+
+	var ids []SchemaID
+	cache.Range(func(id SchemaID, _ *Codec) { ids = append(ids, id) })
+	assert.ElementsMatch(t, []SchemaID{1, 3}, ids)
+}
+
+func TestCodecCache_TTL(t *testing.T) {
+	now := time.Now()
+	cache := NewCodecCache(0, time.Minute).(*lruCodecCache)
+	cache.now = func() time.Time { return now }
+
+	cache.Add(1, &Codec{})
+	_, ok := cache.Get(1)
+	assert.True(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.Get(1)
+	assert.False(t, ok)
+}
+
+func TestCodecRegistry_getCodecByID_deduplicates_lookups(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	registry := &mockSchemaRegistry{
+		GetSchemaByIDFn: func(id int) (string, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return `"string"`, nil
+		},
+	}
+	codec := &CodecRegistry{codecByID: make(map[SchemaID]*Codec), Registry: registry}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := codec.getCodecByID(42)
+			assert.NoError(t, err)
+			assert.NotNil(t, c)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	_, err := codec.getCodecByID(42)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "the codec is cached")
+}
+
+func TestCodecRegistry_getCodecByID_not_found_backoff(t *testing.T) {
+	var calls int
+	registry := &mockSchemaRegistry{
+		GetSchemaByIDFn: func(id int) (string, error) {
+			calls++
+			if id == 1 {
+				return "", fmt.Errorf("unreachable registry")
+			}
+			return "", ConfluentError{ErrorCodeSchemaNotFound, "Schema not found"}
+		},
+	}
+	codec := &CodecRegistry{codecByID: make(map[SchemaID]*Codec), Registry: registry}
+	codec.SetCacheOptions(CacheOptions{NotFoundTTL: time.Minute, MaxNotFoundTTL: 3 * time.Minute})
+	now := time.Now()
+	codec.loader.now = func() time.Time { return now }
+
+	_, err := codec.getCodecByID(2)
+	assert.Error(t, err)
+	_, err = codec.getCodecByID(2)
+	assert.True(t, isNotFound(err))
+	assert.Equal(t, 1, calls, "the missing ID is not looked up again")
+
+	now = now.Add(61 * time.Second)
+	_, err = codec.getCodecByID(2)
+	assert.Error(t, err)
+	assert.Equal(t, 2, calls)
+
+	now = now.Add(61 * time.Second)
+	_, err = codec.getCodecByID(2)
+	assert.Error(t, err)
+	assert.Equal(t, 2, calls, "the backoff doubled")
+
+	// Other errors are not cached
+	_, err = codec.getCodecByID(1)
+	assert.Error(t, err)
+	_, err = codec.getCodecByID(1)
+	assert.Error(t, err)
+	assert.Equal(t, 4, calls)
+}
+
+func TestCodecLoader_prunes_not_found(t *testing.T) {
+	now := time.Now()
+	loader := &codecLoader{notFoundTTL: time.Minute, now: func() time.Time { return now }}
+	notFound := func() (*Codec, error) {
+		return nil, ConfluentError{ErrorCodeSchemaNotFound, "Schema not found"}
+	}
+
+	for id := SchemaID(0); id < maxNotFoundEntries+10; id++ {
+		_, err := loader.load(id, notFound)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, maxNotFoundEntries, len(loader.notFound), "the unknown IDs are bounded")
+
+	// the IDs not looked up again are forgotten
+	now = now.Add(3 * time.Minute)
+	_, err := loader.load(-1, notFound)
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(loader.notFound))
+}
+
+func TestCodecLoader_panic(t *testing.T) {
+	loader := &codecLoader{}
+	started := make(chan struct{})
+	waiter := make(chan error)
+	go func() {
+		<-started
+		_, err := loader.load(1, func() (*Codec, error) { return &Codec{}, nil })
+		waiter <- err
+	}()
+
+	assert.Panics(t, func() {
+		_, _ = loader.load(1, func() (*Codec, error) {
+			close(started)
+			time.Sleep(10 * time.Millisecond)
+			panic("boom")
+		})
+	}, "the panic reaches the caller")
+	assert.Equal(t, errLookupPanicked, <-waiter)
+
+	codec, err := loader.load(1, func() (*Codec, error) { return &Codec{}, nil })
+	require.NoError(t, err, "the failed lookup is cleaned up")
+	assert.NotNil(t, codec)
+}
+
+// missingSchema is the error of a schema registry implementing NotFoundError
+type missingSchema struct{}
+
+func (missingSchema) Error() string  { return "missing schema" }
+func (missingSchema) NotFound() bool { return true }
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(ConfluentError{ErrorCodeSubjectNotFound, "Subject not found"}))
+	assert.False(t, isNotFound(ConfluentError{ErrorCodeInvalidSchema, "Invalid schema"}))
+	assert.True(t, isNotFound(ApicurioError{ErrorCode: http.StatusNotFound}))
+	assert.False(t, isNotFound(ApicurioError{ErrorCode: http.StatusConflict}))
+	assert.True(t, isNotFound(fmt.Errorf("GetSchemaByID error: %w", missingSchema{})))
+	assert.False(t, isNotFound(fmt.Errorf("unreachable registry")))
+}
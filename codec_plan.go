@@ -0,0 +1,1301 @@
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/leboncoin/avrocado/internal/schema"
+	"github.com/linkedin/goavro/v2"
+)
+
+// The compiled plans encode structs to avro binary and decode avro binary to structs without building
+// the intermediate map[string]interface{} of the map based path (structs, goavro and mapstructure).
+// They produce the same bytes and the same values as the map based path: the constructs they don't
+// handle are detected when compiling and go through the map based path, and so do the values failing
+// at runtime, for the map based path to give its own error.
+
+var (
+	// errUnsupported is returned when compiling a plan for a construct handled by the map based path only
+	errUnsupported = errors.New("unsupported by the compiled plans")
+	// errFallback is returned by a compiled plan when the value must go through the map based path
+	errFallback = errors.New("fallback to the map based path")
+
+	bytesType             = reflect.TypeOf([]byte(nil))
+	stringType            = reflect.TypeOf("")
+	typeNamerType         = reflect.TypeOf((*TypeNamer)(nil)).Elem()
+	customUnmarshalerType = reflect.TypeOf((*CustomUnmarshaler)(nil)).Elem()
+)
+
+type encodeFunc func(buf []byte, v reflect.Value) ([]byte, error)
+type decodeFunc func(buf []byte, v reflect.Value) ([]byte, error)
+
+// typePlans caches the plans compiled for the Go types encoded and decoded by a codec.
+// A nil plan means that the type goes through the map based path.
+// The encoders name the union branches with the TypeNameEncoder of the codec: SetTypeNameEncoder
+// gives the codec new plans.
+type typePlans struct {
+	encoders sync.Map // reflect.Type -> *encoderPlan
+	decoders sync.Map // reflect.Type -> decodeFunc
+}
+
+// encoderPlan is compiled with the namespace naming the union branches
+type encoderPlan struct {
+	namespace string
+	encode    encodeFunc
+}
+
+// fastMarshal appends the encoding of a struct, or of a pointer to a struct, with its compiled plan.
+// It returns false when the value must go through the map based path.
+func (c *Codec) fastMarshal(buf []byte, data interface{}) ([]byte, bool) {
+	if c.plans == nil || c.parsed == nil || c.TypeNameEncoder == nil {
+		return nil, false
+	}
+	value := reflect.ValueOf(data)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, false
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, false
+	}
+	plan := c.encoderPlan(value.Type())
+	if plan.encode == nil {
+		return nil, false
+	}
+	out, err := plan.encode(buf, value)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// fastUnmarshal decodes into a pointer to a struct with its compiled plan, and returns the bytes following the datum.
+// It returns false when the output must go through the map based path, in which case it may have been partially set.
+func (c *Codec) fastUnmarshal(buf []byte, output interface{}) ([]byte, bool) {
+	if c.plans == nil || c.parsed == nil {
+		return nil, false
+	}
+	value := reflect.ValueOf(output)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	decode := c.decoderPlan(value.Type().Elem())
+	if decode == nil {
+		return nil, false
+	}
+	rest, err := decode(buf, value.Elem())
+	if err != nil {
+		return nil, false
+	}
+	return rest, true
+}
+
+func (c *Codec) encoderPlan(t reflect.Type) *encoderPlan {
+	if cached, ok := c.plans.encoders.Load(t); ok {
+		plan := cached.(*encoderPlan)
+		if plan.namespace == c.Namespace {
+			return plan
+		}
+	}
+	plan := &encoderPlan{namespace: c.Namespace}
+	plan.encode, _ = newPlanCompiler(c).encoder(t, c.parsed, hookedMode)
+	c.plans.encoders.Store(t, plan)
+	return plan
+}
+
+func (c *Codec) decoderPlan(t reflect.Type) decodeFunc {
+	if cached, ok := c.plans.decoders.Load(t); ok {
+		return cached.(decodeFunc)
+	}
+	decode, _ := newPlanCompiler(c).decoder(t, c.parsed)
+	c.plans.decoders.Store(t, decode)
+	return decode
+}
+
+// encodeMode tells how the map based path converts a value before handing it to goavro
+type encodeMode int
+
+const (
+	// hookedMode values are converted by encodeUnionHook
+	hookedMode encodeMode = iota
+	// fieldMode values are struct fields, converted by structs with encodeUnionHook
+	fieldMode
+	// rawMode values are handed unconverted to goavro
+	rawMode
+)
+
+type planKey struct {
+	t reflect.Type
+	s *schema.Schema
+}
+
+// planCompiler compiles the plans of a type, the records being shared to handle recursive types
+type planCompiler struct {
+	codec          *Codec
+	recordEncoders map[planKey]*recordEncoder
+	recordDecoders map[planKey]*recordDecoder
+}
+
+func newPlanCompiler(c *Codec) *planCompiler {
+	return &planCompiler{
+		codec:          c,
+		recordEncoders: make(map[planKey]*recordEncoder),
+		recordDecoders: make(map[planKey]*recordDecoder),
+	}
+}
+
+func (p *planCompiler) encoder(t reflect.Type, s *schema.Schema, mode encodeMode) (encodeFunc, error) {
+	if s.LogicalType != "" {
+		return nil, errUnsupported
+	}
+	if mode == rawMode {
+		return p.rawEncoder(t, s)
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return p.unionEncoder(t, s)
+	case reflect.Struct:
+		return p.recordEncoder(t, s)
+	case reflect.Slice:
+		if s.Type != schema.Array {
+			if t.Elem().Kind() != reflect.Uint8 {
+				return nil, errUnsupported
+			}
+			return bytesEncoder(s)
+		}
+		items, err := p.encoder(t.Elem(), s.Items, hookedMode)
+		if err != nil {
+			return nil, err
+		}
+		return arrayEncoder(items), nil
+	case reflect.Map:
+		// structs only converts the maps of structs held by struct fields, the other maps are handed as is
+		if mode != fieldMode || !iteratedByStructs(t) {
+			return p.rawEncoder(t, s)
+		}
+		if s.Type != schema.Map || t.Key().Kind() != reflect.String {
+			return nil, errUnsupported
+		}
+		values, err := p.encoder(t.Elem(), s.Values, fieldMode)
+		if err != nil {
+			return nil, err
+		}
+		return mapEncoder(values), nil
+	}
+	return primitiveEncoder(t.Kind(), s)
+}
+
+// iteratedByStructs tells if structs converts the values of a map: structs, pointers to structs and slices of structs
+func iteratedByStructs(t reflect.Type) bool {
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct || (elem.Kind() == reflect.Slice && elem.Elem().Kind() == reflect.Struct)
+}
+
+// rawEncoder encodes the values accepted as is by goavro, which checks their exact type
+func (p *planCompiler) rawEncoder(t reflect.Type, s *schema.Schema) (encodeFunc, error) {
+	if s.LogicalType != "" {
+		return nil, errUnsupported
+	}
+	switch s.Type {
+	case schema.Array:
+		if t.Kind() != reflect.Slice {
+			return nil, errUnsupported
+		}
+		items, err := p.rawEncoder(t.Elem(), s.Items)
+		if err != nil {
+			return nil, err
+		}
+		return arrayEncoder(items), nil
+	case schema.Map:
+		if t.Kind() != reflect.Map || t.Key() != stringType {
+			return nil, errUnsupported
+		}
+		values, err := p.rawEncoder(t.Elem(), s.Values)
+		if err != nil {
+			return nil, err
+		}
+		return mapEncoder(values), nil
+	}
+	if t == bytesType {
+		return bytesEncoder(s)
+	}
+	// only the predeclared types are accepted
+	if t.Name() == "" || t.PkgPath() != "" {
+		return nil, errUnsupported
+	}
+	return primitiveEncoder(t.Kind(), s)
+}
+
+type recordField struct {
+	index  int
+	encode encodeFunc
+	// defaultValue is the encoded default of the schema fields missing from the struct,
+	// and of the empty fields omitted by the omitempty tag option
+	defaultValue []byte
+	// omitEmpty tells that the empty field is replaced by the default value, if the schema field has one
+	omitEmpty  bool
+	hasDefault bool
+}
+
+type recordEncoder struct {
+	fields []recordField
+}
+
+func (p *planCompiler) recordEncoder(t reflect.Type, s *schema.Schema) (encodeFunc, error) {
+	if fields := fieldsOf(t); !s.IsRecord() || fields.inlined || fields.err != nil {
+		// the fields promoted from the inlined structs go through the map based path
+		return nil, errUnsupported
+	}
+	key := planKey{t, s}
+	if record, ok := p.recordEncoders[key]; ok {
+		return record.encode, nil
+	}
+	record := &recordEncoder{}
+	p.recordEncoders[key] = record
+
+	// the keys of the map built by structs, the last field winning
+	indexes := make(map[string]int)
+	duplicated := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, ok := fieldName(field)
+		if !ok {
+			return nil, errUnsupported
+		}
+		if name == "-" {
+			continue
+		}
+		if _, exists := indexes[name]; exists {
+			duplicated[name] = true
+		}
+		indexes[name] = i
+	}
+
+	for _, f := range s.Fields {
+		index, ok := indexes[f.Name]
+		if !ok {
+			if !f.HasDefault {
+				return nil, errUnsupported
+			}
+			defaultValue, err := appendDefault(nil, f.Type, f.Default)
+			if err != nil {
+				return nil, err
+			}
+			record.fields = append(record.fields, recordField{index: -1, defaultValue: defaultValue})
+			continue
+		}
+		if duplicated[f.Name] {
+			return nil, errUnsupported
+		}
+		encode, err := p.encoder(t.Field(index).Type, f.Type, fieldMode)
+		if err != nil {
+			return nil, err
+		}
+		field := recordField{index: index, encode: encode}
+		if _, options := fieldTag(t.Field(index)); hasTagOption(options, "omitempty") {
+			field.omitEmpty, field.hasDefault = true, f.HasDefault
+			if f.HasDefault {
+				if field.defaultValue, err = appendDefault(nil, f.Type, f.Default); err != nil {
+					return nil, err
+				}
+			}
+		}
+		record.fields = append(record.fields, field)
+	}
+	return record.encode, nil
+}
+
+func (r *recordEncoder) encode(buf []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for _, f := range r.fields {
+		if f.index < 0 {
+			buf = append(buf, f.defaultValue...)
+			continue
+		}
+		field := v.Field(f.index)
+		if f.omitEmpty && isEmptyValue(field) {
+			if !f.hasDefault {
+				// the map based path gives the error naming the field
+				return nil, errFallback
+			}
+			buf = append(buf, f.defaultValue...)
+			continue
+		}
+		if buf, err = f.encode(buf, field); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// fieldName returns the avro name of a struct field, the tags with options other than omitempty
+// being left to the map based path
+func fieldName(field reflect.StructField) (string, bool) {
+	name, options := fieldTag(field)
+	for _, option := range options {
+		if option != "omitempty" {
+			return "", false
+		}
+	}
+	if name == "" {
+		return field.Name, true
+	}
+	return name, true
+}
+
+type unionEncoder struct {
+	union     *schema.Schema
+	namespace string
+	null      int
+	// index and encode are the branch of the values named by their Go type, -1 when no branch matches
+	index  int
+	encode encodeFunc
+	// named tells that the values implement TypeNamer, their branch being looked up in branches
+	named    bool
+	branches []encodeFunc
+}
+
+// unionEncoder encodes a pointer, nil being null and the pointed value being wrapped in the branch named after its type
+func (p *planCompiler) unionEncoder(t reflect.Type, s *schema.Schema) (encodeFunc, error) {
+	elem := t.Elem()
+	if s.Type != schema.Union || elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface {
+		return nil, errUnsupported
+	}
+	u := &unionEncoder{union: s, namespace: p.codec.Namespace, null: -1, index: -1}
+	for i, branch := range s.Branches {
+		if branch.LogicalType != "" {
+			return nil, errUnsupported
+		}
+		if branch.Type == schema.Null {
+			u.null = i
+		}
+	}
+
+	if elem.Implements(typeNamerType) || reflect.PtrTo(elem).Implements(typeNamerType) {
+		u.named = true
+		u.branches = make([]encodeFunc, len(s.Branches))
+		for i, branch := range s.Branches {
+			if branch.Type != schema.Null {
+				// the branches which can't be compiled go through the map based path
+				u.branches[i], _ = p.encoder(elem, branch, hookedMode)
+			}
+		}
+		return u.encodeValue, nil
+	}
+
+	u.index = u.branchIndex(p.codec.encodeTypeName(elem.Name()))
+	if u.index >= 0 {
+		encode, err := p.encoder(elem, s.Branches[u.index], hookedMode)
+		if err != nil {
+			return nil, err
+		}
+		u.encode = encode
+	}
+	return u.encodeValue, nil
+}
+
+// branchIndex returns the index of the branch of an union named after a type, as done by encodeUnionHook
+func (u *unionEncoder) branchIndex(typeName string) int {
+	if !isAvroBaseType(typeName) && !strings.Contains(typeName, ".") {
+		typeName = AddNamespace(u.namespace, typeName)
+	}
+	for i, branch := range u.union.Branches {
+		if branch.BranchName() == typeName {
+			return i
+		}
+	}
+	return -1
+}
+
+func (u *unionEncoder) encodeValue(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.IsNil() {
+		if u.null < 0 {
+			return nil, errFallback
+		}
+		return appendLong(buf, int64(u.null)), nil
+	}
+	index, encode := u.index, u.encode
+	if u.named {
+		index = u.branchIndex(typeName(v.Elem(), nil))
+		if index >= 0 {
+			encode = u.branches[index]
+		}
+	}
+	if index < 0 || encode == nil {
+		return nil, errFallback
+	}
+	return encode(appendLong(buf, int64(index)), v.Elem())
+}
+
+func arrayEncoder(items encodeFunc) encodeFunc {
+	return func(buf []byte, v reflect.Value) ([]byte, error) {
+		var err error
+		length := int64(v.Len())
+		var remainingInBlock int64
+		for i := int64(0); i < length; i++ {
+			if remainingInBlock == 0 {
+				remainingInBlock = length - i
+				if remainingInBlock > goavro.MaxBlockCount {
+					remainingInBlock = goavro.MaxBlockCount
+				}
+				buf = appendLong(buf, remainingInBlock)
+			}
+			if buf, err = items(buf, v.Index(int(i))); err != nil {
+				return nil, err
+			}
+			remainingInBlock--
+		}
+		return append(buf, 0), nil
+	}
+}
+
+func mapEncoder(values encodeFunc) encodeFunc {
+	return func(buf []byte, v reflect.Value) ([]byte, error) {
+		var err error
+		length := int64(v.Len())
+		var encoded, remainingInBlock int64
+		iter := v.MapRange()
+		for iter.Next() {
+			if remainingInBlock == 0 {
+				remainingInBlock = length - encoded
+				if remainingInBlock > goavro.MaxBlockCount {
+					remainingInBlock = goavro.MaxBlockCount
+				}
+				buf = appendLong(buf, remainingInBlock)
+			}
+			buf = appendString(buf, iter.Key().String())
+			if buf, err = values(buf, iter.Value()); err != nil {
+				return nil, err
+			}
+			remainingInBlock--
+			encoded++
+		}
+		return append(buf, 0), nil
+	}
+}
+
+// bytesEncoder encodes the slices of bytes
+func bytesEncoder(s *schema.Schema) (encodeFunc, error) {
+	switch s.Type {
+	case schema.Bytes, schema.String:
+		return func(buf []byte, v reflect.Value) ([]byte, error) {
+			b := v.Bytes()
+			return append(appendLong(buf, int64(len(b))), b...), nil
+		}, nil
+	case schema.Fixed:
+		return func(buf []byte, v reflect.Value) ([]byte, error) {
+			if v.Len() != s.Size {
+				return nil, errFallback
+			}
+			return append(buf, v.Bytes()...), nil
+		}, nil
+	}
+	return nil, errUnsupported
+}
+
+// primitiveEncoder encodes the kinds accepted by goavro once converted to their base type, with its precision checks
+func primitiveEncoder(kind reflect.Kind, s *schema.Schema) (encodeFunc, error) {
+	switch s.Type {
+	case schema.Boolean:
+		if kind == reflect.Bool {
+			return encodeBoolean, nil
+		}
+	case schema.Int:
+		switch kind {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			return encodeIntFromInt, nil
+		case reflect.Float32:
+			return encodeIntFromFloat32, nil
+		case reflect.Float64:
+			return encodeIntFromFloat64, nil
+		}
+	case schema.Long:
+		switch kind {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			return encodeLongFromInt, nil
+		case reflect.Float32:
+			return encodeLongFromFloat32, nil
+		case reflect.Float64:
+			return encodeLongFromFloat64, nil
+		}
+	case schema.Float:
+		switch kind {
+		case reflect.Float32, reflect.Float64:
+			return encodeFloatFromFloat, nil
+		case reflect.Int, reflect.Int64:
+			return encodeFloatFromInt64, nil
+		case reflect.Int32:
+			return encodeFloatFromInt32, nil
+		}
+	case schema.Double:
+		switch kind {
+		case reflect.Float32, reflect.Float64:
+			return encodeDoubleFromFloat, nil
+		case reflect.Int, reflect.Int64:
+			return encodeDoubleFromInt64, nil
+		case reflect.Int32:
+			return encodeDoubleFromInt32, nil
+		}
+	case schema.String, schema.Bytes:
+		if kind == reflect.String {
+			return encodeString, nil
+		}
+	case schema.Enum:
+		if kind == reflect.String {
+			return enumEncoder(s.Symbols), nil
+		}
+	case schema.Fixed:
+		if kind == reflect.String {
+			return func(buf []byte, v reflect.Value) ([]byte, error) {
+				if v.Len() != s.Size {
+					return nil, errFallback
+				}
+				return append(buf, v.String()...), nil
+			}, nil
+		}
+	}
+	return nil, errUnsupported
+}
+
+func encodeBoolean(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.Bool() {
+		return append(buf, 1), nil
+	}
+	return append(buf, 0), nil
+}
+
+func encodeIntFromInt(buf []byte, v reflect.Value) ([]byte, error) {
+	i := v.Int()
+	if int64(int32(i)) != i {
+		return nil, errFallback
+	}
+	return appendLong(buf, i), nil
+}
+
+func encodeIntFromFloat32(buf []byte, v reflect.Value) ([]byte, error) {
+	f := float32(v.Float())
+	i := int32(f)
+	if float32(i) != f {
+		return nil, errFallback
+	}
+	return appendLong(buf, int64(i)), nil
+}
+
+func encodeIntFromFloat64(buf []byte, v reflect.Value) ([]byte, error) {
+	f := v.Float()
+	i := int32(f)
+	if float64(i) != f {
+		return nil, errFallback
+	}
+	return appendLong(buf, int64(i)), nil
+}
+
+func encodeLongFromInt(buf []byte, v reflect.Value) ([]byte, error) {
+	return appendLong(buf, v.Int()), nil
+}
+
+func encodeLongFromFloat32(buf []byte, v reflect.Value) ([]byte, error) {
+	f := float32(v.Float())
+	i := int64(f)
+	if float32(i) != f {
+		return nil, errFallback
+	}
+	return appendLong(buf, i), nil
+}
+
+func encodeLongFromFloat64(buf []byte, v reflect.Value) ([]byte, error) {
+	f := v.Float()
+	i := int64(f)
+	if float64(i) != f {
+		return nil, errFallback
+	}
+	return appendLong(buf, i), nil
+}
+
+func encodeFloatFromFloat(buf []byte, v reflect.Value) ([]byte, error) {
+	return appendFloat(buf, float32(v.Float())), nil
+}
+
+func encodeFloatFromInt64(buf []byte, v reflect.Value) ([]byte, error) {
+	i := v.Int()
+	f := float32(i)
+	if int64(f) != i {
+		return nil, errFallback
+	}
+	return appendFloat(buf, f), nil
+}
+
+func encodeFloatFromInt32(buf []byte, v reflect.Value) ([]byte, error) {
+	i := int32(v.Int())
+	f := float32(i)
+	if int32(f) != i {
+		return nil, errFallback
+	}
+	return appendFloat(buf, f), nil
+}
+
+func encodeDoubleFromFloat(buf []byte, v reflect.Value) ([]byte, error) {
+	return appendDouble(buf, v.Float()), nil
+}
+
+func encodeDoubleFromInt64(buf []byte, v reflect.Value) ([]byte, error) {
+	i := v.Int()
+	f := float64(i)
+	if int64(f) != i {
+		return nil, errFallback
+	}
+	return appendDouble(buf, f), nil
+}
+
+func encodeDoubleFromInt32(buf []byte, v reflect.Value) ([]byte, error) {
+	i := int32(v.Int())
+	f := float64(i)
+	if int32(f) != i {
+		return nil, errFallback
+	}
+	return appendDouble(buf, f), nil
+}
+
+func encodeString(buf []byte, v reflect.Value) ([]byte, error) {
+	return appendString(buf, v.String()), nil
+}
+
+func enumEncoder(symbols []string) encodeFunc {
+	indexes := make(map[string]int64, len(symbols))
+	for i := len(symbols) - 1; i >= 0; i-- {
+		indexes[symbols[i]] = int64(i)
+	}
+	return func(buf []byte, v reflect.Value) ([]byte, error) {
+		index, ok := indexes[v.String()]
+		if !ok {
+			return nil, errFallback
+		}
+		return appendLong(buf, index), nil
+	}
+}
+
+// appendDefault encodes the default value of a field, as converted by goavro from its JSON value
+func appendDefault(buf []byte, s *schema.Schema, value interface{}) ([]byte, error) {
+	if s.LogicalType != "" {
+		return nil, errUnsupported
+	}
+	number, _ := value.(json.Number)
+	f, numberErr := number.Float64()
+	str, isString := value.(string)
+	switch s.Type {
+	case schema.Null:
+		if value == nil {
+			return buf, nil
+		}
+	case schema.Boolean:
+		if b, ok := value.(bool); ok {
+			if b {
+				return append(buf, 1), nil
+			}
+			return append(buf, 0), nil
+		}
+	case schema.Int:
+		if numberErr == nil {
+			return appendLong(buf, int64(int32(f))), nil
+		}
+	case schema.Long:
+		if numberErr == nil {
+			return appendLong(buf, int64(f)), nil
+		}
+	case schema.Float:
+		if numberErr == nil {
+			return appendFloat(buf, float32(f)), nil
+		}
+	case schema.Double:
+		if numberErr == nil {
+			return appendDouble(buf, f), nil
+		}
+	case schema.String, schema.Bytes:
+		if isString {
+			return appendString(buf, str), nil
+		}
+	case schema.Enum:
+		for i, symbol := range s.Symbols {
+			if isString && symbol == str {
+				return appendLong(buf, int64(i)), nil
+			}
+		}
+	case schema.Fixed:
+		if isString && len(str) == s.Size {
+			return append(buf, str...), nil
+		}
+	case schema.Union:
+		// the default of an union is a value of its first branch, the string "null" being null
+		if value == "null" {
+			value = nil
+		}
+		return appendDefault(append(buf, 0), s.Branches[0], value)
+	}
+	return nil, errUnsupported
+}
+
+func (p *planCompiler) decoder(t reflect.Type, s *schema.Schema) (decodeFunc, error) {
+	if s.LogicalType != "" {
+		return nil, errUnsupported
+	}
+	// mapstructure leaves the value untouched when decoding null
+	if s.Type == schema.Null {
+		return decodeNull, nil
+	}
+	if reflect.PtrTo(t).Implements(customUnmarshalerType) {
+		return nil, errUnsupported
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return p.unionDecoder(t, s)
+	case reflect.Struct:
+		return p.recordDecoder(t, s)
+	case reflect.Slice:
+		switch s.Type {
+		case schema.Array:
+			items, err := p.decoder(t.Elem(), s.Items)
+			if err != nil {
+				return nil, err
+			}
+			return arrayDecoder(t, items), nil
+		case schema.Bytes, schema.Fixed:
+			if t.Elem().Kind() != reflect.Uint8 || reflect.PtrTo(t.Elem()).Implements(customUnmarshalerType) {
+				return nil, errUnsupported
+			}
+			return bytesDecoder(t, s), nil
+		}
+	case reflect.Map:
+		key := t.Key()
+		if s.Type != schema.Map || key.Kind() != reflect.String || reflect.PtrTo(key).Implements(customUnmarshalerType) {
+			return nil, errUnsupported
+		}
+		values, err := p.decoder(t.Elem(), s.Values)
+		if err != nil {
+			return nil, err
+		}
+		return mapDecoder(t, values), nil
+	case reflect.Bool:
+		if s.Type == schema.Boolean {
+			return decodeBoolean, nil
+		}
+	case reflect.String:
+		switch s.Type {
+		case schema.String:
+			return decodeString, nil
+		case schema.Enum:
+			return enumDecoder(s.Symbols), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return numberDecoder(t.Kind(), s)
+	}
+	return nil, errUnsupported
+}
+
+type recordDecoder struct {
+	fields []decodeFunc
+}
+
+func (p *planCompiler) recordDecoder(t reflect.Type, s *schema.Schema) (decodeFunc, error) {
+	if fields := fieldsOf(t); !s.IsRecord() || fields.inlined || fields.err != nil {
+		// the fields promoted from the inlined structs go through the map based path
+		return nil, errUnsupported
+	}
+	key := planKey{t, s}
+	if record, ok := p.recordDecoders[key]; ok {
+		return record.decode, nil
+	}
+	record := &recordDecoder{fields: make([]decodeFunc, len(s.Fields))}
+	p.recordDecoders[key] = record
+
+	// the struct fields set by mapstructure, matching the field names exactly or else case insensitively
+	targets := make([]int, len(s.Fields))
+	for i := range targets {
+		targets[i] = -1
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := fieldName(field)
+		if !ok {
+			return nil, errUnsupported
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		match := -1
+		for j, f := range s.Fields {
+			if f.Name == name {
+				match = j
+				break
+			}
+		}
+		if match < 0 {
+			for j, f := range s.Fields {
+				if strings.EqualFold(f.Name, name) {
+					if match >= 0 {
+						return nil, errUnsupported
+					}
+					match = j
+				}
+			}
+		}
+		if match < 0 {
+			for _, f := range s.Fields {
+				if f.HasName(name) {
+					// the fields decoded through a schema alias go through the map based path
+					return nil, errUnsupported
+				}
+			}
+			continue
+		}
+		if targets[match] >= 0 {
+			return nil, errUnsupported
+		}
+		targets[match] = i
+	}
+
+	for j, f := range s.Fields {
+		if targets[j] < 0 {
+			fieldType := f.Type
+			record.fields[j] = func(buf []byte, _ reflect.Value) ([]byte, error) {
+				return skip(buf, fieldType)
+			}
+			continue
+		}
+		decode, err := p.decoder(t.Field(targets[j]).Type, f.Type)
+		if err != nil {
+			return nil, err
+		}
+		index := targets[j]
+		record.fields[j] = func(buf []byte, v reflect.Value) ([]byte, error) {
+			return decode(buf, v.Field(index))
+		}
+	}
+	return record.decode, nil
+}
+
+func (r *recordDecoder) decode(buf []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for _, decode := range r.fields {
+		if buf, err = decode(buf, v); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// unionDecoder decodes an union into a pointer, reused when it is not nil as done by mapstructure
+func (p *planCompiler) unionDecoder(t reflect.Type, s *schema.Schema) (decodeFunc, error) {
+	elem := t.Elem()
+	if s.Type != schema.Union || elem.Kind() == reflect.Ptr {
+		return nil, errUnsupported
+	}
+	branches := make([]decodeFunc, len(s.Branches))
+	for i, branch := range s.Branches {
+		decode, err := p.decoder(elem, branch)
+		if err != nil {
+			return nil, err
+		}
+		if branch.Type != schema.Null {
+			branches[i] = decode
+		}
+	}
+	return func(buf []byte, v reflect.Value) ([]byte, error) {
+		index, buf, err := readLong(buf)
+		if err != nil || index < 0 || index >= int64(len(branches)) {
+			return nil, errFallback
+		}
+		decode := branches[index]
+		if decode == nil {
+			return buf, nil
+		}
+		if !v.IsNil() {
+			return decode(buf, v.Elem())
+		}
+		ptr := reflect.New(elem)
+		if buf, err = decode(buf, ptr.Elem()); err != nil {
+			return nil, err
+		}
+		v.Set(ptr)
+		return buf, nil
+	}, nil
+}
+
+// arrayDecoder decodes an array into a slice, reusing its elements as done by mapstructure
+func arrayDecoder(t reflect.Type, items decodeFunc) decodeFunc {
+	return func(buf []byte, v reflect.Value) ([]byte, error) {
+		slice := v
+		length := 0
+		for {
+			count, rest, err := readBlockCount(buf)
+			if err != nil {
+				return nil, err
+			}
+			buf = rest
+			if count == 0 {
+				break
+			}
+			if slice.IsNil() {
+				slice = reflect.MakeSlice(t, 0, int(count))
+			}
+			for i := int64(0); i < count; i++ {
+				if slice.Len() <= length {
+					slice = reflect.Append(slice, reflect.Zero(t.Elem()))
+				}
+				if buf, err = items(buf, slice.Index(length)); err != nil {
+					return nil, err
+				}
+				length++
+			}
+		}
+		if length > 0 {
+			v.Set(slice)
+		}
+		return buf, nil
+	}
+}
+
+// mapDecoder decodes a map into a new map, or into the existing one
+func mapDecoder(t reflect.Type, values decodeFunc) decodeFunc {
+	return func(buf []byte, v reflect.Value) ([]byte, error) {
+		m := v
+		if m.IsNil() {
+			m = reflect.MakeMap(t)
+		}
+		for {
+			count, rest, err := readBlockCount(buf)
+			if err != nil {
+				return nil, err
+			}
+			buf = rest
+			if count == 0 {
+				break
+			}
+			for i := int64(0); i < count; i++ {
+				var key []byte
+				if key, buf, err = readBytes(buf); err != nil {
+					return nil, err
+				}
+				k := reflect.New(t.Key()).Elem()
+				k.SetString(string(key))
+				value := reflect.New(t.Elem()).Elem()
+				if buf, err = values(buf, value); err != nil {
+					return nil, err
+				}
+				m.SetMapIndex(k, value)
+			}
+		}
+		v.Set(m)
+		return buf, nil
+	}
+}
+
+// bytesDecoder decodes bytes or a fixed into a slice of bytes, copied and overwriting the beginning
+// of the existing slice as done by mapstructure
+func bytesDecoder(t reflect.Type, s *schema.Schema) decodeFunc {
+	return func(buf []byte, v reflect.Value) ([]byte, error) {
+		var b []byte
+		var err error
+		if s.Type == schema.Fixed {
+			if len(buf) < s.Size {
+				return nil, errFallback
+			}
+			b, buf = buf[:s.Size], buf[s.Size:]
+		} else if b, buf, err = readBytes(buf); err != nil {
+			return nil, err
+		}
+		slice := v
+		if slice.IsNil() {
+			if len(b) == 0 {
+				return buf, nil
+			}
+			slice = reflect.MakeSlice(t, len(b), len(b))
+		} else if slice.Len() < len(b) {
+			slice = reflect.AppendSlice(slice, reflect.MakeSlice(t, len(b)-slice.Len(), len(b)-slice.Len()))
+		}
+		copy(slice.Bytes(), b)
+		v.Set(slice)
+		return buf, nil
+	}
+}
+
+func decodeNull(buf []byte, _ reflect.Value) ([]byte, error) {
+	return buf, nil
+}
+
+func decodeBoolean(buf []byte, v reflect.Value) ([]byte, error) {
+	if len(buf) < 1 || buf[0] > 1 {
+		return nil, errFallback
+	}
+	v.SetBool(buf[0] == 1)
+	return buf[1:], nil
+}
+
+func decodeString(buf []byte, v reflect.Value) ([]byte, error) {
+	b, buf, err := readBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	v.SetString(string(b))
+	return buf, nil
+}
+
+func enumDecoder(symbols []string) decodeFunc {
+	return func(buf []byte, v reflect.Value) ([]byte, error) {
+		index, buf, err := readLong(buf)
+		if err != nil || index < 0 || index >= int64(len(symbols)) {
+			return nil, errFallback
+		}
+		v.SetString(symbols[index])
+		return buf, nil
+	}
+}
+
+// numberDecoder decodes a number into any numeric kind, converted as done by mapstructure
+func numberDecoder(kind reflect.Kind, s *schema.Schema) (decodeFunc, error) {
+	var read func(buf []byte) (int64, float64, bool, []byte, error)
+	switch s.Type {
+	case schema.Int:
+		read = func(buf []byte) (int64, float64, bool, []byte, error) {
+			i, buf, err := readInt(buf)
+			return int64(i), 0, false, buf, err
+		}
+	case schema.Long:
+		read = func(buf []byte) (int64, float64, bool, []byte, error) {
+			i, buf, err := readLong(buf)
+			return i, 0, false, buf, err
+		}
+	case schema.Float:
+		read = func(buf []byte) (int64, float64, bool, []byte, error) {
+			if len(buf) < 4 {
+				return 0, 0, true, nil, errFallback
+			}
+			return 0, float64(math.Float32frombits(binary.LittleEndian.Uint32(buf))), true, buf[4:], nil
+		}
+	case schema.Double:
+		read = func(buf []byte) (int64, float64, bool, []byte, error) {
+			if len(buf) < 8 {
+				return 0, 0, true, nil, errFallback
+			}
+			return 0, math.Float64frombits(binary.LittleEndian.Uint64(buf)), true, buf[8:], nil
+		}
+	default:
+		return nil, errUnsupported
+	}
+
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(buf []byte, v reflect.Value) ([]byte, error) {
+			i, f, isFloat, buf, err := read(buf)
+			if err != nil {
+				return nil, err
+			}
+			if isFloat {
+				i = int64(f)
+			}
+			v.SetInt(i)
+			return buf, nil
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(buf []byte, v reflect.Value) ([]byte, error) {
+			i, f, isFloat, buf, err := read(buf)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case isFloat && f >= 0:
+				v.SetUint(uint64(f))
+			case !isFloat && i >= 0:
+				v.SetUint(uint64(i))
+			default:
+				return nil, errFallback
+			}
+			return buf, nil
+		}, nil
+	default:
+		return func(buf []byte, v reflect.Value) ([]byte, error) {
+			i, f, isFloat, buf, err := read(buf)
+			if err != nil {
+				return nil, err
+			}
+			if !isFloat {
+				f = float64(i)
+			}
+			v.SetFloat(f)
+			return buf, nil
+		}, nil
+	}
+}
+
+// skip reads a value which is not decoded, checking it as goavro does
+func skip(buf []byte, s *schema.Schema) ([]byte, error) {
+	var err error
+	switch s.Type {
+	case schema.Null:
+		return buf, nil
+	case schema.Boolean:
+		if len(buf) < 1 || buf[0] > 1 {
+			return nil, errFallback
+		}
+		return buf[1:], nil
+	case schema.Int:
+		_, buf, err = readInt(buf)
+		return buf, err
+	case schema.Long:
+		_, buf, err = readLong(buf)
+		return buf, err
+	case schema.Float, schema.Double, schema.Fixed:
+		size := 4
+		if s.Type == schema.Double {
+			size = 8
+		} else if s.Type == schema.Fixed {
+			size = s.Size
+		}
+		if len(buf) < size {
+			return nil, errFallback
+		}
+		return buf[size:], nil
+	case schema.String, schema.Bytes:
+		_, buf, err = readBytes(buf)
+		return buf, err
+	case schema.Enum:
+		var index int64
+		index, buf, err = readLong(buf)
+		if err != nil || index < 0 || index >= int64(len(s.Symbols)) {
+			return nil, errFallback
+		}
+		return buf, nil
+	case schema.Record, schema.Error:
+		for _, f := range s.Fields {
+			if buf, err = skip(buf, f.Type); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case schema.Union:
+		var index int64
+		index, buf, err = readLong(buf)
+		if err != nil || index < 0 || index >= int64(len(s.Branches)) {
+			return nil, errFallback
+		}
+		return skip(buf, s.Branches[index])
+	case schema.Array, schema.Map:
+		for {
+			var count int64
+			if count, buf, err = readBlockCount(buf); err != nil {
+				return nil, err
+			}
+			if count == 0 {
+				return buf, nil
+			}
+			for i := int64(0); i < count; i++ {
+				if s.Type == schema.Map {
+					if _, buf, err = readBytes(buf); err != nil {
+						return nil, err
+					}
+					buf, err = skip(buf, s.Values)
+				} else {
+					buf, err = skip(buf, s.Items)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return nil, errFallback
+}
+
+// appendLong appends a zig-zag encoded long
+func appendLong(buf []byte, value int64) []byte {
+	encoded := (uint64(value) << 1) ^ uint64(value>>63)
+	for encoded >= 0x80 {
+		buf = append(buf, byte(encoded)|0x80)
+		encoded >>= 7
+	}
+	return append(buf, byte(encoded))
+}
+
+func appendFloat(buf []byte, value float32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], math.Float32bits(value))
+	return append(buf, b[:]...)
+}
+
+func appendDouble(buf []byte, value float64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(value))
+	return append(buf, b[:]...)
+}
+
+func appendString(buf []byte, value string) []byte {
+	return append(appendLong(buf, int64(len(value))), value...)
+}
+
+// readInt reads a zig-zag encoded int as goavro does
+func readInt(buf []byte) (int32, []byte, error) {
+	var value int
+	var shift uint
+	for offset, b := range buf {
+		value |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return int32(value>>1) ^ -int32(value&1), buf[offset+1:], nil
+		}
+		shift += 7
+	}
+	return 0, nil, errFallback
+}
+
+// readLong reads a zig-zag encoded long as goavro does
+func readLong(buf []byte) (int64, []byte, error) {
+	var value uint64
+	var shift uint
+	for offset, b := range buf {
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return int64(value>>1) ^ -int64(value&1), buf[offset+1:], nil
+		}
+		shift += 7
+	}
+	return 0, nil, errFallback
+}
+
+func readBytes(buf []byte) ([]byte, []byte, error) {
+	size, buf, err := readLong(buf)
+	if err != nil || size < 0 || size > int64(len(buf)) {
+		return nil, nil, errFallback
+	}
+	return buf[:size], buf[size:], nil
+}
+
+// readBlockCount reads the item count of a block of an array or a map, skipping its size when it is given
+func readBlockCount(buf []byte) (int64, []byte, error) {
+	count, buf, err := readLong(buf)
+	if err != nil || count == math.MinInt64 {
+		return 0, nil, errFallback
+	}
+	if count < 0 {
+		count = -count
+		if _, buf, err = readLong(buf); err != nil {
+			return 0, nil, err
+		}
+	}
+	if count > goavro.MaxBlockCount {
+		return 0, nil, errFallback
+	}
+	return count, buf, nil
+}
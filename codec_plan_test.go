@@ -0,0 +1,320 @@
+package avro
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const planSchema = `{
+  "type": "record",
+  "name": "Shipment",
+  "namespace": "test.plan",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "count", "type": "int"},
+    {"name": "weight", "type": "float"},
+    {"name": "price", "type": "double"},
+    {"name": "fragile", "type": "boolean"},
+    {"name": "label", "type": "string"},
+    {"name": "payload", "type": "bytes"},
+    {"name": "checksum", "type": {"type": "fixed", "name": "Checksum", "size": 4}},
+    {"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["PENDING", "SHIPPED"]}},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attributes", "type": {"type": "map", "values": "long"}},
+    {"name": "parcels", "type": {"type": "array", "items": {
+      "type": "record", "name": "Parcel", "fields": [
+        {"name": "ref", "type": "string"},
+        {"name": "next", "type": ["null", "Parcel"], "default": null}
+      ]}}},
+    {"name": "byRef", "type": {"type": "map", "values": "Parcel"}},
+    {"name": "note", "type": ["null", "string"], "default": null},
+    {"name": "main", "type": ["null", "Parcel"], "default": null},
+    {"name": "version", "type": "int", "default": 3},
+    {"name": "origin", "type": ["string", "null"], "default": "warehouse"}
+  ]
+}`
+
+type planStatus string
+
+type planParcel struct {
+	Ref  string      `avro:"ref"`
+	Next *planParcel `avro:"next"`
+}
+
+func (planParcel) AvroName() string {
+	return "Parcel"
+}
+
+type planShipment struct {
+	ID         int64                 `avro:"id"`
+	Count      int                   `avro:"count"`
+	Weight     float32               `avro:"weight"`
+	Price      float64               `avro:"price"`
+	Fragile    bool                  `avro:"fragile"`
+	Label      string                `avro:"label"`
+	Payload    []byte                `avro:"payload"`
+	Checksum   []byte                `avro:"checksum"`
+	Status     planStatus            `avro:"status"`
+	Tags       []string              `avro:"tags"`
+	Attributes map[string]int64      `avro:"attributes"`
+	Parcels    []planParcel          `avro:"parcels"`
+	ByRef      map[string]planParcel `avro:"byRef"`
+	Note       *string               `avro:"note"`
+	Main       *planParcel           `avro:"main"`
+	Ignored    string                `avro:"-"`
+	internal   int
+}
+
+func newPlanShipment() planShipment {
+	note := "handle with care"
+	return planShipment{
+		ID:         1 << 40,
+		Count:      -42,
+		Weight:     1.5,
+		Price:      99.99,
+		Fragile:    true,
+		Label:      "box",
+		Payload:    []byte{0, 1, 2},
+		Checksum:   []byte{0xca, 0xfe, 0xba, 0xbe},
+		Status:     "SHIPPED",
+		Tags:       []string{"a", "b"},
+		Attributes: map[string]int64{"floor": 3},
+		Parcels:    []planParcel{{Ref: "p1", Next: &planParcel{Ref: "p2"}}, {Ref: "p3"}},
+		ByRef:      map[string]planParcel{"p1": {Ref: "p1"}},
+		Note:       &note,
+		Main:       &planParcel{Ref: "main"},
+	}
+}
+
+// assertCompiledMarshal checks that a value is encoded by its compiled plan, as the map based path does
+func assertCompiledMarshal(t *testing.T, codec *Codec, value interface{}) []byte {
+	compiled, ok := codec.fastMarshal(nil, value)
+	require.True(t, ok, "the value should be encoded by its compiled plan")
+	maps, err := codec.marshal(&codec.Codec, nil, value)
+	require.NoError(t, err)
+	assert.Equal(t, maps, compiled)
+	return compiled
+}
+
+// assertCompiledUnmarshal checks that a value is decoded by its compiled plan, as the map based path does
+func assertCompiledUnmarshal(t *testing.T, codec *Codec, buf []byte, newOutput func() interface{}) {
+	compiled := newOutput()
+	compiledRest, ok := codec.fastUnmarshal(buf, compiled)
+	require.True(t, ok, "the value should be decoded by its compiled plan")
+	maps := newOutput()
+	mapsRest, err := codec.unmarshal(&codec.Codec, buf, maps, nil)
+	require.NoError(t, err)
+	assert.Equal(t, maps, compiled)
+	assert.Equal(t, mapsRest, compiledRest)
+}
+
+func TestCodec_compiled_plans(t *testing.T) {
+	codec, err := NewCodec(planSchema)
+	require.NoError(t, err)
+
+	value := newPlanShipment()
+	buf := assertCompiledMarshal(t, codec, &value)
+	assertCompiledMarshal(t, codec, value)
+
+	assertCompiledUnmarshal(t, codec, buf, func() interface{} { return &planShipment{} })
+
+	// the values already set are reused as done by mapstructure
+	assertCompiledUnmarshal(t, codec, buf, func() interface{} {
+		prefilled := newPlanShipment()
+		prefilled.Payload = []byte{9, 9, 9, 9, 9}
+		prefilled.Tags = []string{"x", "y", "z"}
+		prefilled.Attributes = map[string]int64{"other": 1}
+		prefilled.Main = &planParcel{Ref: "old", Next: &planParcel{Ref: "kept"}}
+		return &prefilled
+	})
+
+	var decoded planShipment
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	assert.Equal(t, value, decoded)
+
+	// the fields missing from the struct are skipped
+	assertCompiledUnmarshal(t, codec, buf, func() interface{} { return &planLabel{} })
+}
+
+type planLabel struct {
+	// mapstructure matches the field names case insensitively
+	Label   string `avro:"LABEL"`
+	Version int64
+}
+
+func TestCodec_compiled_plans_null_values(t *testing.T) {
+	codec, err := NewCodec(planSchema)
+	require.NoError(t, err)
+
+	buf := assertCompiledMarshal(t, codec, planShipment{Checksum: []byte("abcd"), Status: "PENDING"})
+
+	// null leaves the pointers untouched
+	assertCompiledUnmarshal(t, codec, buf, func() interface{} {
+		note := "kept"
+		return &planShipment{Note: &note, Main: &planParcel{Ref: "kept"}}
+	})
+}
+
+type planInvalid struct {
+	Count int64 `avro:"count"`
+}
+
+type planFallback struct {
+	Count int32       `avro:"count"`
+	Extra interface{} `avro:"extra"`
+}
+
+func TestCodec_compiled_plans_fallback(t *testing.T) {
+	codec, err := NewCodec(`{"type": "record", "name": "Counter", "fields": [
+		{"name": "count", "type": "int"},
+		{"name": "extra", "type": ["null", "string"], "default": null}
+	]}`)
+	require.NoError(t, err)
+
+	// the unsupported types go through the map based path
+	_, ok := codec.fastMarshal(nil, planFallback{Count: 1, Extra: map[string]interface{}{"string": "x"}})
+	assert.False(t, ok)
+	buf, err := codec.Marshal(planFallback{Count: 1, Extra: map[string]interface{}{"string": "x"}})
+	require.NoError(t, err)
+	var decoded planFallback
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	assert.Equal(t, planFallback{Count: 1, Extra: map[string]interface{}{"string": "x"}}, decoded)
+
+	// the values failing at runtime give the errors of the map based path
+	_, mapsErr := codec.marshal(&codec.Codec, nil, planInvalid{Count: 1 << 40})
+	require.Error(t, mapsErr)
+	_, err = codec.Marshal(planInvalid{Count: 1 << 40})
+	assert.Equal(t, mapsErr, err)
+
+	_, mapsErr = codec.unmarshal(&codec.Codec, []byte{2}, &planInvalid{}, nil)
+	require.Error(t, mapsErr)
+	assert.Equal(t, mapsErr, codec.Unmarshal([]byte{2}, &planInvalid{}))
+}
+
+func TestCodec_compiled_plans_namespace(t *testing.T) {
+	codec, err := NewCodec(`{"type": "record", "name": "Holder", "namespace": "test.ns", "fields": [
+		{"name": "parcel", "type": ["null", {"type": "record", "name": "plan_unnamed", "fields": [
+			{"name": "ref", "type": "string"}
+		]}]}
+	]}`)
+	require.NoError(t, err)
+
+	type holder struct {
+		Parcel *struct {
+			Ref string `avro:"ref"`
+		} `avro:"parcel"`
+	}
+	type namedHolder struct {
+		Parcel *planUnnamed `avro:"parcel"`
+	}
+	assertCompiledMarshal(t, codec, namedHolder{Parcel: &planUnnamed{Ref: "p"}})
+
+	// the plans follow the changes of namespace
+	codec.Namespace = "other"
+	_, ok := codec.fastMarshal(nil, namedHolder{Parcel: &planUnnamed{Ref: "p"}})
+	assert.False(t, ok)
+	_, err = codec.Marshal(namedHolder{Parcel: &planUnnamed{Ref: "p"}})
+	assert.Error(t, err)
+
+	_, ok = codec.fastMarshal(nil, holder{})
+	assert.True(t, ok)
+}
+
+type planUnnamed struct {
+	Ref string `avro:"ref"`
+}
+
+func TestCodec_compiled_plans_type_name_encoder(t *testing.T) {
+	codec, err := NewCodec(`{"type": "record", "name": "Holder", "fields": [
+		{"name": "parcel", "type": ["null",
+			{"type": "record", "name": "first", "fields": [{"name": "ref", "type": "string"}]},
+			{"type": "record", "name": "second", "fields": [{"name": "ref", "type": "string"}]}
+		]}
+	]}`)
+	require.NoError(t, err)
+	type holder struct {
+		Parcel *planUnnamed `avro:"parcel"`
+	}
+	// the encoders built by the same function share their code pointer
+	rename := func(name string) TypeNameEncoder {
+		return func(string) string { return name }
+	}
+
+	codec.SetTypeNameEncoder(rename("first"))
+	buf, ok := codec.fastMarshal(nil, holder{Parcel: &planUnnamed{Ref: "p"}})
+	require.True(t, ok)
+	assert.Equal(t, byte(2), buf[0], "the first record is the branch 1")
+
+	// a copy changing its encoder doesn't reuse the plans of the codec, nor changes them
+	other := *codec
+	other.SetTypeNameEncoder(rename("second"))
+	buf, ok = other.fastMarshal(nil, holder{Parcel: &planUnnamed{Ref: "p"}})
+	require.True(t, ok)
+	assert.Equal(t, byte(4), buf[0], "the second record is the branch 2")
+	buf, ok = codec.fastMarshal(nil, holder{Parcel: &planUnnamed{Ref: "p"}})
+	require.True(t, ok)
+	assert.Equal(t, byte(2), buf[0])
+}
+
+func TestCodec_compiled_plans_concurrency(t *testing.T) {
+	codec, err := NewCodec(planSchema)
+	require.NoError(t, err)
+	value := newPlanShipment()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				buf, err := codec.Marshal(&value)
+				assert.NoError(t, err)
+				var decoded planShipment
+				assert.NoError(t, codec.Unmarshal(buf, &decoded))
+				assert.Equal(t, value, decoded)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkCodec_Marshal(b *testing.B) {
+	codec, err := NewCodec(planSchema)
+	require.NoError(b, err)
+	value := newPlanShipment()
+
+	b.Run("compiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = codec.Marshal(&value)
+		}
+	})
+	b.Run("maps", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = codec.marshal(&codec.Codec, nil, &value)
+		}
+	})
+}
+
+func BenchmarkCodec_Unmarshal(b *testing.B) {
+	codec, err := NewCodec(planSchema)
+	require.NoError(b, err)
+	value := newPlanShipment()
+	buf, err := codec.Marshal(&value)
+	require.NoError(b, err)
+
+	b.Run("compiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var decoded planShipment
+			_ = codec.Unmarshal(buf, &decoded)
+		}
+	})
+	b.Run("maps", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var decoded planShipment
+			_, _ = codec.unmarshal(&codec.Codec, buf, &decoded, nil)
+		}
+	})
+}
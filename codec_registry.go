@@ -1,17 +1,19 @@
 package avro
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
-	"io"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
-// DefaultEndianness is the endianness used for marshal/unmarshalling.
-// The value must be the same between the marshaller and unmarshaller in order to work correctly.
-// Note: It is set to BigEndian to match the implementation of the kafka-rest Confluent's project
-// (see: https://github.com/confluentinc/kafka-rest)
+// DefaultEndianness was the endianness of the schema IDs of every CodecRegistry.
+//
+// Deprecated: the framing of the payloads is configured on each CodecRegistry by SetWireFormat,
+// DefaultEndianness isn't read anymore.
 var DefaultEndianness = binary.BigEndian
 
 // SchemaID is the type of the schema's ID return by the registry
@@ -35,17 +37,44 @@ type Header struct {
 	ID        SchemaID
 }
 
+// Schemer is an interface which can be implemented by the marshalled types to provide their own schema.
+// The CodecRegistry will then encode them with this schema, registered under the subject given by
+// its SubjectNameStrategy, instead of the default encoding schema.
+type Schemer interface {
+	AvroSchema() string
+}
+
 // CodecRegistry is an avro serializer and unserializer which is connected to the schemaregistry
 // to dynamically discover and decode schemas
 type CodecRegistry struct {
 	subject  string
+	topic    string
+	isKey    bool
 	Registry SchemaRegistry
+	// SchemaID is the default encoding schema, used when no schema matches the type of the marshalled value
 	SchemaID SchemaID
 	// TypeNameEncoder is the convertion logic to translate type name from go to avro
 	TypeNameEncoder TypeNameEncoder
+	// DecodeOptions tunes the decodings, see SetDecodeOptions
+	DecodeOptions DecodeOptions
+	// SubjectNameStrategy computes the subject of each schema from the topic.
+	// When nil, the subject given at the creation of the registry is used.
+	SubjectNameStrategy SubjectNameStrategy
+	// AutoRegister allows the registration of the schemas provided by Schemer values
+	// which are not registered yet
+	AutoRegister bool
 
-	codecByID map[SchemaID]*Codec
-	codecLock sync.RWMutex
+	// codecByID holds the encoding codecs, cache the ones discovered while decoding
+	codecByID  map[SchemaID]*Codec
+	cache      CodecCache
+	loader     codecLoader
+	idBySchema map[string]SchemaID
+	// idByName indexes the encoding schemas by the full name of their record
+	idByName    map[string]SchemaID
+	refreshStop chan struct{}
+	codecLock   sync.RWMutex
+	// format is the framing of the payloads, changed by SetWireFormat under codecLock
+	format WireFormat
 }
 
 // NewCodecRegistry configures a codec connected to the schema registry.
@@ -64,6 +93,14 @@ func NewCodecRegistry(registryURL, subject, schema string) (*CodecRegistry, erro
 	})
 }
 
+// NewCodecRegistryWithClient does a NewCodecRegistry() on top of the given schema registry client,
+// for instance a FileSchemaRegistry to work without any schema registry service
+func NewCodecRegistryWithClient(registry SchemaRegistry, subject, schema string) (*CodecRegistry, error) {
+	return newRegistryWithClient(registry, subject, schema, func(r *CodecRegistry, rawSchema string) error {
+		return r.init(rawSchema, nil)
+	})
+}
+
 // NewCodecRegistryAndRegister does a NewCodecRegistry() and a Register()
 func NewCodecRegistryAndRegister(registryURL string, subject string, schema string) (*CodecRegistry, error) {
 	return newRegistry(registryURL, subject, schema, func(r *CodecRegistry, rawSchema string) error {
@@ -71,83 +108,430 @@ func NewCodecRegistryAndRegister(registryURL string, subject string, schema stri
 	})
 }
 
+// NewTopicCodecRegistry configures a codec connected to the schema registry which computes
+// the subject of its schemas from a kafka topic.
+// - registryURL (required) is the complete URL of the schema registry
+// - topic (required) is the kafka topic the data is produced to or consumed from
+// - isKey tells if the codec handles the keys or the values of the topic
+// - strategy (optional) computes the subject of each schema, TopicNameStrategy is used if nil
+// - schema (optional) is the schema which will be used for encoding
+//
+// Values implementing Schemer are encoded with their own schema, under the subject computed at call time,
+// so several record types can be produced to the same topic.
+func NewTopicCodecRegistry(registryURL, topic string, isKey bool, strategy SubjectNameStrategy, schema string) (*CodecRegistry, error) {
+	if strategy == nil {
+		strategy = TopicNameStrategy
+	}
+	return newRegistry(registryURL, "", schema, func(r *CodecRegistry, rawSchema string) error {
+		r.topic = topic
+		r.isKey = isKey
+		r.SubjectNameStrategy = strategy
+		return r.init(rawSchema, nil)
+	})
+}
+
+// NewCodecRegistryLatest configures a codec connected to the schema registry which encodes
+// with the latest version of the subject's schema.
+// Nothing is registered: this is the mode to use in production, where the schemas are managed
+// out of the services. The latest version can be followed with RefreshLatest or StartLatestRefresh.
+func NewCodecRegistryLatest(registryURL, subject string) (*CodecRegistry, error) {
+	return newRegistry(registryURL, subject, "", func(r *CodecRegistry, _ string) error {
+		return r.RefreshLatest()
+	})
+}
+
+// NewCodecRegistryVersion configures a codec connected to the schema registry which encodes
+// with the given version of the subject's schema.
+func NewCodecRegistryVersion(registryURL, subject string, version int) (*CodecRegistry, error) {
+	return newRegistry(registryURL, subject, "", func(r *CodecRegistry, _ string) error {
+		return r.initVersion(version)
+	})
+}
+
+// NewCodecRegistryWithID configures a codec connected to the schema registry which encodes
+// with the schema of the given ID. The schema must be registered under the subject.
+func NewCodecRegistryWithID(registryURL, subject string, id SchemaID) (*CodecRegistry, error) {
+	return newRegistry(registryURL, subject, "", func(r *CodecRegistry, _ string) error {
+		return r.initWithID(id)
+	})
+}
+
+// initVersion sets the given version of the subject's schema as the default encoding schema
+func (r *CodecRegistry) initVersion(version int) error {
+	schema, err := r.Registry.GetSchemaBySubject(r.subject, version)
+	if err != nil {
+		return fmt.Errorf("Registry.GetSchemaBySubject error for %s version %d: %w", r.subject, version, err)
+	}
+	return r.useSchema(SchemaID(schema.ID), schema.Schema)
+}
+
+// initWithID sets the schema of the given ID as the default encoding schema
+func (r *CodecRegistry) initWithID(id SchemaID) error {
+	rawSchema, err := r.Registry.GetSchemaByID(int(id))
+	if err != nil {
+		return fmt.Errorf("Registry.GetSchemaByID error for %d: %w", id, err)
+	}
+	isRegistered, _, err := r.Registry.IsRegistered(r.subject, rawSchema)
+	if err != nil {
+		return fmt.Errorf("Registry.IsRegistered error for %s: %w", r.subject, err)
+	}
+	if !isRegistered {
+		return fmt.Errorf("schema %d is not registered under the subject %s", id, r.subject)
+	}
+	return r.useSchema(id, rawSchema)
+}
+
+// RefreshLatest sets the latest version of the subject's schema as the default encoding schema
+func (r *CodecRegistry) RefreshLatest() error {
+	schema, err := r.Registry.GetLatestSchema(r.subject)
+	if err != nil {
+		return fmt.Errorf("Registry.GetLatestSchema error for %s: %w", r.subject, err)
+	}
+	if SchemaID(schema.ID) == r.EncodeSchemaID() {
+		return nil
+	}
+	return r.useSchema(SchemaID(schema.ID), schema.Schema)
+}
+
+// StartLatestRefresh calls RefreshLatest periodically until Close is called.
+// onError (optional) is called with the errors of the refreshes, the previous schema being kept.
+func (r *CodecRegistry) StartLatestRefresh(interval time.Duration, onError func(error)) {
+	r.codecLock.Lock()
+	defer r.codecLock.Unlock()
+	if r.refreshStop != nil {
+		close(r.refreshStop)
+	}
+	stop := make(chan struct{})
+	r.refreshStop = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := r.RefreshLatest(); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the background refresh of the registry
+func (r *CodecRegistry) Close() {
+	r.codecLock.Lock()
+	defer r.codecLock.Unlock()
+	if r.refreshStop != nil {
+		close(r.refreshStop)
+		r.refreshStop = nil
+	}
+}
+
+// EncodeSchemaID returns the default encoding schema ID, it is safe to call during a refresh
+func (r *CodecRegistry) EncodeSchemaID() SchemaID {
+	r.codecLock.RLock()
+	defer r.codecLock.RUnlock()
+	return r.SchemaID
+}
+
+// useSchema sets an already registered schema as the default encoding schema
+func (r *CodecRegistry) useSchema(id SchemaID, rawSchema string) error {
+	codec, err := r.newCodec(rawSchema)
+	if err != nil {
+		return fmt.Errorf("NewCodec error: %w", err)
+	}
+	r.addEncodeCodec(id, codec, true)
+	return nil
+}
+
 // SetTypeNameEncoder will set the TypeNameEncoder of the codec registry and apply it to all previously created codec
 func (r *CodecRegistry) SetTypeNameEncoder(typeNameEncoder TypeNameEncoder) {
 	r.TypeNameEncoder = typeNameEncoder
 	r.codecLock.RLock()
 	defer r.codecLock.RUnlock()
 	for _, codec := range r.codecByID {
-		codec.TypeNameEncoder = r.TypeNameEncoder
+		codec.SetTypeNameEncoder(r.TypeNameEncoder)
+	}
+	if r.cache != nil {
+		r.cache.Range(func(_ SchemaID, codec *Codec) {
+			codec.SetTypeNameEncoder(r.TypeNameEncoder)
+		})
+	}
+}
+
+// SetDecodeOptions will set the DecodeOptions of the codec registry and apply them to all previously created codec.
+// It is safe to call while the registry is used: the decodings run on copies of the codecs holding the options
+// of the registry.
+func (r *CodecRegistry) SetDecodeOptions(options DecodeOptions) {
+	r.codecLock.Lock()
+	defer r.codecLock.Unlock()
+	r.DecodeOptions = options
+	for _, codec := range r.codecByID {
+		codec.DecodeOptions = options
+	}
+	if r.cache != nil {
+		r.cache.Range(func(_ SchemaID, codec *Codec) {
+			codec.DecodeOptions = options
+		})
 	}
 }
 
-// Register registers a new schema inside the Schema Registry and sets this schema as the default encode and decode schema
+// Register registers a new schema inside the Schema Registry and sets this schema as the default encode and decode schema.
+// The schemas previously registered are kept to encode the values of their own record type.
 func (r *CodecRegistry) Register(rawSchema string) error {
-	_, err := r.Registry.RegisterNewSchema(r.subject, rawSchema)
+	subject, err := r.subjectFor(rawSchema)
+	if err != nil {
+		return err
+	}
+	_, err = r.Registry.RegisterNewSchema(subject, rawSchema)
 	if err != nil {
 		return fmt.Errorf("RegisterNewSchema error: %w", err)
 	}
-	isRegistered, schema, err := r.Registry.IsRegistered(r.subject, rawSchema)
+	isRegistered, schema, err := r.Registry.IsRegistered(subject, rawSchema)
 	if err != nil {
 		return fmt.Errorf("IsRegistered error: %w", err)
 	}
 	if !isRegistered {
 		return fmt.Errorf("can't register schema")
 	}
-	codec, err := NewCodec(rawSchema)
+	codec, err := r.newCodec(rawSchema)
 	if err != nil {
 		return fmt.Errorf("NewCodec error: %w", err)
 	}
+	r.addEncodeCodec(SchemaID(schema.ID), codec, true)
+	return nil
+}
+
+// AddSchema adds an encoding schema to the registry without changing the default SchemaID.
+// Marshal will use it for the values whose avro type name (see TypeNamer and TypeNameEncoder)
+// matches the name of the schema's record.
+// The schema must be registered under its subject, unless AutoRegister is set.
+func (r *CodecRegistry) AddSchema(rawSchema string) error {
+	_, _, err := r.codecForSchema(rawSchema)
+	return err
+}
+
+// addEncodeCodec stores a codec used for encoding, indexes it by its record name
+// and optionally makes it the default encoding schema
+func (r *CodecRegistry) addEncodeCodec(id SchemaID, codec *Codec, isDefault bool) {
+	r.codecLock.Lock()
+	defer r.codecLock.Unlock()
+	r.codecByID[id] = codec
+	if isDefault {
+		r.SchemaID = id
+	}
+	if name := codec.fullName(); name != "" {
+		if r.idByName == nil {
+			r.idByName = make(map[string]SchemaID)
+		}
+		r.idByName[name] = id
+	}
+}
+
+// idForType returns the ID of the encoding schema whose record name matches the type of the value
+func (r *CodecRegistry) idForType(data interface{}) (SchemaID, bool) {
+	value := reflect.ValueOf(data)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if !value.IsValid() || value.Type().Name() == "" || value.Kind() == reflect.Map {
+		return UnknownID, false
+	}
+
+	encodeTypeName := r.TypeNameEncoder
+	if encodeTypeName == nil {
+		encodeTypeName = DefaultTypeNameEncoder
+	}
+	names := []string{typeName(value, encodeTypeName), value.Type().Name()}
+
+	r.codecLock.RLock()
+	defer r.codecLock.RUnlock()
+	for _, name := range names {
+		if id, ok := r.idByName[name]; ok {
+			return id, true
+		}
+	}
+	// Go types have no namespace, fall back on the short names of the records,
+	// the lowest ID winning when records of several namespaces match
+	for _, named := range r.namedIDs() {
+		for _, name := range names {
+			if strings.HasSuffix(named.name, "."+name) {
+				return named.id, true
+			}
+		}
+	}
+	return UnknownID, false
+}
+
+// namedID is an encoding schema ID with the full name of its record
+type namedID struct {
+	id   SchemaID
+	name string
+}
+
+// namedIDs returns the encoding schema IDs indexed by name, sorted by ID and then by name for the lookups
+// iterating over them to be deterministic. The lock must be held.
+func (r *CodecRegistry) namedIDs() []namedID {
+	named := make([]namedID, 0, len(r.idByName))
+	for name, id := range r.idByName {
+		named = append(named, namedID{id: id, name: name})
+	}
+	sort.Slice(named, func(i, j int) bool {
+		if named[i].id != named[j].id {
+			return named[i].id < named[j].id
+		}
+		return named[i].name < named[j].name
+	})
+	return named
+}
+
+// readerID returns the encoding schema which should be used to read data written with the given schema:
+// the writer schema itself if it is an encoding schema, otherwise the encoding schema of the same record
+// or, if there is none, the default SchemaID.
+func (r *CodecRegistry) readerID(writerID SchemaID, writer *Codec) SchemaID {
+	r.codecLock.RLock()
+	defer r.codecLock.RUnlock()
+	if writerID == r.SchemaID {
+		return writerID
+	}
+	name := writer.fullName()
+	if id, ok := r.idByName[name]; ok {
+		return id
+	}
+	for _, id := range r.idByName {
+		if id == writerID {
+			return writerID
+		}
+	}
+	// the records renamed by the reader schemas are known under the writer name as alias,
+	// the lowest ID winning when several reader schemas have this alias
+	for _, named := range r.namedIDs() {
+		if reader := r.codecByID[named.id]; name != "" && reader != nil && reader.parsed != nil && reader.parsed.HasName(name) {
+			return named.id
+		}
+	}
+	return r.SchemaID
+}
+
+// subjectFor returns the subject under which the given schema is registered
+func (r *CodecRegistry) subjectFor(rawSchema string) (string, error) {
+	if r.SubjectNameStrategy == nil {
+		return r.subject, nil
+	}
+	subject, err := r.SubjectNameStrategy(r.topic, r.isKey, rawSchema)
+	if err != nil {
+		return "", fmt.Errorf("SubjectNameStrategy error for topic %s: %w", r.topic, err)
+	}
+	return subject, nil
+}
+
+// newCodec creates a codec configured like the registry
+func (r *CodecRegistry) newCodec(rawSchema string) (*Codec, error) {
+	codec, err := NewCodec(rawSchema)
+	if err != nil {
+		return nil, err
+	}
 	if r.TypeNameEncoder != nil {
 		codec.TypeNameEncoder = r.TypeNameEncoder
 	}
-	r.codecLock.Lock()
-	r.codecByID[SchemaID(schema.ID)] = codec
-	r.codecLock.Unlock()
-	r.SchemaID = SchemaID(schema.ID)
-	return nil
+	codec.DecodeOptions = r.decodeOptions()
+	return codec, nil
+}
+
+// decodeOptions returns the DecodeOptions of the registry, which SetDecodeOptions changes under the lock
+func (r *CodecRegistry) decodeOptions() DecodeOptions {
+	r.codecLock.RLock()
+	defer r.codecLock.RUnlock()
+	return r.DecodeOptions
+}
+
+// decodingCodec returns a copy of a codec holding the DecodeOptions of the registry, as the options
+// of the shared codecs may be changed by SetDecodeOptions during the decoding
+func (r *CodecRegistry) decodingCodec(codec *Codec) *Codec {
+	r.codecLock.RLock()
+	defer r.codecLock.RUnlock()
+	decoding := *codec
+	decoding.DecodeOptions = r.DecodeOptions
+	return &decoding
 }
 
 // Unmarshal implement Unmarshaller
 // Note: the Unmarshalling of older schema can be inefficient.
-// nolint
 func (r *CodecRegistry) Unmarshal(from []byte, to interface{}) error {
-	binBuffer := bytes.NewBuffer(from)
-
-	header := Header{}
-	err := binary.Read(binBuffer, DefaultEndianness, &header.MagicByte)
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("binary.Read magic byte error: %w", err)
+	rest, err := r.UnmarshalNext(from, to)
+	if err != nil {
+		return err
 	}
-	err = binary.Read(binBuffer, DefaultEndianness, &header.ID)
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("binary.Read ID error: %w", err)
+	return r.decodeOptions().checkRest(rest)
+}
+
+// UnmarshalNext unmarshals the payload at the beginning of the buffer and returns the bytes following it,
+// allowing to decode back-to-back payloads from one buffer.
+func (r *CodecRegistry) UnmarshalNext(from []byte, to interface{}) ([]byte, error) {
+	return r.unmarshalNext(from, to, nil)
+}
+
+// UnmarshalMetadata unmarshals like Unmarshal, and reports the fields of the payload left unused
+// and the struct fields left unset.
+func (r *CodecRegistry) UnmarshalMetadata(from []byte, to interface{}) (DecodeMetadata, error) {
+	var metadata DecodeMetadata
+	rest, err := r.unmarshalNext(from, to, &metadata)
+	if err != nil {
+		return metadata, err
 	}
-	if header.MagicByte != MagicByte {
-		return fmt.Errorf("the parsed magic byte %q is not correct (expected %q)", header.MagicByte, MagicByte)
+	return metadata, r.decodeOptions().checkRest(rest)
+}
+
+// nolint
+func (r *CodecRegistry) unmarshalNext(from []byte, to interface{}, metadata *DecodeMetadata) ([]byte, error) {
+	header, payload, err := r.WireFormat().ParseHeader(from)
+	if err != nil {
+		return nil, err
 	}
 
 	codec, err := r.getCodecByID(header.ID)
 	if err != nil {
-		return fmt.Errorf("error when getting codec for schema id %v: %w", header.ID, err)
+		return nil, fmt.Errorf("error when getting codec for schema id %v: %w", header.ID, err)
 	}
 
-	if r.SchemaID != UnknownID && header.ID != r.SchemaID {
+	readerID := r.readerID(header.ID, codec)
+	codec = r.decodingCodec(codec)
+	if readerID != UnknownID && readerID != header.ID {
+		readerCodec, err := r.getCodecByID(readerID)
+		if err != nil {
+			return nil, fmt.Errorf("error when getting codec for schema id %v: %w", readerID, err)
+		}
+		readerCodec = r.decodingCodec(readerCodec)
 		tmpTo := make(map[string]interface{})
-		err = codec.Unmarshal(binBuffer.Bytes(), &tmpTo)
+		rest, err := codec.UnmarshalNext(payload, &tmpTo)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		from, err = r.Marshal(tmpTo)
+		if readerCodec.parsed != nil {
+			readerNames(tmpTo, readerCodec.parsed)
+		}
+		from, err = readerCodec.Marshal(tmpTo)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		return r.Unmarshal(from, to)
+		_, err = readerCodec.unmarshalNext(from, to, metadata)
+		return rest, err
 	}
-	return codec.Unmarshal(binBuffer.Bytes(), to)
+	return codec.unmarshalNext(payload, to, metadata)
 }
 
-// getCodecByID will retriever a codec and its associated schema and check if the schema is correctly registered under the right topic
+// CodecByID returns the codec of a schema ID, looking it up in the registry if it is not cached.
+// It gives access to the schema of any payload, for instance to convert it to Avro JSON.
+func (r *CodecRegistry) CodecByID(id SchemaID) (*Codec, error) {
+	return r.getCodecByID(id)
+}
+
+// getCodecByID will retrieve a codec, either an encoding one or one found in the decoding cache.
+// On a cache miss the schema is looked up in the registry without holding any lock, concurrent
+// lookups of the same ID being merged into one.
 func (r *CodecRegistry) getCodecByID(ID SchemaID) (*Codec, error) {
 	r.codecLock.RLock()
 	if codec, ok := r.codecByID[ID]; ok {
@@ -155,44 +539,193 @@ func (r *CodecRegistry) getCodecByID(ID SchemaID) (*Codec, error) {
 		return codec, nil
 	}
 	r.codecLock.RUnlock()
+
+	cache := r.codecCache()
+	if codec, ok := cache.Get(ID); ok {
+		return codec, nil
+	}
+	return r.loader.load(ID, func() (*Codec, error) {
+		rawSchema, err := r.Registry.GetSchemaByID(int(ID))
+		if err != nil {
+			return nil, err
+		}
+		codec, err := r.newCodec(rawSchema)
+		if err != nil {
+			return nil, err
+		}
+		cache.Add(ID, codec)
+		return codec, nil
+	})
+}
+
+// codecCache returns the decoding cache, an unbounded one being created if none was set
+func (r *CodecRegistry) codecCache() CodecCache {
+	r.codecLock.RLock()
+	cache := r.cache
+	r.codecLock.RUnlock()
+	if cache != nil {
+		return cache
+	}
 	r.codecLock.Lock()
 	defer r.codecLock.Unlock()
-	rawSchema, err := r.Registry.GetSchemaByID(int(ID))
+	if r.cache == nil {
+		r.cache = NewCodecCache(0, 0)
+	}
+	return r.cache
+}
+
+// SetCodecCache replaces the cache of the codecs used for decoding.
+// The encoding codecs are kept apart and never evicted.
+func (r *CodecRegistry) SetCodecCache(cache CodecCache) {
+	r.codecLock.Lock()
+	defer r.codecLock.Unlock()
+	r.cache = cache
+}
+
+// SetCacheOptions replaces the decoding cache by one configured with the given options
+func (r *CodecRegistry) SetCacheOptions(opts CacheOptions) {
+	r.SetCodecCache(NewCodecCache(opts.MaxEntries, opts.TTL))
+	r.loader.lock.Lock()
+	defer r.loader.lock.Unlock()
+	r.loader.notFoundTTL = opts.NotFoundTTL
+	r.loader.maxNotFoundTTL = opts.MaxNotFoundTTL
+	r.loader.notFound = make(map[SchemaID]notFoundEntry)
+}
+
+// Marshal implements Marshaller
+// Values implementing Schemer are encoded with their own schema, the other ones with the registry's SchemaID.
+func (r *CodecRegistry) Marshal(data interface{}) ([]byte, error) {
+	return r.AppendMarshal(nil, data)
+}
+
+// AppendMarshal appends the header and the avro encoding of data to dst and returns the extended buffer,
+// allowing the buffers to be reused.
+func (r *CodecRegistry) AppendMarshal(dst []byte, data interface{}) ([]byte, error) {
+	id, codec, err := r.encodeCodec(data)
 	if err != nil {
 		return nil, err
 	}
-
-	codec, err := NewCodec(rawSchema)
+	dst, err = r.WireFormat().AppendHeader(dst, id)
 	if err != nil {
 		return nil, err
 	}
+	return codec.AppendMarshal(dst, data)
+}
 
-	r.codecByID[ID] = codec
-	return codec, nil
+// SetWireFormat changes the framing of the payloads (magic byte, size and byte order of the schema IDs)
+// encoded and decoded by the registry, it is safe to call while the registry is used.
+// ApicurioWireFormat is the framing of the Apicurio serializers.
+func (r *CodecRegistry) SetWireFormat(format WireFormat) error {
+	if err := format.validate(); err != nil {
+		return err
+	}
+	r.codecLock.Lock()
+	defer r.codecLock.Unlock()
+	r.format = format
+	return nil
 }
 
-// Marshal implements Marshaller
-func (r *CodecRegistry) Marshal(data interface{}) ([]byte, error) {
-	var binBuffer bytes.Buffer
+// WireFormat returns the framing of the payloads, ConfluentWireFormat unless changed by SetWireFormat
+func (r *CodecRegistry) WireFormat() WireFormat {
+	r.codecLock.RLock()
+	defer r.codecLock.RUnlock()
+	if r.format.IDSize == 0 {
+		return defaultWireFormat()
+	}
+	return r.format
+}
 
-	if r.SchemaID == UnknownID {
-		return nil, ErrNoEncodeSchema
+// CheckType checks the Go type against the schema Marshal would encode its values with,
+// see Codec.CheckType.
+func (r *CodecRegistry) CheckType(t reflect.Type) error {
+	elem := t
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
 	}
-	header := Header{MagicByte: MagicByte, ID: r.SchemaID}
-	err := binary.Write(&binBuffer, DefaultEndianness, header)
+	_, codec, err := r.encodeCodec(reflect.New(elem).Elem().Interface())
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return codec.CheckType(t)
+}
 
-	byteData, err := r.codecByID[r.SchemaID].Marshal(data)
+// encodeCodec returns the schema ID and the codec used to encode the given data
+func (r *CodecRegistry) encodeCodec(data interface{}) (SchemaID, *Codec, error) {
+	if schemer, ok := asSchemer(data); ok {
+		return r.codecForSchema(schemer.AvroSchema())
+	}
+	id, ok := r.idForType(data)
+	if !ok {
+		id = r.EncodeSchemaID()
+	}
+	if id == UnknownID {
+		return UnknownID, nil, ErrNoEncodeSchema
+	}
+	codec, err := r.getCodecByID(id)
 	if err != nil {
-		return nil, err
+		return UnknownID, nil, fmt.Errorf("error when getting codec for schema id %v: %w", id, err)
+	}
+	return id, codec, nil
+}
+
+// codecForSchema resolves the subject of the given schema and returns its ID and codec.
+// The schema is registered if it is unknown and AutoRegister is set.
+func (r *CodecRegistry) codecForSchema(rawSchema string) (SchemaID, *Codec, error) {
+	r.codecLock.RLock()
+	id, ok := r.idBySchema[rawSchema]
+	codec := r.codecByID[id]
+	r.codecLock.RUnlock()
+	if ok && codec != nil {
+		return id, codec, nil
+	}
+
+	subject, err := r.subjectFor(rawSchema)
+	if err != nil {
+		return UnknownID, nil, err
 	}
-	err = binary.Write(&binBuffer, DefaultEndianness, byteData)
+	isRegistered, schema, err := r.Registry.IsRegistered(subject, rawSchema)
 	if err != nil {
-		return nil, err
+		return UnknownID, nil, fmt.Errorf("Registry.IsRegistered error for %s: %w", subject, err)
+	}
+	id = SchemaID(schema.ID)
+	if !isRegistered {
+		if !r.AutoRegister {
+			return UnknownID, nil, fmt.Errorf("schema %s is not registered in the schema registry", subject)
+		}
+		registeredID, err := r.Registry.RegisterNewSchema(subject, rawSchema)
+		if err != nil {
+			return UnknownID, nil, fmt.Errorf("RegisterNewSchema error for %s: %w", subject, err)
+		}
+		id = SchemaID(registeredID)
+	}
+
+	codec, err = r.newCodec(rawSchema)
+	if err != nil {
+		return UnknownID, nil, fmt.Errorf("NewCodec error: %w", err)
 	}
-	return binBuffer.Bytes(), nil
+	r.addEncodeCodec(id, codec, false)
+	r.codecLock.Lock()
+	defer r.codecLock.Unlock()
+	if r.idBySchema == nil {
+		r.idBySchema = make(map[string]SchemaID)
+	}
+	r.idBySchema[rawSchema] = id
+	return id, codec, nil
+}
+
+// asSchemer checks if the value, or a pointer on the value, implements Schemer
+func asSchemer(data interface{}) (Schemer, bool) {
+	if data == nil {
+		return nil, false
+	}
+	if schemer, ok := data.(Schemer); ok {
+		return schemer, true
+	}
+	if reflect.ValueOf(data).Kind() == reflect.Ptr {
+		return nil, false
+	}
+	schemer, ok := toStructPtr(data).(Schemer)
+	return schemer, ok
 }
 
 func newRegistry(registryURL string, subject string, schema string, initFunc func(*CodecRegistry, string) error) (*CodecRegistry, error) {
@@ -200,13 +733,17 @@ func newRegistry(registryURL string, subject string, schema string, initFunc fun
 	if err != nil {
 		return nil, err
 	}
+	return newRegistryWithClient(schemaRegistry, subject, schema, initFunc)
+}
+
+func newRegistryWithClient(schemaRegistry SchemaRegistry, subject string, schema string, initFunc func(*CodecRegistry, string) error) (*CodecRegistry, error) {
 	CodecRegistry := &CodecRegistry{
 		codecByID: make(map[SchemaID]*Codec),
 		subject:   subject,
 		Registry:  schemaRegistry,
 	}
 
-	err = initFunc(CodecRegistry, schema)
+	err := initFunc(CodecRegistry, schema)
 	if err != nil {
 		return nil, err
 	}
@@ -220,9 +757,13 @@ func (r *CodecRegistry) init(rawSchema string, schemaNotRegisteredFunc func() er
 		r.SchemaID = UnknownID
 		return nil
 	}
-	isRegistered, schema, err := r.Registry.IsRegistered(r.subject, rawSchema)
+	subject, err := r.subjectFor(rawSchema)
 	if err != nil {
-		return fmt.Errorf("Registry.IsRegistered error for %s: %w", r.subject, err)
+		return err
+	}
+	isRegistered, schema, err := r.Registry.IsRegistered(subject, rawSchema)
+	if err != nil {
+		return fmt.Errorf("Registry.IsRegistered error for %s: %w", subject, err)
 	}
 
 	if !isRegistered {
@@ -230,15 +771,13 @@ func (r *CodecRegistry) init(rawSchema string, schemaNotRegisteredFunc func() er
 			return schemaNotRegisteredFunc()
 		}
 
-		return fmt.Errorf("schema %s is not registered in the schema registry", r.subject)
+		return fmt.Errorf("schema %s is not registered in the schema registry", subject)
 	}
-	r.SchemaID = SchemaID(schema.ID)
-	codec, err := NewCodec(rawSchema)
+	codec, err := r.newCodec(rawSchema)
 	if err != nil {
 		return fmt.Errorf("NewCodec error: %w", err)
 	}
-	r.codecByID[SchemaID(schema.ID)] = codec
-	r.SchemaID = SchemaID(schema.ID)
+	r.addEncodeCodec(SchemaID(schema.ID), codec, true)
 	return nil
 }
 
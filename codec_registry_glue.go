@@ -0,0 +1,244 @@
+package avro
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// GlueHeaderVersion is the first byte of the payloads framed by the AWS Glue serializers
+const GlueHeaderVersion = 3
+
+// GlueCompression is the compression byte of the payloads framed by the AWS Glue serializers
+type GlueCompression byte
+
+const (
+	// GlueCompressionNone leaves the avro encoding uncompressed
+	GlueCompressionNone GlueCompression = 0
+	// GlueCompressionZlib compresses the avro encoding with zlib
+	GlueCompressionZlib GlueCompression = 5
+)
+
+// DefaultGlueMaxDecompressedSize is the maximum size of the decompressed avro encodings,
+// unless the MaxDecompressedSize of the GlueCodecRegistry is set
+const DefaultGlueMaxDecompressedSize = 64 << 20
+
+// glueHeaderSize is the size of the header version, the compression byte and the schema version ID
+const glueHeaderSize = 2 + len(GlueSchemaVersionID{})
+
+// GlueSchemaVersionID is the UUID of a schema version of an AWS Glue schema registry
+type GlueSchemaVersionID [16]byte
+
+// ParseGlueSchemaVersionID parses the canonical form of a UUID, ex: b7b4a7f0-9c96-4e4a-a687-fb5de9ef0c63
+func ParseGlueSchemaVersionID(s string) (GlueSchemaVersionID, error) {
+	var id GlueSchemaVersionID
+	raw := strings.Replace(s, "-", "", -1)
+	if len(raw) != 2*len(id) || len(s) != 36 {
+		return id, fmt.Errorf("invalid schema version ID %q", s)
+	}
+	if _, err := hex.Decode(id[:], []byte(raw)); err != nil {
+		return id, fmt.Errorf("invalid schema version ID %q: %w", s, err)
+	}
+	return id, nil
+}
+
+// String returns the canonical form of the UUID
+func (id GlueSchemaVersionID) String() string {
+	s := hex.EncodeToString(id[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// GlueSchemaResolver gives the schema of an AWS Glue schema version, for instance by calling the
+// GetSchemaVersion API of AWS Glue. MapGlueSchemaResolver works without any AWS access.
+// Implementations must be safe for concurrent use.
+type GlueSchemaResolver interface {
+	GetSchemaByVersionID(id GlueSchemaVersionID) (string, error)
+}
+
+// MapGlueSchemaResolver is a GlueSchemaResolver holding the schemas by version ID
+type MapGlueSchemaResolver map[GlueSchemaVersionID]string
+
+// GetSchemaByVersionID implements GlueSchemaResolver
+func (m MapGlueSchemaResolver) GetSchemaByVersionID(id GlueSchemaVersionID) (string, error) {
+	schema, ok := m[id]
+	if !ok {
+		return "", fmt.Errorf("unknown schema version %s", id)
+	}
+	return schema, nil
+}
+
+// GlueCodecRegistry is an avro serializer and unserializer of the payloads framed by the AWS Glue serializers:
+// the header version byte, the compression byte and the UUID of the schema version, followed by
+// the avro encoding of the datum, compressed with zlib or not.
+// The schemas met while decoding are resolved by the Resolver and cached.
+type GlueCodecRegistry struct {
+	Resolver GlueSchemaResolver
+	// SchemaVersionID is the encoding schema
+	SchemaVersionID GlueSchemaVersionID
+	// Compression is the compression of the encoded payloads, the decoding handles both
+	Compression GlueCompression
+	// TypeNameEncoder is the convertion logic to translate type name from go to avro
+	TypeNameEncoder TypeNameEncoder
+	// DecodeOptions tunes the decodings
+	DecodeOptions DecodeOptions
+	// MaxDecompressedSize bounds the size of the decompressed avro encodings, DefaultGlueMaxDecompressedSize
+	// when zero. The larger payloads fail with an error wrapping ErrDatumTooLarge.
+	MaxDecompressedSize int
+
+	codecByID map[GlueSchemaVersionID]*Codec
+	codecLock sync.RWMutex
+}
+
+// NewGlueCodecRegistry configures a codec resolving the schemas of the AWS Glue schema versions,
+// which encodes with the given schema version. A zero GlueSchemaVersionID gives a registry which only decodes.
+func NewGlueCodecRegistry(resolver GlueSchemaResolver, id GlueSchemaVersionID) (*GlueCodecRegistry, error) {
+	r := &GlueCodecRegistry{
+		Resolver:        resolver,
+		SchemaVersionID: id,
+		codecByID:       make(map[GlueSchemaVersionID]*Codec),
+	}
+	if id == (GlueSchemaVersionID{}) {
+		return r, nil
+	}
+	if _, err := r.CodecByVersionID(id); err != nil {
+		return nil, fmt.Errorf("error when getting codec for schema version %s: %w", id, err)
+	}
+	return r, nil
+}
+
+// CodecByVersionID returns the codec of a schema version, resolving it if it is not cached
+func (r *GlueCodecRegistry) CodecByVersionID(id GlueSchemaVersionID) (*Codec, error) {
+	r.codecLock.RLock()
+	codec, ok := r.codecByID[id]
+	r.codecLock.RUnlock()
+	if ok {
+		return codec, nil
+	}
+
+	rawSchema, err := r.Resolver.GetSchemaByVersionID(id)
+	if err != nil {
+		return nil, err
+	}
+	codec, err = NewCodec(rawSchema)
+	if err != nil {
+		return nil, err
+	}
+	if r.TypeNameEncoder != nil {
+		codec.TypeNameEncoder = r.TypeNameEncoder
+	}
+	codec.DecodeOptions = r.DecodeOptions
+
+	r.codecLock.Lock()
+	defer r.codecLock.Unlock()
+	if r.codecByID == nil {
+		r.codecByID = make(map[GlueSchemaVersionID]*Codec)
+	}
+	if cached, ok := r.codecByID[id]; ok {
+		return cached, nil
+	}
+	r.codecByID[id] = codec
+	return codec, nil
+}
+
+// Marshal implements Marshaller
+func (r *GlueCodecRegistry) Marshal(data interface{}) ([]byte, error) {
+	return r.AppendMarshal(nil, data)
+}
+
+// AppendMarshal appends the header and the avro encoding of data to dst and returns the extended buffer,
+// allowing the buffers to be reused.
+func (r *GlueCodecRegistry) AppendMarshal(dst []byte, data interface{}) ([]byte, error) {
+	if r.SchemaVersionID == (GlueSchemaVersionID{}) {
+		return nil, ErrNoEncodeSchema
+	}
+	codec, err := r.CodecByVersionID(r.SchemaVersionID)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting codec for schema version %s: %w", r.SchemaVersionID, err)
+	}
+	dst = append(dst, GlueHeaderVersion, byte(r.Compression))
+	dst = append(dst, r.SchemaVersionID[:]...)
+	switch r.Compression {
+	case GlueCompressionNone:
+		return codec.AppendMarshal(dst, data)
+	case GlueCompressionZlib:
+		encoded, err := codec.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		buf := bytes.NewBuffer(dst)
+		w := zlib.NewWriter(buf)
+		if _, err := w.Write(encoded); err != nil {
+			return nil, fmt.Errorf("zlib.Write error: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("zlib.Close error: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown compression byte %d", r.Compression)
+}
+
+// Unmarshal implement Unmarshaller
+func (r *GlueCodecRegistry) Unmarshal(from []byte, to interface{}) error {
+	rest, err := r.UnmarshalNext(from, to)
+	if err != nil {
+		return err
+	}
+	return r.DecodeOptions.checkRest(rest)
+}
+
+// UnmarshalNext unmarshals the payload at the beginning of the buffer and returns the bytes following it,
+// allowing to decode back-to-back payloads from one buffer.
+func (r *GlueCodecRegistry) UnmarshalNext(from []byte, to interface{}) ([]byte, error) {
+	if len(from) < glueHeaderSize {
+		return nil, fmt.Errorf("the payload of %d bytes is shorter than the header of %d bytes: %w", len(from), glueHeaderSize, ErrShortPayload)
+	}
+	if from[0] != GlueHeaderVersion {
+		return nil, fmt.Errorf("the parsed header version %d is not correct (expected %d): %w", from[0], GlueHeaderVersion, ErrInvalidMagicByte)
+	}
+	var id GlueSchemaVersionID
+	copy(id[:], from[2:glueHeaderSize])
+	codec, err := r.CodecByVersionID(id)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting codec for schema version %s: %w", id, err)
+	}
+
+	payload := from[glueHeaderSize:]
+	switch GlueCompression(from[1]) {
+	case GlueCompressionNone:
+		return codec.UnmarshalNext(payload, to)
+	case GlueCompressionZlib:
+		// the bytes.Reader is read up to the end of the zlib stream, the following bytes are left in it
+		compressed := bytes.NewReader(payload)
+		zr, err := zlib.NewReader(compressed)
+		if err != nil {
+			return nil, fmt.Errorf("zlib.NewReader error: %w", err)
+		}
+		max := r.MaxDecompressedSize
+		if max <= 0 {
+			max = DefaultGlueMaxDecompressedSize
+		}
+		// one more byte tells if the limit is exceeded
+		encoded, err := ioutil.ReadAll(io.LimitReader(zr, int64(max)+1))
+		if err != nil {
+			return nil, fmt.Errorf("zlib.Read error: %w", err)
+		}
+		if len(encoded) > max {
+			return nil, fmt.Errorf("the decompressed payload exceeds %d bytes: %w", max, ErrDatumTooLarge)
+		}
+		rest, err := codec.UnmarshalNext(encoded, to)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.DecodeOptions.checkRest(rest); err != nil {
+			return nil, err
+		}
+		return payload[len(payload)-compressed.Len():], nil
+	}
+	return nil, fmt.Errorf("unknown compression byte %d", from[1])
+}
@@ -0,0 +1,100 @@
+package avro
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func glueRegistries(t *testing.T) (*GlueCodecRegistry, GlueSchemaVersionID, GlueSchemaVersionID) {
+	v1, err := ParseGlueSchemaVersionID("b7b4a7f0-9c96-4e4a-a687-fb5de9ef0c63")
+	require.NoError(t, err)
+	v2, err := ParseGlueSchemaVersionID("0f8fad5b-d9cb-469f-a165-70867728950e")
+	require.NoError(t, err)
+	resolver := MapGlueSchemaResolver{v1: userV1, v2: userV2}
+	registry, err := NewGlueCodecRegistry(resolver, v2)
+	require.NoError(t, err)
+	return registry, v1, v2
+}
+
+func TestParseGlueSchemaVersionID(t *testing.T) {
+	id, err := ParseGlueSchemaVersionID("b7b4a7f0-9c96-4e4a-a687-fb5de9ef0c63")
+	require.NoError(t, err)
+	assert.Equal(t, byte(0xb7), id[0])
+	assert.Equal(t, byte(0x63), id[15])
+	assert.Equal(t, "b7b4a7f0-9c96-4e4a-a687-fb5de9ef0c63", id.String())
+
+	for _, invalid := range []string{"", "b7b4a7f09c964e4aa687fb5de9ef0c63", "z7b4a7f0-9c96-4e4a-a687-fb5de9ef0c63"} {
+		_, err := ParseGlueSchemaVersionID(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestGlueCodecRegistry(t *testing.T) {
+	registry, _, v2 := glueRegistries(t)
+
+	buf, err := registry.Marshal(map[string]interface{}{"name": "john", "age": 42})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{GlueHeaderVersion, byte(GlueCompressionNone)}, buf[:2])
+	assert.Equal(t, v2[:], buf[2:18])
+
+	var decoded map[string]interface{}
+	require.NoError(t, registry.Unmarshal(buf, &decoded))
+	assert.Equal(t, map[string]interface{}{"name": "john", "age": int32(42)}, decoded)
+
+	registry.Compression = GlueCompressionZlib
+	compressed, err := registry.Marshal(map[string]interface{}{"name": "jane", "age": 7})
+	require.NoError(t, err)
+	assert.Equal(t, byte(GlueCompressionZlib), compressed[1])
+	// the payloads are decoded back-to-back, compressed or not
+	rest, err := registry.UnmarshalNext(append(compressed, buf...), &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "jane", "age": int32(7)}, decoded)
+	assert.Equal(t, buf, rest)
+
+	registry.DecodeOptions.Strict = true
+	assert.Error(t, registry.Unmarshal(append(compressed, 0), &decoded))
+	registry.DecodeOptions.Strict = false
+
+	// the decompression is bounded, the encodings of jane and john having the same size
+	registry.MaxDecompressedSize = len(buf) - glueHeaderSize - 1
+	err = registry.Unmarshal(compressed, &decoded)
+	assert.True(t, errors.Is(err, ErrDatumTooLarge), "%v", err)
+	registry.MaxDecompressedSize = len(buf) - glueHeaderSize
+	assert.NoError(t, registry.Unmarshal(compressed, &decoded))
+}
+
+func TestGlueCodecRegistry_versions(t *testing.T) {
+	registry, v1, _ := glueRegistries(t)
+
+	// the payloads of the other schema versions are decoded with their own schema
+	writer, err := NewGlueCodecRegistry(registry.Resolver, v1)
+	require.NoError(t, err)
+	buf, err := writer.Marshal(map[string]interface{}{"name": "john"})
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, registry.Unmarshal(buf, &decoded))
+	assert.Equal(t, map[string]interface{}{"name": "john"}, decoded)
+
+	unknown := append([]byte(nil), buf...)
+	unknown[2]++
+	err = registry.Unmarshal(unknown, &decoded)
+	assert.Contains(t, err.Error(), "unknown schema version")
+
+	buf[0] = 0
+	err = registry.Unmarshal(buf, &decoded)
+	assert.True(t, errors.Is(err, ErrInvalidMagicByte), "%v", err)
+	err = registry.Unmarshal(buf[:10], &decoded)
+	assert.True(t, errors.Is(err, ErrShortPayload), "%v", err)
+	buf[0], buf[1] = GlueHeaderVersion, 1
+	assert.Error(t, registry.Unmarshal(buf, &decoded))
+
+	decoder, err := NewGlueCodecRegistry(registry.Resolver, GlueSchemaVersionID{})
+	require.NoError(t, err)
+	_, err = decoder.Marshal(map[string]interface{}{"name": "john"})
+	assert.Equal(t, ErrNoEncodeSchema, err)
+	_, err = NewGlueCodecRegistry(MapGlueSchemaResolver{}, v1)
+	assert.Error(t, err)
+}
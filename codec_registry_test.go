@@ -1,9 +1,12 @@
 package avro
 
 import (
+	"encoding/binary"
+	"errors"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,7 +19,11 @@ func NewMockCodecRegistry(subject string) *CodecRegistry {
 		if os.Getenv("GO_INTEGRATION_TESTS") != "1" {
 			Registry = NewNOOPClient()
 		} else {
-			Registry, _ = NewSchemaRegistry(SchemaRegistryURL)
+			url := os.Getenv("SCHEMA_REGISTRY_URL")
+			if url == "" {
+				url = "http://schemaregistry:8081"
+			}
+			Registry, _ = NewSchemaRegistry(url)
 		}
 	}
 	return &CodecRegistry{
@@ -26,6 +33,22 @@ func NewMockCodecRegistry(subject string) *CodecRegistry {
 	}
 }
 
+const personSchema = `{
+  "type": "record",
+  "name": "Person",
+  "fields": [
+    {"name": "name", "type": "string"},
+    {"name": "age", "type": "int"}
+  ]
+}`
+
+// newPersonCodecRegistry returns a mock CodecRegistry whose default encoding schema is personSchema
+func newPersonCodecRegistry(t *testing.T) *CodecRegistry {
+	codec := NewMockCodecRegistry("test")
+	require.NoError(t, codec.initAndRegister(personSchema))
+	return codec
+}
+
 func TestNewCodecRegistry(t *testing.T) {
 	CodecRegistry := NewMockCodecRegistry("test")
 	assert.NotNil(t, CodecRegistry)
@@ -270,6 +293,123 @@ func TestAvroHeaderInBytes(t *testing.T) {
 	assert.True(t, header[4] > 0)
 }
 
+func TestCodecRegistry_AppendMarshal(t *testing.T) {
+	codec := newPersonCodecRegistry(t)
+
+	expected, err := codec.Marshal(Person{"Nico", 36})
+	require.NoError(t, err)
+	buf, err := codec.AppendMarshal([]byte("prefix"), Person{"Nico", 36})
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte("prefix"), expected...), buf)
+
+	var decoded Person
+	require.NoError(t, codec.Unmarshal(buf[len("prefix"):], &decoded))
+	assert.Equal(t, Person{"Nico", 36}, decoded)
+}
+
+func TestCodecRegistry_SetWireFormat(t *testing.T) {
+	codec := newPersonCodecRegistry(t)
+	id := codec.EncodeSchemaID()
+	assert.Equal(t, ConfluentWireFormat, codec.WireFormat())
+
+	buf, err := codec.Marshal(Person{"Nico", 36})
+	require.NoError(t, err)
+	header, _, err := ConfluentWireFormat.ParseHeader(buf)
+	require.NoError(t, err)
+	assert.Equal(t, id, header.ID)
+
+	littleEndian := WireFormat{MagicByte: 1, IDSize: 4, ByteOrder: binary.LittleEndian}
+	require.NoError(t, codec.SetWireFormat(littleEndian))
+	buf, err = codec.Marshal(Person{"Nico", 36})
+	require.NoError(t, err)
+	expected, err := littleEndian.AppendHeader(nil, id)
+	require.NoError(t, err)
+	assert.Equal(t, expected, buf[:5])
+	var decoded Person
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	assert.Equal(t, Person{"Nico", 36}, decoded)
+
+	other := NewMockCodecRegistry("test")
+	err = other.Unmarshal(buf, &decoded)
+	assert.True(t, errors.Is(err, ErrInvalidMagicByte), "%v", err)
+
+	assert.Error(t, codec.SetWireFormat(WireFormat{IDSize: 3, ByteOrder: binary.BigEndian}))
+	assert.Equal(t, littleEndian, codec.WireFormat())
+
+	// the wire format can be changed while the registry is used
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_, _ = codec.Marshal(Person{"Nico", 36})
+		}
+	}()
+	require.NoError(t, codec.SetWireFormat(ConfluentWireFormat))
+	<-done
+}
+
+func TestCodecRegistry_UnmarshalNext(t *testing.T) {
+	codec := newPersonCodecRegistry(t)
+
+	buf, err := codec.Marshal(Person{"Nico", 36})
+	require.NoError(t, err)
+	buf, err = codec.AppendMarshal(buf, Person{"Rob", 42})
+	require.NoError(t, err)
+
+	var first, second Person
+	next, err := codec.UnmarshalNext(buf, &first)
+	require.NoError(t, err)
+	assert.Equal(t, Person{"Nico", 36}, first)
+	rest, err := codec.UnmarshalNext(next, &second)
+	require.NoError(t, err)
+	assert.Equal(t, Person{"Rob", 42}, second)
+	assert.Empty(t, rest)
+
+	// the strict mode is applied to the codecs already created
+	var decoded Person
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	codec.SetDecodeOptions(DecodeOptions{Strict: true})
+	err = codec.Unmarshal(buf, &decoded)
+	assert.True(t, errors.Is(err, ErrTrailingBytes))
+	require.NoError(t, codec.Unmarshal(buf[:len(buf)-len(next)], &decoded))
+	assert.True(t, codec.codecByID[codec.SchemaID].DecodeOptions.Strict)
+
+	// the options can be changed while the registry decodes
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			var decoded Person
+			_, _ = codec.UnmarshalNext(buf, &decoded)
+		}
+	}()
+	codec.SetDecodeOptions(DecodeOptions{})
+	<-done
+}
+
+func TestCodecRegistry_DecodeOptions(t *testing.T) {
+	codec := NewMockCodecRegistry("test-contract")
+	require.NoError(t, codec.initAndRegister(contractSchema))
+	buf, err := codec.Marshal(map[string]interface{}{
+		"name":       "Nico",
+		"age":        36,
+		"city":       "Paris",
+		"attributes": map[string]interface{}{},
+		"lines":      []interface{}{},
+	})
+	require.NoError(t, err)
+
+	var decoded contract
+	metadata, err := codec.UnmarshalMetadata(buf, &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"city"}, metadata.Unused)
+	assert.Equal(t, []string{"email"}, metadata.Unset)
+
+	codec.SetDecodeOptions(DecodeOptions{ErrorUnset: true})
+	err = codec.Unmarshal(buf, &decoded)
+	assert.True(t, errors.Is(err, ErrUnsetFields))
+}
+
 func Test_should_be_able_to_unmarshal_payload_sent_by_kafkarest(t *testing.T) {
 	registry := NewNOOPClient()
 	codec := &CodecRegistry{
@@ -465,3 +605,161 @@ func TestCodecRegistry_error_on_encode_with_empty_schema(t *testing.T) {
 	_, err = codec.Marshal(data)
 	assert.Error(t, err)
 }
+
+type Company struct {
+	Name      string `avro:"name"`
+	Employees int32  `avro:"employees"`
+}
+
+func (Company) AvroName() string {
+	return "business"
+}
+
+func TestCodecRegistry_Marshal_selects_schema_by_type(t *testing.T) {
+	companySchema := `{
+	  "type": "record",
+	  "name": "business",
+	  "namespace": "lbc",
+	  "fields": [
+	    {"name": "name", "type": "string"},
+	    {"name": "employees", "type": "int"}
+	  ]
+	}`
+
+	codec := &CodecRegistry{
+		codecByID:           make(map[SchemaID]*Codec),
+		Registry:            NewNOOPClient(),
+		SubjectNameStrategy: RecordNameStrategy,
+	}
+	require.NoError(t, codec.Register(personSchema))
+	personID := codec.SchemaID
+
+	assert.Error(t, codec.AddSchema(companySchema), "the schema is not registered")
+	codec.AutoRegister = true
+	require.NoError(t, codec.AddSchema(companySchema))
+	assert.Equal(t, personID, codec.SchemaID, "the default schema is unchanged")
+
+	person, err := codec.Marshal(&Person{"Nico", 36})
+	require.NoError(t, err)
+	company, err := codec.Marshal(Company{"lbc", 1500})
+	require.NoError(t, err)
+	assert.NotEqual(t, person[:5], company[:5])
+
+	var decodedPerson Person
+	require.NoError(t, codec.Unmarshal(person, &decodedPerson))
+	assert.Equal(t, Person{"Nico", 36}, decodedPerson)
+
+	var decodedCompany Company
+	require.NoError(t, codec.Unmarshal(company, &decodedCompany))
+	assert.Equal(t, Company{"lbc", 1500}, decodedCompany)
+
+	// Values without a matching type use the default schema
+	data, err := codec.Marshal(map[string]interface{}{"name": "Nico", "age": 36})
+	require.NoError(t, err)
+	assert.Equal(t, person[:5], data[:5])
+}
+
+func TestCodecRegistry_Marshal_selects_schema_by_short_name(t *testing.T) {
+	namespacedPersonSchema := func(namespace string) string {
+		return `{"type": "record", "name": "Person", "namespace": "` + namespace + `", "fields": [
+			{"name": "name", "type": "string"},
+			{"name": "age", "type": "int"}
+		]}`
+	}
+	codec := &CodecRegistry{
+		codecByID:           make(map[SchemaID]*Codec),
+		Registry:            NewNOOPClient(),
+		SubjectNameStrategy: RecordNameStrategy,
+		AutoRegister:        true,
+	}
+	require.NoError(t, codec.Register(`{"type": "record", "name": "Other", "fields": []}`))
+	for _, namespace := range []string{"z", "m", "a"} {
+		require.NoError(t, codec.AddSchema(namespacedPersonSchema(namespace)))
+	}
+	expected := codec.idByName["z.Person"]
+
+	// the records of several namespaces match the Go type, the lowest ID is always used
+	for i := 0; i < 20; i++ {
+		buf, err := codec.Marshal(Person{"Nico", 36})
+		require.NoError(t, err)
+		id, err := PeekSchemaID(buf)
+		require.NoError(t, err)
+		require.Equal(t, expected, id)
+	}
+}
+
+func TestCodecRegistry_encode_modes(t *testing.T) {
+	schemaV2 := `{
+	  "type": "record",
+	  "name": "Person",
+	  "fields": [
+	    {"name": "name", "type": "string"},
+	    {"name": "age", "type": "int"},
+	    {"name": "height", "type": "int", "default": 150}
+	  ]
+	}`
+
+	registry := NewNOOPClient()
+	idV1, err := registry.RegisterNewSchema("people", personSchema)
+	require.NoError(t, err)
+	idV2, err := registry.RegisterNewSchema("people", schemaV2)
+	require.NoError(t, err)
+
+	newCodec := func(initFunc func(r *CodecRegistry) error) (*CodecRegistry, error) {
+		return newRegistryWithClient(registry, "people", "", func(r *CodecRegistry, _ string) error {
+			return initFunc(r)
+		})
+	}
+
+	t.Run("latest", func(t *testing.T) {
+		codec, err := newCodec((*CodecRegistry).RefreshLatest)
+		require.NoError(t, err)
+		assert.Equal(t, SchemaID(idV2), codec.EncodeSchemaID())
+		subjects, err := registry.Subjects()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"people"}, subjects, "nothing is registered")
+	})
+
+	t.Run("id", func(t *testing.T) {
+		codec, err := newCodec(func(r *CodecRegistry) error { return r.initWithID(SchemaID(idV1)) })
+		require.NoError(t, err)
+		assert.Equal(t, SchemaID(idV1), codec.EncodeSchemaID())
+
+		avro, err := codec.Marshal(Person{"Nico", 36})
+		require.NoError(t, err)
+		var decoded Person
+		require.NoError(t, codec.Unmarshal(avro, &decoded))
+		assert.Equal(t, Person{"Nico", 36}, decoded)
+
+		_, err = newRegistryWithClient(registry, "other", "", func(r *CodecRegistry, _ string) error {
+			return r.initWithID(SchemaID(idV1))
+		})
+		assert.Error(t, err, "the schema is not registered under this subject")
+	})
+
+	t.Run("version", func(t *testing.T) {
+		versioned := &mockSchemaRegistry{
+			GetSchemaBySubjectFn: func(subject string, ver int) (Schema, error) {
+				return Schema{Schema: personSchema, Subject: subject, Version: ver, ID: idV1}, nil
+			},
+		}
+		codec, err := newRegistryWithClient(versioned, "people", "", func(r *CodecRegistry, _ string) error {
+			return r.initVersion(1)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, SchemaID(idV1), codec.EncodeSchemaID())
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		codec, err := newCodec(func(r *CodecRegistry) error { return r.initWithID(SchemaID(idV1)) })
+		require.NoError(t, err)
+
+		codec.StartLatestRefresh(time.Millisecond, func(err error) { t.Error(err) })
+		defer codec.Close()
+		deadline := time.Now().Add(time.Second)
+		for codec.EncodeSchemaID() != SchemaID(idV2) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, SchemaID(idV2), codec.EncodeSchemaID())
+	})
+}
@@ -0,0 +1,81 @@
+package avro
+
+import (
+	"fmt"
+
+	"github.com/leboncoin/avrocado/internal/schema"
+)
+
+// CompatibilityLevel is the compatibility enforced by a schema registry between the versions of a subject
+type CompatibilityLevel string
+
+// The compatibility levels of the Confluent schema registry
+const (
+	CompatibilityNone               CompatibilityLevel = "NONE"
+	CompatibilityBackward           CompatibilityLevel = "BACKWARD"
+	CompatibilityBackwardTransitive CompatibilityLevel = "BACKWARD_TRANSITIVE"
+	CompatibilityForward            CompatibilityLevel = "FORWARD"
+	CompatibilityForwardTransitive  CompatibilityLevel = "FORWARD_TRANSITIVE"
+	CompatibilityFull               CompatibilityLevel = "FULL"
+	CompatibilityFullTransitive     CompatibilityLevel = "FULL_TRANSITIVE"
+)
+
+// DefaultCompatibility is the compatibility level of the Confluent schema registry when none is configured
+const DefaultCompatibility = CompatibilityBackward
+
+// IsValid tells if the level is one of the known compatibility levels
+func (l CompatibilityLevel) IsValid() bool {
+	switch l {
+	case CompatibilityNone, CompatibilityBackward, CompatibilityBackwardTransitive, CompatibilityForward,
+		CompatibilityForwardTransitive, CompatibilityFull, CompatibilityFullTransitive:
+		return true
+	}
+	return false
+}
+
+// checkCompatibility checks that a new schema can be added to the previous versions of a subject,
+// given from the oldest to the latest
+func checkCompatibility(level CompatibilityLevel, newSchema string, previous []string) error {
+	if level == CompatibilityNone || len(previous) == 0 {
+		return nil
+	}
+	parsed, err := schema.Parse(newSchema)
+	if err != nil {
+		return err
+	}
+
+	var backward, forward bool
+	switch level {
+	case CompatibilityBackward, CompatibilityBackwardTransitive:
+		backward = true
+	case CompatibilityForward, CompatibilityForwardTransitive:
+		forward = true
+	case CompatibilityFull, CompatibilityFullTransitive:
+		backward, forward = true, true
+	default:
+		return fmt.Errorf("unknown compatibility level %q", level)
+	}
+	switch level {
+	case CompatibilityBackwardTransitive, CompatibilityForwardTransitive, CompatibilityFullTransitive:
+	default:
+		previous = previous[len(previous)-1:]
+	}
+
+	for _, raw := range previous {
+		existing, err := schema.Parse(raw)
+		if err != nil {
+			return err
+		}
+		if backward {
+			if err := schema.CanRead(parsed, existing); err != nil {
+				return fmt.Errorf("the new schema can't read data written with a previous one: %w", err)
+			}
+		}
+		if forward {
+			if err := schema.CanRead(existing, parsed); err != nil {
+				return fmt.Errorf("a previous schema can't read data written with the new one: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package avro
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+var (
+	// ErrTrailingBytes is returned by the strict decodings when bytes remain after the decoded datum
+	ErrTrailingBytes = errors.New("bytes remain after the avro datum")
+	// ErrUnsetFields is returned by the decodings with ErrorUnset when struct fields are missing from the datum
+	ErrUnsetFields = errors.New("struct fields missing from the avro datum")
+)
+
+// DecodeOptions are the options of the decodings.
+// The options other than Strict are handled by the map based decoding, skipping the compiled decoders.
+type DecodeOptions struct {
+	// Strict rejects the payloads holding bytes after the datum, which are ignored otherwise:
+	// Unmarshal then returns an error wrapping ErrTrailingBytes.
+	Strict bool
+	// ErrorUnused rejects the datums holding fields without matching struct field
+	ErrorUnused bool
+	// ErrorUnset rejects the datums missing some fields of the struct, returning an error wrapping ErrUnsetFields
+	ErrorUnset bool
+	// WeaklyTypedInput converts the values whose type doesn't match the struct field (ex: an int into a string),
+	// as done by mapstructure
+	WeaklyTypedInput bool
+	// ZeroFields resets the values of the output before decoding, instead of reusing the maps and the slices
+	// already set
+	ZeroFields bool
+}
+
+// checkRest returns an error when the options reject the bytes remaining after a datum
+func (o DecodeOptions) checkRest(rest []byte) error {
+	if o.Strict && len(rest) > 0 {
+		return fmt.Errorf("%d bytes after the datum: %w", len(rest), ErrTrailingBytes)
+	}
+	return nil
+}
+
+// compiled tells if the compiled decoders implement the options
+func (o DecodeOptions) compiled() bool {
+	return !o.ErrorUnused && !o.ErrorUnset && !o.WeaklyTypedInput && !o.ZeroFields
+}
+
+// DecodeMetadata reports how the fields of a datum matched the output of a decoding.
+// The nested fields are named by their path, ex: "parcels[0].ref".
+type DecodeMetadata struct {
+	// Keys are the fields of the datum decoded into the output
+	Keys []string
+	// Unused are the fields of the datum without matching struct field
+	Unused []string
+	// Unset are the fields of the struct missing from the datum
+	Unset []string
+}
+
+func newDecodeMetadata(decoded mapstructure.Metadata, unset []string) DecodeMetadata {
+	metadata := DecodeMetadata{Keys: decoded.Keys, Unused: decoded.Unused, Unset: unset}
+	sort.Strings(metadata.Keys)
+	sort.Strings(metadata.Unused)
+	return metadata
+}
+
+// outputUnsetFields returns the sorted paths of the struct fields which have no matching field in the native
+// datum decoded into output
+func outputUnsetFields(datum interface{}, output interface{}) []string {
+	unset := unsetFields(nil, "", datum, reflect.TypeOf(output).Elem())
+	sort.Strings(unset)
+	return unset
+}
+
+// unsetFields appends the paths of the struct fields which have no matching field in the native data,
+// walking the data as mapstructure does when decoding it into a value of type to
+func unsetFields(unset []string, name string, data interface{}, to reflect.Type) []string {
+	for to.Kind() == reflect.Ptr {
+		// the unions are unwrapped as done by decodeUnionHook
+		if union, ok := data.(map[string]interface{}); ok && len(union) == 1 {
+			for _, value := range union {
+				data = value
+			}
+		}
+		to = to.Elem()
+	}
+	if data == nil {
+		return unset
+	}
+	switch to.Kind() {
+	case reflect.Struct:
+		if record, ok := data.(map[string]interface{}); ok {
+			unset = unsetStructFields(unset, name, record, to)
+		}
+	case reflect.Slice, reflect.Array:
+		items, _ := data.([]interface{})
+		for i, item := range items {
+			unset = unsetFields(unset, fmt.Sprintf("%s[%d]", name, i), item, to.Elem())
+		}
+	case reflect.Map:
+		values, _ := data.(map[string]interface{})
+		for key, value := range values {
+			unset = unsetFields(unset, fmt.Sprintf("%s[%s]", name, key), value, to.Elem())
+		}
+	}
+	return unset
+}
+
+func unsetStructFields(unset []string, name string, record map[string]interface{}, to reflect.Type) []string {
+	for _, field := range fieldsOf(to).fields {
+		path := field.name
+		if name != "" {
+			path = name + "." + field.name
+		}
+		value, ok := lookupField(record, field.name)
+		if !ok {
+			unset = append(unset, path)
+			continue
+		}
+		unset = unsetFields(unset, path, value, field.field.Type)
+	}
+	return unset
+}
+
+// lookupField finds the field of a native record matching a struct field, first by its exact name and then
+// case insensitively, as done by mapstructure
+func lookupField(record map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := record[key]; ok {
+		return value, true
+	}
+	for name, value := range record {
+		if strings.EqualFold(name, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func hasTagOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
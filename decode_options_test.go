@@ -0,0 +1,107 @@
+package avro
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const contractSchema = `{"type": "record", "name": "Contract", "fields": [
+	{"name": "name", "type": "string"},
+	{"name": "age", "type": "int"},
+	{"name": "city", "type": "string"},
+	{"name": "attributes", "type": {"type": "map", "values": "long"}},
+	{"name": "lines", "type": {"type": "array", "items": {"type": "record", "name": "Line", "fields": [
+		{"name": "ref", "type": "string"}
+	]}}}
+]}`
+
+type contractLine struct {
+	Ref   string `avro:"ref"`
+	Price int64  `avro:"price"`
+}
+
+type contract struct {
+	Name       string           `avro:"name"`
+	Age        int32            `avro:"age"`
+	Email      string           `avro:"email"`
+	Attributes map[string]int64 `avro:"attributes"`
+	Lines      []contractLine   `avro:"lines"`
+	Ignored    string           `avro:"-"`
+}
+
+type weakContract struct {
+	Age string `avro:"age"`
+}
+
+func newContractPayload(t *testing.T, codec *Codec) []byte {
+	buf, err := codec.Marshal(map[string]interface{}{
+		"name":       "Nico",
+		"age":        36,
+		"city":       "Paris",
+		"attributes": map[string]interface{}{"floor": int64(3)},
+		"lines":      []interface{}{map[string]interface{}{"ref": "l1"}},
+	})
+	require.NoError(t, err)
+	return buf
+}
+
+func TestCodec_UnmarshalMetadata(t *testing.T) {
+	codec, err := NewCodec(contractSchema)
+	require.NoError(t, err)
+	buf := newContractPayload(t, codec)
+
+	var decoded contract
+	metadata, err := codec.UnmarshalMetadata(buf, &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, contract{
+		Name:       "Nico",
+		Age:        36,
+		Attributes: map[string]int64{"floor": 3},
+		Lines:      []contractLine{{Ref: "l1"}},
+	}, decoded)
+	assert.Equal(t, []string{"city"}, metadata.Unused)
+	assert.Equal(t, []string{"email", "lines[0].price"}, metadata.Unset)
+	assert.Contains(t, metadata.Keys, "lines[0].ref")
+}
+
+func TestCodec_DecodeOptions(t *testing.T) {
+	codec, err := NewCodec(contractSchema)
+	require.NoError(t, err)
+	buf := newContractPayload(t, codec)
+
+	// by default, the contract drifts are silently ignored
+	require.NoError(t, codec.Unmarshal(buf, &contract{}))
+	assert.Error(t, codec.Unmarshal(buf, &weakContract{}))
+
+	codec.DecodeOptions = DecodeOptions{ErrorUnused: true}
+	assert.Error(t, codec.Unmarshal(buf, &contract{}))
+
+	codec.DecodeOptions = DecodeOptions{ErrorUnset: true}
+	err = codec.Unmarshal(buf, &contract{})
+	assert.True(t, errors.Is(err, ErrUnsetFields))
+	assert.Contains(t, err.Error(), "email, lines[0].price")
+	require.NoError(t, codec.Unmarshal(buf, &struct {
+		Name  string `avro:"name"`
+		Lines []struct {
+			Ref string `avro:"ref"`
+		} `avro:"lines"`
+	}{}))
+
+	codec.DecodeOptions = DecodeOptions{WeaklyTypedInput: true}
+	var weak weakContract
+	require.NoError(t, codec.Unmarshal(buf, &weak))
+	assert.Equal(t, "36", weak.Age)
+
+	// the maps already set are reused, unless the fields are zeroed
+	reused := contract{Attributes: map[string]int64{"other": 1}}
+	codec.DecodeOptions = DecodeOptions{}
+	require.NoError(t, codec.Unmarshal(buf, &reused))
+	assert.Equal(t, map[string]int64{"floor": 3, "other": 1}, reused.Attributes)
+	zeroed := contract{Attributes: map[string]int64{"other": 1}}
+	codec.DecodeOptions = DecodeOptions{ZeroFields: true}
+	require.NoError(t, codec.Unmarshal(buf, &zeroed))
+	assert.Equal(t, map[string]int64{"floor": 3}, zeroed.Attributes)
+}
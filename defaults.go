@@ -0,0 +1,81 @@
+package avro
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrNoDefault is the error of the empty struct fields omitted by the omitempty tag option
+// while their schema field has no default value to replace them
+var ErrNoDefault = errors.New("the empty field is omitted but has no default value in the schema")
+
+// The empty struct fields tagged with the omitempty option are omitted from the encoded records, the encoding
+// taking the default values of the schema fields instead, at every level of the datum. The default tag option
+// gives the value of the empty fields in the struct tag itself (ex: `avro:"status,default=ACTIVE"`), for the
+// fields of the booleans, numbers and strings types, and of the pointers to these types.
+
+// tagDefault returns the value given by the default option of a struct field tag, converted to the type of the field
+func tagDefault(field reflect.StructField, options []string) (reflect.Value, error) {
+	for _, option := range options {
+		if strings.HasPrefix(option, "default=") {
+			value, err := parseDefault(strings.TrimPrefix(option, "default="), field.Type)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("invalid default value of field %s: %w", field.Name, err)
+			}
+			return value, nil
+		}
+	}
+	return reflect.Value{}, nil
+}
+
+func parseDefault(raw string, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		elem, err := parseDefault(raw, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+	value := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value.SetFloat(f)
+	default:
+		return reflect.Value{}, fmt.Errorf("the type %v can't be given a default value in its tag", t)
+	}
+	return value, nil
+}
+
+// isEmptyValue tells if the value of a struct field is empty, as structs does for the omitempty option
+func isEmptyValue(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
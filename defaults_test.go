@@ -0,0 +1,116 @@
+package avro
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ticketSchema = `{"type": "record", "name": "Ticket", "fields": [
+	{"name": "id", "type": "long", "default": 7},
+	{"name": "status", "type": "string"},
+	{"name": "priority", "type": ["null", "int"], "default": null},
+	{"name": "lines", "type": {"type": "array", "items": {"type": "record", "name": "ticket_line", "fields": [
+		{"name": "ref", "type": "string", "default": "none"},
+		{"name": "quantity", "type": "int"}
+	]}}},
+	{"name": "main", "type": ["null", "ticket_line"], "default": null}
+]}`
+
+type TicketLine struct {
+	Ref      string `avro:"ref,omitempty"`
+	Quantity int32  `avro:"quantity,omitempty"`
+}
+
+type ticket struct {
+	ID       int64        `avro:"id,omitempty"`
+	Status   string       `avro:"status,default=OPEN"`
+	Priority *int32       `avro:"priority,omitempty"`
+	Lines    []TicketLine `avro:"lines"`
+	Main     *TicketLine  `avro:"main"`
+}
+
+func TestCodec_Marshal_omitempty(t *testing.T) {
+	codec, err := NewCodec(ticketSchema)
+	require.NoError(t, err)
+
+	buf, err := codec.Marshal(ticket{
+		Status: "CLOSED",
+		Lines:  []TicketLine{{Quantity: 1}, {Ref: "r2", Quantity: 2}},
+		Main:   &TicketLine{Quantity: 3},
+	})
+	require.NoError(t, err)
+	var native map[string]interface{}
+	require.NoError(t, codec.Unmarshal(buf, &native))
+	assert.Equal(t, map[string]interface{}{
+		"id":       int64(7),
+		"status":   "CLOSED",
+		"priority": nil,
+		"lines": []interface{}{
+			map[string]interface{}{"ref": "none", "quantity": int32(1)},
+			map[string]interface{}{"ref": "r2", "quantity": int32(2)},
+		},
+		"main": map[string]interface{}{"ticket_line": map[string]interface{}{"ref": "none", "quantity": int32(3)}},
+	}, native)
+
+	// the compiled plans encode the omitted fields as the map based path does
+	line, err := NewCodec(`{"type": "record", "name": "ticket_line", "fields": [
+		{"name": "ref", "type": "string", "default": "none"},
+		{"name": "quantity", "type": "int"}
+	]}`)
+	require.NoError(t, err)
+	compiled, err := line.Marshal(TicketLine{Quantity: 1})
+	require.NoError(t, err)
+	expected, err := line.Marshal(map[string]interface{}{"ref": "none", "quantity": 1})
+	require.NoError(t, err)
+	assert.Equal(t, expected, compiled)
+	_, err = line.Marshal(TicketLine{Ref: "r1"})
+	assert.True(t, errors.Is(err, ErrNoDefault))
+}
+
+func TestCodec_Marshal_default_tag(t *testing.T) {
+	codec, err := NewCodec(ticketSchema)
+	require.NoError(t, err)
+
+	buf, err := codec.Marshal(&ticket{Lines: []TicketLine{}})
+	require.NoError(t, err)
+	var decoded ticket
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	assert.Equal(t, "OPEN", decoded.Status)
+
+	_, err = codec.Marshal(struct {
+		Status string `avro:"status"`
+		Lines  []int  `avro:"lines,default=none"`
+	}{})
+	assert.Error(t, err)
+	_, err = codec.Marshal(struct {
+		ID     int64  `avro:"id,default=seven"`
+		Status string `avro:"status"`
+	}{})
+	assert.Contains(t, err.Error(), "invalid default value of field ID")
+}
+
+func TestCodec_Marshal_omitempty_without_default(t *testing.T) {
+	codec, err := NewCodec(ticketSchema)
+	require.NoError(t, err)
+
+	_, err = codec.Marshal(ticket{Lines: []TicketLine{{Ref: "r1", Quantity: 1}, {Ref: "r2"}}})
+	fieldErr := requireFieldError(t, err)
+	assert.True(t, errors.Is(err, ErrNoDefault))
+	assert.Equal(t, "lines[1].quantity", fieldErr.Path)
+	assert.Equal(t, int32(0), fieldErr.Value)
+
+	_, err = codec.Marshal(ticket{Lines: []TicketLine{}, Main: &TicketLine{Ref: "r1"}})
+	fieldErr = requireFieldError(t, err)
+	assert.True(t, errors.Is(err, ErrNoDefault))
+	assert.Equal(t, "main.quantity", fieldErr.Path)
+
+	err = codec.CheckType(reflect.TypeOf(ticket{}))
+	byPath := mismatches(t, err)
+	// the records of the same type are reported once
+	assert.Len(t, byPath, 1)
+	assert.True(t, errors.Is(byPath["lines[].quantity"], ErrNoDefault))
+}
@@ -0,0 +1,499 @@
+package avro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/leboncoin/avrocado/internal/schema"
+	"github.com/linkedin/goavro/v2"
+	"github.com/mitchellh/mapstructure"
+)
+
+// FieldError is an encoding or a decoding error located on a field of the datum.
+// It wraps the error of goavro or of mapstructure, and is returned by Marshal and Unmarshal when
+// the failing field can be found: use errors.As to get it.
+type FieldError struct {
+	// Path is the path of the field from the root of the datum, ex: "items[3].price", empty for the root itself
+	Path string
+	// GoType is the type of the Go value, nil when unknown
+	GoType reflect.Type
+	// AvroType is the avro type expected for the field, ex: "int", "[null, string]" or "record test.Item"
+	AvroType string
+	// Value is the offending value, nil when unknown (ex: for the truncated payloads)
+	Value interface{}
+	// Err is the underlying error
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "<root>"
+	}
+	return fmt.Sprintf("field %s (Go type %v, avro type %s): %v", path, e.GoType, e.AvroType, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func newFieldError(path string, s *schema.Schema, goType reflect.Type, value interface{}, err error) *FieldError {
+	return &FieldError{Path: path, GoType: goType, AvroType: avroTypeString(s), Value: value, Err: err}
+}
+
+// avroTypeString describes an avro type in the errors
+func avroTypeString(s *schema.Schema) string {
+	switch s.Type {
+	case schema.Array:
+		return "array<" + avroTypeString(s.Items) + ">"
+	case schema.Map:
+		return "map<" + avroTypeString(s.Values) + ">"
+	case schema.Union:
+		branches := make([]string, len(s.Branches))
+		for i, branch := range s.Branches {
+			branches[i] = avroTypeString(branch)
+		}
+		return "[" + strings.Join(branches, ", ") + "]"
+	}
+	name := string(s.Type)
+	if s.IsNamed() {
+		name += " " + s.FullName()
+	}
+	if s.LogicalType != "" {
+		name += " (" + s.LogicalType + ")"
+	}
+	return name
+}
+
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func indexPath(path string, index int) string {
+	return path + "[" + strconv.Itoa(index) + "]"
+}
+
+func keyPath(path, key string) string {
+	return path + "[" + key + "]"
+}
+
+// leafCodec returns a goavro codec for a schema which is neither a record, an union, an array nor a map
+func leafCodec(s *schema.Schema) (*goavro.Codec, error) {
+	spec := map[string]interface{}{"type": string(s.Type)}
+	switch s.Type {
+	case schema.Enum:
+		spec["name"], spec["symbols"] = s.FullName(), s.Symbols
+	case schema.Fixed:
+		spec["name"], spec["size"] = s.FullName(), s.Size
+	}
+	if s.LogicalType != "" {
+		spec["logicalType"] = s.LogicalType
+		if s.Precision > 0 {
+			spec["precision"], spec["scale"] = s.Precision, s.Scale
+		}
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	return goavro.NewCodec(string(raw))
+}
+
+// encodeError locates the field making the encoding of data fail, its native form being given to goavro
+func (c *Codec) encodeError(err error, data, native interface{}) error {
+	if c.parsed == nil {
+		return err
+	}
+	fieldErr := locateEncodeError(c.parsed, native, reflect.ValueOf(data), "")
+	if fieldErr == nil {
+		return err
+	}
+	if fieldErr.Err == nil {
+		fieldErr.Err = err
+	}
+	return fieldErr
+}
+
+// locateEncodeError walks the native datum as goavro does to encode it, along with the Go value it was built from
+func locateEncodeError(s *schema.Schema, native interface{}, goValue reflect.Value, path string) *FieldError {
+	goValue = indirectValue(goValue)
+	mismatch := func(err error) *FieldError {
+		if goValue.IsValid() && goValue.CanInterface() {
+			return newFieldError(path, s, goValue.Type(), goValue.Interface(), err)
+		}
+		var goType reflect.Type
+		if native != nil {
+			goType = reflect.TypeOf(native)
+		}
+		return newFieldError(path, s, goType, native, err)
+	}
+
+	switch s.Type {
+	case schema.Union:
+		if native == nil {
+			for _, branch := range s.Branches {
+				if branch.Type == schema.Null {
+					return nil
+				}
+			}
+		} else if union, ok := native.(map[string]interface{}); ok && len(union) == 1 {
+			for name, value := range union {
+				for _, branch := range s.Branches {
+					if branch.BranchName() == name {
+						// the explicit unions are given as they are passed to goavro
+						if goValue.Kind() == reflect.Map && goValue.Len() == 1 {
+							goValue = goMapValue(goValue, name)
+						}
+						return locateEncodeError(branch, value, goValue, path)
+					}
+				}
+			}
+		}
+		return mismatch(nil)
+	case schema.Record, schema.Error:
+		record, ok := native.(map[string]interface{})
+		if !ok {
+			return mismatch(nil)
+		}
+		for _, f := range s.Fields {
+			value, ok := record[f.Name]
+			goField := goFieldValue(goValue, f.Name)
+			if !ok {
+				if f.HasDefault {
+					continue
+				}
+				if goField.IsValid() {
+					// the struct field is omitted by the omitempty tag option
+					return newFieldError(fieldPath(path, f.Name), f.Type, goField.Type(), goField.Interface(), ErrNoDefault)
+				}
+				return newFieldError(fieldPath(path, f.Name), f.Type, nil, nil, ErrMissingField)
+			}
+			if fieldErr := locateEncodeError(f.Type, value, goField, fieldPath(path, f.Name)); fieldErr != nil {
+				return fieldErr
+			}
+		}
+		return nil
+	case schema.Array:
+		items := reflect.ValueOf(native)
+		if items.Kind() != reflect.Slice {
+			return mismatch(nil)
+		}
+		for i := 0; i < items.Len(); i++ {
+			fieldErr := locateEncodeError(s.Items, items.Index(i).Interface(), goIndexValue(goValue, i), indexPath(path, i))
+			if fieldErr != nil {
+				return fieldErr
+			}
+		}
+		return nil
+	case schema.Map:
+		values := reflect.ValueOf(native)
+		if values.Kind() != reflect.Map || values.Type().Key().Kind() != reflect.String {
+			return mismatch(nil)
+		}
+		keys := make([]string, 0, values.Len())
+		for _, key := range values.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := values.MapIndex(reflect.ValueOf(key).Convert(values.Type().Key())).Interface()
+			fieldErr := locateEncodeError(s.Values, value, goMapValue(goValue, key), keyPath(path, key))
+			if fieldErr != nil {
+				return fieldErr
+			}
+		}
+		return nil
+	}
+	codec, err := leafCodec(s)
+	if err != nil {
+		return nil
+	}
+	if _, err := codec.BinaryFromNative(nil, native); err != nil {
+		return mismatch(err)
+	}
+	return nil
+}
+
+// decodeError locates the field making the decoding of the binary datum fail
+func (c *Codec) decodeError(err error, avro []byte, output interface{}) error {
+	if c.parsed == nil {
+		return err
+	}
+	_, fieldErr := locateDecodeError(c.parsed, avro, outputType(output), "")
+	if fieldErr == nil {
+		return err
+	}
+	if fieldErr.Err == nil {
+		fieldErr.Err = err
+	}
+	return fieldErr
+}
+
+// locateDecodeError walks the binary datum as goavro does to decode it, along with the Go type it is decoded to
+func locateDecodeError(s *schema.Schema, buf []byte, goType reflect.Type, path string) ([]byte, *FieldError) {
+	goType = indirectType(goType)
+	switch s.Type {
+	case schema.Union:
+		index, rest, err := readLong(buf)
+		if err != nil || index < 0 || index >= int64(len(s.Branches)) {
+			return nil, newFieldError(path, s, goType, nil, nil)
+		}
+		return locateDecodeError(s.Branches[index], rest, goType, path)
+	case schema.Record, schema.Error:
+		for _, f := range s.Fields {
+			var fieldErr *FieldError
+			buf, fieldErr = locateDecodeError(f.Type, buf, goFieldType(goType, f.Name), fieldPath(path, f.Name))
+			if fieldErr != nil {
+				return nil, fieldErr
+			}
+		}
+		return buf, nil
+	case schema.Array, schema.Map:
+		for index := 0; ; {
+			count, rest, err := readBlockCount(buf)
+			if err != nil {
+				return nil, newFieldError(path, s, goType, nil, nil)
+			}
+			buf = rest
+			if count == 0 {
+				return buf, nil
+			}
+			for ; count > 0; count-- {
+				var fieldErr *FieldError
+				if s.Type == schema.Array {
+					buf, fieldErr = locateDecodeError(s.Items, buf, goElemType(goType), indexPath(path, index))
+				} else {
+					var key []byte
+					if key, buf, err = readBytes(buf); err != nil {
+						return nil, newFieldError(path, s, goType, nil, nil)
+					}
+					buf, fieldErr = locateDecodeError(s.Values, buf, goElemType(goType), keyPath(path, string(key)))
+				}
+				if fieldErr != nil {
+					return nil, fieldErr
+				}
+				index++
+			}
+		}
+	}
+	codec, err := leafCodec(s)
+	if err != nil {
+		return nil, newFieldError(path, s, goType, nil, nil)
+	}
+	_, rest, err := codec.NativeFromBinary(buf)
+	if err != nil {
+		return nil, newFieldError(path, s, goType, nil, err)
+	}
+	return rest, nil
+}
+
+// mapstructureName finds the name of the field in the errors of mapstructure, ex: "'items[3].price' expected type ..."
+var mapstructureName = regexp.MustCompile(`^(?:error decoding )?'([^']*)'`)
+
+// convertError locates the field which mapstructure failed to convert from the native datum
+func (c *Codec) convertError(err error, native interface{}, output interface{}) error {
+	var decodeErr *mapstructure.Error
+	if c.parsed == nil || !errors.As(err, &decodeErr) || len(decodeErr.Errors) == 0 {
+		return err
+	}
+	match := mapstructureName.FindStringSubmatch(decodeErr.Errors[0])
+	if match == nil {
+		return err
+	}
+	path, s, value, goType, ok := resolvePath(c.parsed, native, outputType(output), match[1])
+	if !ok {
+		return err
+	}
+	return newFieldError(path, s, goType, value, err)
+}
+
+// resolvePath finds the path in the datum, the schema, the native value and the Go type of a field from its path
+// named as mapstructure does, which holds the keys of the inlined structs
+func resolvePath(s *schema.Schema, native interface{}, goType reflect.Type, mapstructurePath string) (string, *schema.Schema, interface{}, reflect.Type, bool) {
+	var path string
+	for rest := mapstructurePath; rest != ""; {
+		var step string
+		isIndex := rest[0] == '['
+		if isIndex {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return "", nil, nil, nil, false
+			}
+			step, rest = rest[1:end], rest[end+1:]
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			step, rest = rest[:end], rest[end:]
+		}
+		rest = strings.TrimPrefix(rest, ".")
+
+		s, native = unwrapUnion(s, native)
+		goType = indirectType(goType)
+		if !isIndex && goType != nil && goType.Kind() == reflect.Struct && fieldsOf(goType).isNestKey(step) {
+			// the fields of the inlined structs are looked up in the struct holding them
+			continue
+		}
+		if isIndex {
+			path = keyPath(path, step)
+		} else {
+			path = fieldPath(path, step)
+		}
+		switch {
+		case !isIndex && s.IsRecord():
+			f := lookupSchemaField(s, step)
+			if f == nil {
+				return "", nil, nil, nil, false
+			}
+			record, _ := native.(map[string]interface{})
+			s, native, goType = f.Type, record[f.Name], goFieldType(goType, step)
+		case isIndex && s.Type == schema.Array:
+			index, err := strconv.Atoi(step)
+			items, _ := native.([]interface{})
+			if err != nil || index < 0 || index >= len(items) {
+				return "", nil, nil, nil, false
+			}
+			s, native, goType = s.Items, items[index], goElemType(goType)
+		case isIndex && s.Type == schema.Map:
+			values, _ := native.(map[string]interface{})
+			s, native, goType = s.Values, values[step], goElemType(goType)
+		default:
+			return "", nil, nil, nil, false
+		}
+	}
+	return path, s, native, goType, true
+}
+
+// unwrapUnion returns the branch of an union holding the native value, and the value itself
+func unwrapUnion(s *schema.Schema, native interface{}) (*schema.Schema, interface{}) {
+	if s.Type != schema.Union {
+		return s, native
+	}
+	if union, ok := native.(map[string]interface{}); ok && len(union) == 1 {
+		for name, value := range union {
+			for _, branch := range s.Branches {
+				if branch.BranchName() == name {
+					return branch, value
+				}
+			}
+		}
+	}
+	for _, branch := range s.Branches {
+		if branch.Type != schema.Null {
+			return branch, native
+		}
+	}
+	return s, native
+}
+
+// lookupSchemaField finds a record field by its name, first exactly and then case insensitively as mapstructure does
+func lookupSchemaField(s *schema.Schema, name string) *schema.Field {
+	if f := s.Field(name); f != nil {
+		return f
+	}
+	for _, f := range s.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func outputType(output interface{}) reflect.Type {
+	t := reflect.TypeOf(output)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil
+	}
+	return t.Elem()
+}
+
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// goStructField finds the field of a struct type encoded or decoded under the given avro name,
+// its index being the index sequence of the promoted fields
+func goStructField(t reflect.Type, name string) (reflect.StructField, bool) {
+	f, ok := fieldsOf(t).lookup(name)
+	if !ok {
+		return reflect.StructField{}, false
+	}
+	field := f.field
+	field.Index = f.index
+	return field, true
+}
+
+func goFieldValue(v reflect.Value, name string) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		if field, ok := goStructField(v.Type(), name); ok {
+			return fieldByIndex(v, field.Index, false)
+		}
+	case reflect.Map:
+		return goMapValue(v, name)
+	}
+	return reflect.Value{}
+}
+
+func goIndexValue(v reflect.Value, index int) reflect.Value {
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && index < v.Len() {
+		return v.Index(index)
+	}
+	return reflect.Value{}
+}
+
+func goMapValue(v reflect.Value, key string) reflect.Value {
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return reflect.Value{}
+	}
+	return v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+}
+
+func goFieldType(t reflect.Type, name string) reflect.Type {
+	t = indirectType(t)
+	if t == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if field, ok := goStructField(t, name); ok {
+			return field.Type
+		}
+	case reflect.Map:
+		return t.Elem()
+	}
+	return nil
+}
+
+func goElemType(t reflect.Type) reflect.Type {
+	t = indirectType(t)
+	if t == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return t.Elem()
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package avro
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const orderSchema = `{"type": "record", "name": "Order", "namespace": "test", "fields": [
+	{"name": "id", "type": "long"},
+	{"name": "items", "type": {"type": "array", "items": {"type": "record", "name": "Item", "fields": [
+		{"name": "ref", "type": "string"},
+		{"name": "price", "type": "int"}
+	]}}},
+	{"name": "attributes", "type": {"type": "map", "values": "long"}},
+	{"name": "note", "type": ["null", "string"], "default": null}
+]}`
+
+type fieldOrderItem struct {
+	Ref   string      `avro:"ref"`
+	Price interface{} `avro:"price"`
+}
+
+type fieldOrder struct {
+	ID         int64                  `avro:"id"`
+	Items      []fieldOrderItem       `avro:"items"`
+	Attributes map[string]interface{} `avro:"attributes"`
+	Note       interface{}            `avro:"note"`
+}
+
+func requireFieldError(t *testing.T, err error) *FieldError {
+	var fieldErr *FieldError
+	require.True(t, errors.As(err, &fieldErr), "%v is not a FieldError", err)
+	return fieldErr
+}
+
+func TestCodec_Marshal_FieldError(t *testing.T) {
+	codec, err := NewCodec(orderSchema)
+	require.NoError(t, err)
+
+	valid := fieldOrder{
+		ID:         1,
+		Items:      []fieldOrderItem{{Ref: "a", Price: 10}, {Ref: "b", Price: 20}},
+		Attributes: map[string]interface{}{"floor": int64(3)},
+	}
+	_, err = codec.Marshal(valid)
+	require.NoError(t, err)
+
+	invalid := valid
+	invalid.Items = []fieldOrderItem{{Ref: "a", Price: 10}, {Ref: "b", Price: "twenty"}}
+	_, err = codec.Marshal(&invalid)
+	fieldErr := requireFieldError(t, err)
+	assert.Equal(t, "items[1].price", fieldErr.Path)
+	assert.Equal(t, reflect.TypeOf(""), fieldErr.GoType)
+	assert.Equal(t, "int", fieldErr.AvroType)
+	assert.Equal(t, "twenty", fieldErr.Value)
+	assert.Contains(t, err.Error(), "field items[1].price (Go type string, avro type int): cannot encode binary int")
+
+	invalid = valid
+	invalid.Attributes = map[string]interface{}{"floor": "third"}
+	_, err = codec.Marshal(invalid)
+	fieldErr = requireFieldError(t, err)
+	assert.Equal(t, "attributes[floor]", fieldErr.Path)
+	assert.Equal(t, "long", fieldErr.AvroType)
+
+	invalid = valid
+	invalid.Note = map[string]interface{}{"int": 1}
+	_, err = codec.Marshal(invalid)
+	fieldErr = requireFieldError(t, err)
+	assert.Equal(t, "note", fieldErr.Path)
+	assert.Equal(t, "[null, string]", fieldErr.AvroType)
+	assert.Equal(t, map[string]interface{}{"int": 1}, fieldErr.Value)
+
+	_, err = codec.Marshal(struct {
+		ID int64 `avro:"id"`
+	}{1})
+	fieldErr = requireFieldError(t, err)
+	assert.Equal(t, "items", fieldErr.Path)
+	assert.Nil(t, fieldErr.GoType)
+	assert.Equal(t, "array<record test.Item>", fieldErr.AvroType)
+}
+
+func TestCodec_Unmarshal_FieldError(t *testing.T) {
+	codec, err := NewCodec(orderSchema)
+	require.NoError(t, err)
+	buf, err := codec.Marshal(fieldOrder{
+		ID:         1,
+		Items:      []fieldOrderItem{{Ref: "a", Price: 10}, {Ref: "b", Price: 20}},
+		Attributes: map[string]interface{}{},
+	})
+	require.NoError(t, err)
+
+	// the truncated payloads
+	_, err = codec.UnmarshalNext(buf[:6], &fieldOrder{})
+	fieldErr := requireFieldError(t, err)
+	assert.Equal(t, "items[1].ref", fieldErr.Path)
+	assert.Equal(t, reflect.TypeOf(""), fieldErr.GoType)
+	assert.Equal(t, "string", fieldErr.AvroType)
+
+	// the values which can't be converted to the Go types
+	var mismatch struct {
+		Items []struct {
+			Price []string `avro:"price"`
+		} `avro:"items"`
+	}
+	err = codec.Unmarshal(buf, &mismatch)
+	fieldErr = requireFieldError(t, err)
+	assert.Equal(t, "items[0].price", fieldErr.Path)
+	assert.Equal(t, reflect.TypeOf([]string{}), fieldErr.GoType)
+	assert.Equal(t, "int", fieldErr.AvroType)
+	assert.Equal(t, int32(10), fieldErr.Value)
+}
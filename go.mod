@@ -1,13 +1,12 @@
 module github.com/leboncoin/avrocado
 
-go 1.12
+go 1.13
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fatih/camelcase v1.0.0
 	github.com/leboncoin/structs v0.0.0-20180308133606-9809b6d3fc5a
-	github.com/linkedin/goavro/v2 v2.9.8
+	github.com/linkedin/goavro/v2 v2.9.8 // the stream Decoder detects the truncated datums from its error messages
 	github.com/mitchellh/mapstructure v1.1.2
-	github.com/pkg/errors v0.8.1 // indirect
 	github.com/stretchr/testify v1.3.0
 )
@@ -0,0 +1,131 @@
+package schema
+
+import "fmt"
+
+// CanRead checks, following the avro schema resolution rules, that data written with the
+// writer schema can be read with the reader schema. The returned error describes the first
+// incompatibility found.
+func CanRead(reader, writer *Schema) error {
+	r := resolver{seen: make(map[[2]*Schema]bool)}
+	return r.canRead(reader, writer, "")
+}
+
+type resolver struct {
+	// seen holds the pairs of named types being checked, to stop on recursive schemas
+	seen map[[2]*Schema]bool
+}
+
+var promotions = map[Type][]Type{
+	Int:    {Long, Float, Double},
+	Long:   {Float, Double},
+	Float:  {Double},
+	String: {Bytes},
+	Bytes:  {String},
+}
+
+func (r *resolver) canRead(reader, writer *Schema, path string) error {
+	if writer.Type == Union {
+		for _, branch := range writer.Branches {
+			if err := r.canRead(reader, branch, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if reader.Type == Union {
+		for _, branch := range reader.Branches {
+			if r.canRead(branch, writer, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: no branch of the reader union matches the writer type %s", pathOrRoot(path), writer.BranchName())
+	}
+
+	if reader.Type != writer.Type && !(reader.IsRecord() && writer.IsRecord()) {
+		for _, promoted := range promotions[writer.Type] {
+			if promoted == reader.Type {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: the writer type %s can't be read as %s", pathOrRoot(path), writer.Type, reader.Type)
+	}
+
+	if reader.IsNamed() {
+		pair := [2]*Schema{reader, writer}
+		if r.seen[pair] {
+			return nil
+		}
+		r.seen[pair] = true
+		if !reader.HasName(writer.FullName()) && !reader.HasName(writer.Name) {
+			return fmt.Errorf("%s: the writer name %s doesn't match the reader name %s", pathOrRoot(path), writer.FullName(), reader.FullName())
+		}
+	}
+
+	switch reader.Type {
+	case Record, Error:
+		for _, readerField := range reader.Fields {
+			fieldPath := joinPath(path, readerField.Name)
+			writerField := writerFieldFor(writer, readerField)
+			if writerField == nil {
+				if !readerField.HasDefault {
+					return fmt.Errorf("%s: the field is missing from the writer schema and has no default", fieldPath)
+				}
+				continue
+			}
+			if err := r.canRead(readerField.Type, writerField.Type, fieldPath); err != nil {
+				return err
+			}
+		}
+	case Enum:
+		if reader.EnumDefault != "" {
+			return nil
+		}
+		for _, symbol := range writer.Symbols {
+			if !contains(reader.Symbols, symbol) {
+				return fmt.Errorf("%s: the writer symbol %s is missing from the reader enum", pathOrRoot(path), symbol)
+			}
+		}
+	case Fixed:
+		if reader.Size != writer.Size {
+			return fmt.Errorf("%s: the writer fixed size %d differs from the reader size %d", pathOrRoot(path), writer.Size, reader.Size)
+		}
+	case Array:
+		return r.canRead(reader.Items, writer.Items, path+"[]")
+	case Map:
+		return r.canRead(reader.Values, writer.Values, path+"{}")
+	}
+	return nil
+}
+
+// writerFieldFor returns the writer field matching a reader field by its name or aliases
+func writerFieldFor(writer *Schema, readerField *Field) *Field {
+	for _, f := range writer.Fields {
+		if readerField.HasName(f.Name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "<root>"
+	}
+	return path
+}
+
+func contains(list []string, value string) bool {
+	for _, elem := range list {
+		if elem == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(t *testing.T, spec string) *Schema {
+	s, err := Parse(spec)
+	require.NoError(t, err)
+	return s
+}
+
+func TestCanRead(t *testing.T) {
+	v1 := `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}]}`
+	v2 := `{"type": "record", "name": "user", "fields": [
+	  {"name": "name", "type": "string"},
+	  {"name": "age", "type": "int", "default": 0}
+	]}`
+	v3 := `{"type": "record", "name": "user", "fields": [
+	  {"name": "name", "type": "string"},
+	  {"name": "age", "type": "long"}
+	]}`
+	renamed := `{"type": "record", "name": "user", "fields": [{"name": "full_name", "type": "string", "aliases": ["name"]}]}`
+	recursive := `{"type": "record", "name": "node", "fields": [{"name": "next", "type": ["null", "node"]}]}`
+
+	tests := []struct {
+		name       string
+		reader     string
+		writer     string
+		compatible bool
+	}{
+		{"same", v1, v1, true},
+		{"added field with default", v2, v1, true},
+		{"removed field", v1, v2, true},
+		{"added field without default", v3, v1, false},
+		{"int promoted to long", v3, v2, true},
+		{"long not demoted to int", v2, v3, false},
+		{"field alias", renamed, v1, true},
+		{"different records", `{"type": "record", "name": "other", "fields": []}`, v1, false},
+		{"union reader", `["null", "long"]`, `"int"`, true},
+		{"union writer", `"long"`, `["null", "long"]`, false},
+		{"enum symbols", `{"type": "enum", "name": "e", "symbols": ["a", "b"]}`, `{"type": "enum", "name": "e", "symbols": ["a"]}`, true},
+		{"enum missing symbol", `{"type": "enum", "name": "e", "symbols": ["a"]}`, `{"type": "enum", "name": "e", "symbols": ["a", "b"]}`, false},
+		{"enum default", `{"type": "enum", "name": "e", "symbols": ["a"], "default": "a"}`, `{"type": "enum", "name": "e", "symbols": ["a", "b"]}`, true},
+		{"fixed size", `{"type": "fixed", "name": "f", "size": 4}`, `{"type": "fixed", "name": "f", "size": 8}`, false},
+		{"array items", `{"type": "array", "items": "double"}`, `{"type": "array", "items": "float"}`, true},
+		{"map values", `{"type": "map", "values": "int"}`, `{"type": "map", "values": "string"}`, false},
+		{"recursive", recursive, recursive, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CanRead(mustParse(t, tt.reader), mustParse(t, tt.writer))
+			if tt.compatible {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+// Package schema parses avro schema specifications into a tree which can be
+// walked by the encoders, the decoders and the tools of the avro package.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Type is the avro type of a schema node
+type Type string
+
+// The avro types
+const (
+	Null    Type = "null"
+	Boolean Type = "boolean"
+	Int     Type = "int"
+	Long    Type = "long"
+	Float   Type = "float"
+	Double  Type = "double"
+	Bytes   Type = "bytes"
+	String  Type = "string"
+	Record  Type = "record"
+	Error   Type = "error"
+	Enum    Type = "enum"
+	Array   Type = "array"
+	Map     Type = "map"
+	Union   Type = "union"
+	Fixed   Type = "fixed"
+)
+
+var primitives = map[string]Type{
+	"null":    Null,
+	"boolean": Boolean,
+	"int":     Int,
+	"long":    Long,
+	"float":   Float,
+	"double":  Double,
+	"bytes":   Bytes,
+	"string":  String,
+}
+
+// Schema is a node of a parsed avro schema.
+// Named types referenced several times are parsed once and shared, hence a
+// recursive schema yields a cyclic tree.
+type Schema struct {
+	Type      Type
+	Name      string
+	Namespace string
+	// Aliases are the full names under which the named type is also known
+	Aliases []string
+	Doc     string
+
+	// Fields of a record
+	Fields []*Field
+	// Symbols of an enum, and the optional default symbol
+	Symbols     []string
+	EnumDefault string
+	// Items of an array
+	Items *Schema
+	// Values of a map
+	Values *Schema
+	// Branches of an union
+	Branches []*Schema
+	// Size of a fixed
+	Size int
+
+	LogicalType string
+	Precision   int
+	Scale       int
+}
+
+// Field is a field of a record
+type Field struct {
+	Name       string
+	Aliases    []string
+	Doc        string
+	Type       *Schema
+	Default    interface{}
+	HasDefault bool
+}
+
+// FullName returns the namespace qualified name of a named type
+func (s *Schema) FullName() string {
+	if s.Namespace == "" {
+		return s.Name
+	}
+	return s.Namespace + "." + s.Name
+}
+
+// IsNamed tells if the type is a record, an enum or a fixed
+func (s *Schema) IsNamed() bool {
+	switch s.Type {
+	case Record, Error, Enum, Fixed:
+		return true
+	}
+	return false
+}
+
+// IsRecord tells if the type is a record (or an error)
+func (s *Schema) IsRecord() bool {
+	return s.Type == Record || s.Type == Error
+}
+
+// BranchName is the name used to identify the schema inside an union, as done by goavro:
+// the full name of named types and the type name otherwise
+func (s *Schema) BranchName() string {
+	if s.IsNamed() {
+		return s.FullName()
+	}
+	return string(s.Type)
+}
+
+// HasName tells if the named type is known under the given name, either
+// as a full name, a short name or one of its aliases
+func (s *Schema) HasName(name string) bool {
+	if !s.IsNamed() {
+		return string(s.Type) == name
+	}
+	if name == s.FullName() || name == s.Name {
+		return true
+	}
+	for _, alias := range s.Aliases {
+		if name == alias || name == shortName(alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// Field returns the field of a record by its name
+func (s *Schema) Field(name string) *Field {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// HasName tells if the field is known under the given name or one of its aliases
+func (f *Field) HasName(name string) bool {
+	if f.Name == name {
+		return true
+	}
+	for _, alias := range f.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+func shortName(fullName string) string {
+	if idx := strings.LastIndexByte(fullName, '.'); idx >= 0 {
+		return fullName[idx+1:]
+	}
+	return fullName
+}
+
+// Parse parses an avro schema specification
+func Parse(spec string) (*Schema, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(spec)))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("json.Decode error: %w", err)
+	}
+	p := parser{names: make(map[string]*Schema)}
+	return p.parse(raw, "")
+}
+
+type parser struct {
+	names map[string]*Schema
+}
+
+func (p *parser) parse(raw interface{}, namespace string) (*Schema, error) {
+	switch v := raw.(type) {
+	case string:
+		return p.reference(v, namespace)
+	case []interface{}:
+		s := &Schema{Type: Union}
+		for _, branch := range v {
+			b, err := p.parse(branch, namespace)
+			if err != nil {
+				return nil, err
+			}
+			s.Branches = append(s.Branches, b)
+		}
+		return s, nil
+	case map[string]interface{}:
+		return p.parseObject(v, namespace)
+	}
+	return nil, fmt.Errorf("unexpected schema %v", raw)
+}
+
+func (p *parser) reference(name, namespace string) (*Schema, error) {
+	if t, ok := primitives[name]; ok {
+		return &Schema{Type: t}, nil
+	}
+	if !strings.Contains(name, ".") && namespace != "" {
+		if s, ok := p.names[namespace+"."+name]; ok {
+			return s, nil
+		}
+	}
+	if s, ok := p.names[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown type name %q", name)
+}
+
+func (p *parser) parseObject(obj map[string]interface{}, namespace string) (*Schema, error) {
+	typ, ok := obj["type"].(string)
+	if !ok {
+		// the type itself is a schema (ex: {"type": {"type": "array", ...}})
+		if inner, exists := obj["type"]; exists {
+			return p.parse(inner, namespace)
+		}
+		return nil, fmt.Errorf("missing type in %v", obj)
+	}
+
+	var s *Schema
+	switch Type(typ) {
+	case Record, Error, Enum, Fixed:
+		named, err := p.declare(Type(typ), obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+		s = named
+	case Array:
+		items, err := p.parse(obj["items"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("array items: %w", err)
+		}
+		s = &Schema{Type: Array, Items: items}
+	case Map:
+		values, err := p.parse(obj["values"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("map values: %w", err)
+		}
+		s = &Schema{Type: Map, Values: values}
+	default:
+		ref, err := p.reference(typ, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if ref.IsNamed() {
+			return ref, nil
+		}
+		s = ref
+	}
+
+	s.LogicalType, _ = obj["logicalType"].(string)
+	s.Precision = toInt(obj["precision"])
+	s.Scale = toInt(obj["scale"])
+	s.Doc, _ = obj["doc"].(string)
+	return s, nil
+}
+
+func (p *parser) declare(typ Type, obj map[string]interface{}, namespace string) (*Schema, error) {
+	name, _ := obj["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%s without name", typ)
+	}
+	if ns, ok := obj["namespace"].(string); ok {
+		namespace = ns
+	}
+	s := &Schema{Type: typ, Name: name, Namespace: namespace}
+	if idx := strings.LastIndexByte(name, '.'); idx >= 0 {
+		s.Namespace = name[:idx]
+		s.Name = name[idx+1:]
+	}
+	for _, alias := range toStrings(obj["aliases"]) {
+		if !strings.Contains(alias, ".") && s.Namespace != "" {
+			alias = s.Namespace + "." + alias
+		}
+		s.Aliases = append(s.Aliases, alias)
+	}
+	if _, exists := p.names[s.FullName()]; exists {
+		return nil, fmt.Errorf("type %q is defined twice", s.FullName())
+	}
+	p.names[s.FullName()] = s
+
+	switch typ {
+	case Enum:
+		s.Symbols = toStrings(obj["symbols"])
+		s.EnumDefault, _ = obj["default"].(string)
+	case Fixed:
+		s.Size = toInt(obj["size"])
+	default:
+		rawFields, _ := obj["fields"].([]interface{})
+		for _, rawField := range rawFields {
+			fieldObj, ok := rawField.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid field %v in %s", rawField, s.FullName())
+			}
+			fieldName, _ := fieldObj["name"].(string)
+			fieldType, err := p.parse(fieldObj["type"], s.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("field %s.%s: %w", s.FullName(), fieldName, err)
+			}
+			def, hasDefault := fieldObj["default"]
+			doc, _ := fieldObj["doc"].(string)
+			s.Fields = append(s.Fields, &Field{
+				Name:       fieldName,
+				Aliases:    toStrings(fieldObj["aliases"]),
+				Doc:        doc,
+				Type:       fieldType,
+				Default:    def,
+				HasDefault: hasDefault,
+			})
+		}
+	}
+	return s, nil
+}
+
+func toStrings(raw interface{}) []string {
+	list, _ := raw.([]interface{})
+	var out []string
+	for _, elem := range list {
+		if s, ok := elem.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func toInt(raw interface{}) int {
+	if n, ok := raw.(json.Number); ok {
+		i, _ := n.Int64()
+		return int(i)
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse(`{
+	  "type": "record",
+	  "name": "user",
+	  "namespace": "my.example",
+	  "aliases": ["person"],
+	  "fields": [
+	    {"name": "name", "type": "string", "aliases": ["full_name"]},
+	    {"name": "age", "type": ["null", "int"], "default": null},
+	    {"name": "kind", "type": {"type": "enum", "name": "kind", "symbols": ["a", "b"]}},
+	    {"name": "tags", "type": {"type": "array", "items": "kind"}},
+	    {"name": "friends", "type": {"type": "map", "values": "user"}},
+	    {"name": "id", "type": {"type": "fixed", "name": "other.uuid", "size": 16}},
+	    {"name": "created_at", "type": {"type": "long", "logicalType": "timestamp-millis"}}
+	  ]
+	}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, Record, s.Type)
+	assert.Equal(t, "my.example.user", s.FullName())
+	assert.True(t, s.HasName("my.example.person"))
+	assert.True(t, s.HasName("user"))
+	require.Len(t, s.Fields, 7)
+
+	assert.True(t, s.Field("name").HasName("full_name"))
+	assert.Equal(t, String, s.Field("name").Type.Type)
+
+	age := s.Field("age")
+	assert.True(t, age.HasDefault)
+	assert.Nil(t, age.Default)
+	require.Len(t, age.Type.Branches, 2)
+	assert.Equal(t, "null", age.Type.Branches[0].BranchName())
+
+	kind := s.Field("kind").Type
+	assert.Equal(t, "my.example.kind", kind.BranchName())
+	assert.Equal(t, []string{"a", "b"}, kind.Symbols)
+	assert.True(t, kind == s.Field("tags").Type.Items)
+	assert.True(t, s == s.Field("friends").Type.Values)
+
+	id := s.Field("id").Type
+	assert.Equal(t, "other.uuid", id.FullName())
+	assert.Equal(t, 16, id.Size)
+
+	assert.Equal(t, "timestamp-millis", s.Field("created_at").Type.LogicalType)
+}
+
+func TestParse_errors(t *testing.T) {
+	for _, spec := range []string{
+		`{`,
+		`"unknown"`,
+		`{"type": "record"}`,
+		`{"type": "record", "name": "a", "fields": [{"name": "b", "type": "a"}, {"name": "c", "type": {"type": "enum", "name": "a", "symbols": []}}]}`,
+	} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 )
 
 // DefaultURL is the address where a local schema registry listens by default.
@@ -18,8 +19,14 @@ var DefaultURL = "http://localhost:8081"
 
 // These numbers are used by the schema registry to communicate errors.
 const (
-	schemaNotFound  = 40403
-	subjectNotFound = 40401
+	ErrorCodeSubjectNotFound    = 40401
+	ErrorCodeVersionNotFound    = 40402
+	ErrorCodeSchemaNotFound     = 40403
+	ErrorCodeIncompatibleSchema = 409
+	ErrorCodeInvalidSchema      = 42201
+	ErrorCodeInvalidVersion     = 42202
+	// ErrorCodeInvalidCompatibilityLevel is returned for an unknown compatibility level
+	ErrorCodeInvalidCompatibilityLevel = 42203
 )
 
 // The Schema type is an object produced by the schema registry.
@@ -35,17 +42,33 @@ type simpleSchema struct {
 }
 
 // A ConfluentError is an error as communicated by the schema registry.
-// Some day this type might be exposed so that callers can do type assertions on it.
-type confluentError struct {
+// Callers can check its ErrorCode against the ErrorCode constants with errors.As.
+type ConfluentError struct {
 	ErrorCode int    `json:"error_code"`
 	Message   string `json:"message"`
 }
 
-// Error makes confluentError implement the error interface.
-func (ce confluentError) Error() string {
+// Error makes ConfluentError implement the error interface.
+func (ce ConfluentError) Error() string {
 	return fmt.Sprintf("%s (%d)", ce.Message, ce.ErrorCode)
 }
 
+// NotFound implements NotFoundError for the unknown subjects, versions and schemas
+func (ce ConfluentError) NotFound() bool {
+	switch ce.ErrorCode {
+	case ErrorCodeSubjectNotFound, ErrorCodeVersionNotFound, ErrorCodeSchemaNotFound:
+		return true
+	}
+	return false
+}
+
+// NotFoundError is implemented by the errors of the schema registries, telling if the subject,
+// the version or the schema looked up doesn't exist
+type NotFoundError interface {
+	error
+	NotFound() bool
+}
+
 type httpDoer interface {
 	Do(req *http.Request) (resp *http.Response, err error)
 }
@@ -62,6 +85,18 @@ type SchemaRegistry interface {
 	DeleteSubject(subject string) (versions []int, err error)
 }
 
+// CompatibilityChecker is implemented by the schema registries able to test the compatibility
+// of a schema with a version of a subject, -1 designating the latest version.
+type CompatibilityChecker interface {
+	TestCompatibility(subject, schema string, version int) (bool, error)
+}
+
+// VersionDeleter is implemented by the schema registries able to delete a single version of a subject,
+// -1 designating the latest version. The deleted version is returned.
+type VersionDeleter interface {
+	DeleteSchemaVersion(subject string, version int) (int, error)
+}
+
 // ConfluentSchemaRegistry defines a schema registry managed by Confluent
 type ConfluentSchemaRegistry struct {
 	url    url.URL
@@ -74,7 +109,7 @@ func parseSchemaRegistryError(resp *http.Response) error {
 		return fmt.Errorf("ioutil.ReadAll error while reading error body: %w", err)
 	}
 
-	var ce confluentError
+	var ce ConfluentError
 	if err := json.Unmarshal(body, &ce); err != nil {
 		return fmt.Errorf("json.Unmarshal error while reading error body: %q: %w", body, err)
 	}
@@ -148,11 +183,11 @@ func (c *ConfluentSchemaRegistry) IsRegistered(subject, schema string) (bool, Sc
 	var fs Schema
 	err := c.do("POST", fmt.Sprintf("/subjects/%s", subject), simpleSchema{schema}, &fs)
 	// subject not found?
-	if ce, confluentErr := err.(confluentError); confluentErr && ce.ErrorCode == subjectNotFound {
+	if ce, confluentErr := err.(ConfluentError); confluentErr && ce.ErrorCode == ErrorCodeSubjectNotFound {
 		return false, fs, nil
 	}
 	// schema not found?
-	if ce, confluentErr := err.(confluentError); confluentErr && ce.ErrorCode == schemaNotFound {
+	if ce, confluentErr := err.(ConfluentError); confluentErr && ce.ErrorCode == ErrorCodeSchemaNotFound {
 		return false, fs, nil
 	}
 	// error?
@@ -189,6 +224,30 @@ func (c *ConfluentSchemaRegistry) DeleteSubject(subject string) (versions []int,
 	return
 }
 
+// DeleteSchemaVersion removes a version of the subject, -1 designating the latest one.
+// It returns the deleted version.
+func (c *ConfluentSchemaRegistry) DeleteSchemaVersion(subject string, version int) (deleted int, err error) {
+	err = c.do("DELETE", fmt.Sprintf("/subjects/%s/versions/%s", subject, versionPath(version)), nil, &deleted)
+	return
+}
+
+// TestCompatibility tells if the schema is compatible with a version of the subject, -1 designating the latest one.
+func (c *ConfluentSchemaRegistry) TestCompatibility(subject, schema string, version int) (bool, error) {
+	var resp struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	err := c.do("POST", fmt.Sprintf("/compatibility/subjects/%s/versions/%s", subject, versionPath(version)), simpleSchema{schema}, &resp)
+	return resp.IsCompatible, err
+}
+
+// versionPath formats a version for the URLs of the schema registry
+func versionPath(version int) string {
+	if version == -1 {
+		return "latest"
+	}
+	return strconv.Itoa(version)
+}
+
 // NewSchemaRegistry returns a new SchemaRegistry that connects to baseurl.
 func NewSchemaRegistry(baseurl string) (SchemaRegistry, error) {
 	u, err := url.Parse(baseurl)
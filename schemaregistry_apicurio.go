@@ -0,0 +1,339 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// DefaultApicurioGroup is the group of the artifacts when none is configured
+const DefaultApicurioGroup = "default"
+
+// apicurioAPI is the path of the REST API (v2) of an Apicurio registry
+const apicurioAPI = "apis/registry/v2"
+
+// apicurioPageSize is the number of artifacts or versions listed by request
+const apicurioPageSize = 100
+
+// An ApicurioError is an error as communicated by an Apicurio registry, whose ErrorCode is the HTTP status.
+// The unknown artifacts, versions and IDs give http.StatusNotFound.
+type ApicurioError struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+	Name      string `json:"name"`
+}
+
+// Error makes ApicurioError implement the error interface.
+func (e ApicurioError) Error() string {
+	return fmt.Sprintf("%s: %s (%d)", e.Name, e.Message, e.ErrorCode)
+}
+
+// NotFound implements NotFoundError for the unknown artifacts, versions and schemas
+func (e ApicurioError) NotFound() bool {
+	return e.ErrorCode == http.StatusNotFound
+}
+
+// ApicurioSchemaRegistry is a SchemaRegistry talking to the REST API (v2) of an Apicurio registry.
+// The subjects are the IDs of the AVRO artifacts of a group, and the schema IDs are the global IDs
+// of the artifact versions, or their content IDs with UseContentID, as written by the Apicurio serializers:
+// use it with a CodecRegistry framing the payloads with ApicurioWireFormat.
+// As SchemaID is an int32, the IDs above math.MaxInt32 are not supported: the lookups returning them fail
+// with an error wrapping ErrInvalidSchemaID.
+type ApicurioSchemaRegistry struct {
+	url    url.URL
+	client httpDoer
+	// GroupID is the group of the artifacts, DefaultApicurioGroup if empty
+	GroupID string
+	// UseContentID identifies the schemas by their content ID instead of their global ID
+	UseContentID bool
+}
+
+// NewApicurioSchemaRegistry returns a client of the Apicurio registry listening at baseurl, ex: http://localhost:8080
+func NewApicurioSchemaRegistry(baseurl string) (*ApicurioSchemaRegistry, error) {
+	u, err := url.Parse(baseurl)
+	if err != nil {
+		return nil, err
+	}
+	return &ApicurioSchemaRegistry{url: *u, client: http.DefaultClient}, nil
+}
+
+// apicurioMetadata is the metadata of an artifact or of one of its versions
+type apicurioMetadata struct {
+	ID        string `json:"id"`
+	Version   string `json:"version"`
+	GlobalID  int    `json:"globalId"`
+	ContentID int    `json:"contentId"`
+}
+
+// apicurioRequest is a request to the REST API, whose body is the raw content of an artifact
+type apicurioRequest struct {
+	method string
+	// path is the escaped path of the resource, relative to the API
+	path    string
+	query   url.Values
+	header  http.Header
+	content string
+}
+
+// do performs the http request and decodes the json answer into out, or copies it as is into a *string
+func (c *ApicurioSchemaRegistry) do(r apicurioRequest, out interface{}) error {
+	u := c.url
+	u.RawPath = path.Join(u.EscapedPath(), apicurioAPI) + "/" + r.path
+	unescaped, err := url.PathUnescape(u.RawPath)
+	if err != nil {
+		return fmt.Errorf("url.PathUnescape error: %w", err)
+	}
+	u.Path = unescaped
+	u.RawQuery = r.query.Encode()
+	var body io.Reader
+	if r.content != "" {
+		body = bytes.NewReader([]byte(r.content))
+	}
+	req, err := http.NewRequest(r.method, u.String(), body)
+	if err != nil {
+		return fmt.Errorf("http.NewRequest error: %w", err)
+	}
+	for key, values := range r.header {
+		req.Header[key] = values
+	}
+	if r.content != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ApicurioSchemaRegistry.Do error; %w", err)
+	}
+	defer func() {
+		if resp.Body != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return parseApicurioError(resp)
+	}
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *string:
+		content, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadAll error: %w", err)
+		}
+		*out = string(content)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("json.Decode error: %w", err)
+	}
+	return nil
+}
+
+func parseApicurioError(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadAll error while reading error body: %w", err)
+	}
+	ae := ApicurioError{ErrorCode: resp.StatusCode}
+	if err := json.Unmarshal(body, &ae); err != nil {
+		ae.Message = string(body)
+	}
+	if ae.ErrorCode == 0 {
+		ae.ErrorCode = resp.StatusCode
+	}
+	return ae
+}
+
+func (c *ApicurioSchemaRegistry) groupPath() string {
+	group := c.GroupID
+	if group == "" {
+		group = DefaultApicurioGroup
+	}
+	return escapePath("groups", group, "artifacts")
+}
+
+// artifactPath returns the path of an artifact, its ID being escaped so that any subject designates its own artifact
+func (c *ApicurioSchemaRegistry) artifactPath(subject string, elems ...string) string {
+	return c.groupPath() + "/" + escapePath(append([]string{subject}, elems...)...)
+}
+
+// escapePath joins the escaped segments of a path, the dot segments included so that they are not resolved
+func escapePath(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		if segment == "." || segment == ".." {
+			escaped[i] = strings.Repeat("%2E", len(segment))
+		} else {
+			escaped[i] = url.PathEscape(segment)
+		}
+	}
+	return strings.Join(escaped, "/")
+}
+
+// schemaID returns the ID of an artifact version identifying its schema, which must fit in a SchemaID
+func (c *ApicurioSchemaRegistry) schemaID(metadata apicurioMetadata) (int, error) {
+	id := metadata.GlobalID
+	if c.UseContentID {
+		id = metadata.ContentID
+	}
+	if id > math.MaxInt32 {
+		return 0, fmt.Errorf("the schema ID %d overflows SchemaID: %w", id, ErrInvalidSchemaID)
+	}
+	return id, nil
+}
+
+func (c *ApicurioSchemaRegistry) toSchema(subject, schema string, metadata apicurioMetadata) (Schema, error) {
+	version, err := strconv.Atoi(metadata.Version)
+	if err != nil {
+		return Schema{}, fmt.Errorf("invalid version %q of artifact %s: %w", metadata.Version, subject, err)
+	}
+	id, err := c.schemaID(metadata)
+	if err != nil {
+		return Schema{}, err
+	}
+	return Schema{Schema: schema, Subject: subject, Version: version, ID: id}, nil
+}
+
+// Subjects returns the IDs of the artifacts of the group.
+func (c *ApicurioSchemaRegistry) Subjects() (subjects []string, err error) {
+	for {
+		var page struct {
+			Artifacts []apicurioMetadata `json:"artifacts"`
+			Count     int                `json:"count"`
+		}
+		query := url.Values{"offset": {strconv.Itoa(len(subjects))}, "limit": {strconv.Itoa(apicurioPageSize)}}
+		if err := c.do(apicurioRequest{method: "GET", path: c.groupPath(), query: query}, &page); err != nil {
+			return nil, err
+		}
+		for _, artifact := range page.Artifacts {
+			subjects = append(subjects, artifact.ID)
+		}
+		if len(page.Artifacts) == 0 || len(subjects) >= page.Count {
+			return subjects, nil
+		}
+	}
+}
+
+// Versions returns the versions of the artifact.
+func (c *ApicurioSchemaRegistry) Versions(subject string) (versions []int, err error) {
+	for {
+		var page struct {
+			Versions []apicurioMetadata `json:"versions"`
+			Count    int                `json:"count"`
+		}
+		query := url.Values{"offset": {strconv.Itoa(len(versions))}, "limit": {strconv.Itoa(apicurioPageSize)}}
+		if err := c.do(apicurioRequest{method: "GET", path: c.artifactPath(subject, "versions"), query: query}, &page); err != nil {
+			return nil, err
+		}
+		for _, metadata := range page.Versions {
+			version, err := strconv.Atoi(metadata.Version)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version %q of artifact %s: %w", metadata.Version, subject, err)
+			}
+			versions = append(versions, version)
+		}
+		if len(page.Versions) == 0 || len(versions) >= page.Count {
+			return versions, nil
+		}
+	}
+}
+
+// RegisterNewSchema creates the artifact, or adds a version to it unless the schema is already its latest version.
+// It returns the ID of the schema.
+func (c *ApicurioSchemaRegistry) RegisterNewSchema(subject, schema string) (int, error) {
+	var metadata apicurioMetadata
+	err := c.do(apicurioRequest{
+		method:  "POST",
+		path:    c.groupPath(),
+		query:   url.Values{"ifExists": {"RETURN_OR_UPDATE"}},
+		header:  http.Header{"X-Registry-Artifactid": {subject}, "X-Registry-Artifacttype": {"AVRO"}},
+		content: schema,
+	}, &metadata)
+	if err != nil {
+		return 0, err
+	}
+	return c.schemaID(metadata)
+}
+
+// IsRegistered tells if the schema is a version of the artifact.
+func (c *ApicurioSchemaRegistry) IsRegistered(subject, schema string) (bool, Schema, error) {
+	var metadata apicurioMetadata
+	err := c.do(apicurioRequest{
+		method:  "POST",
+		path:    c.artifactPath(subject, "meta"),
+		query:   url.Values{"canonical": {"true"}},
+		content: schema,
+	}, &metadata)
+	if ae, ok := err.(ApicurioError); ok && ae.ErrorCode == http.StatusNotFound {
+		return false, Schema{}, nil
+	}
+	if err != nil {
+		return false, Schema{}, err
+	}
+	s, err := c.toSchema(subject, schema, metadata)
+	return err == nil, s, err
+}
+
+// GetSchemaByID returns the schema of the global ID, or of the content ID with UseContentID.
+func (c *ApicurioSchemaRegistry) GetSchemaByID(id int) (string, error) {
+	kind := "globalIds"
+	if c.UseContentID {
+		kind = "contentIds"
+	}
+	var schema string
+	err := c.do(apicurioRequest{method: "GET", path: escapePath("ids", kind, strconv.Itoa(id))}, &schema)
+	return schema, err
+}
+
+// GetSchemaBySubject returns a version of the artifact, -1 designating the latest one.
+func (c *ApicurioSchemaRegistry) GetSchemaBySubject(subject string, ver int) (Schema, error) {
+	if ver == -1 {
+		return c.GetLatestSchema(subject)
+	}
+	var metadata apicurioMetadata
+	err := c.do(apicurioRequest{method: "GET", path: c.artifactPath(subject, "versions", strconv.Itoa(ver), "meta")}, &metadata)
+	if err != nil {
+		return Schema{}, err
+	}
+	var schema string
+	if err := c.do(apicurioRequest{method: "GET", path: c.artifactPath(subject, "versions", strconv.Itoa(ver))}, &schema); err != nil {
+		return Schema{}, err
+	}
+	return c.toSchema(subject, schema, metadata)
+}
+
+// GetLatestSchema returns the latest version of the artifact.
+func (c *ApicurioSchemaRegistry) GetLatestSchema(subject string) (Schema, error) {
+	var metadata apicurioMetadata
+	if err := c.do(apicurioRequest{method: "GET", path: c.artifactPath(subject, "meta")}, &metadata); err != nil {
+		return Schema{}, err
+	}
+	var schema string
+	if err := c.do(apicurioRequest{method: "GET", path: c.artifactPath(subject, "versions", metadata.Version)}, &schema); err != nil {
+		return Schema{}, err
+	}
+	return c.toSchema(subject, schema, metadata)
+}
+
+// DeleteSubject deletes the artifact and returns the versions it had.
+func (c *ApicurioSchemaRegistry) DeleteSubject(subject string) ([]int, error) {
+	versions, err := c.Versions(subject)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.do(apicurioRequest{method: "DELETE", path: c.artifactPath(subject)}, nil); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
@@ -0,0 +1,301 @@
+package avro
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeApicurio serves the subset of the Apicurio REST API (v2) used by ApicurioSchemaRegistry
+type fakeApicurio struct {
+	lock      sync.Mutex
+	artifacts map[string][]apicurioMetadata // by group/artifact
+	contents  []string                      // by content ID - 1
+	globalIDs int
+	order     []string
+}
+
+func newFakeApicurio() *httptest.Server {
+	fake := &fakeApicurio{artifacts: map[string][]apicurioMetadata{}}
+	return httptest.NewServer(fake)
+}
+
+func (f *fakeApicurio) fail(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(ApicurioError{ErrorCode: code, Message: message, Name: "NotFoundException"})
+}
+
+func (f *fakeApicurio) reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeApicurio) contentID(content string) int {
+	for i, c := range f.contents {
+		if c == content {
+			return i + 1
+		}
+	}
+	f.contents = append(f.contents, content)
+	return len(f.contents)
+}
+
+func (f *fakeApicurio) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"+apicurioAPI+"/"), "/")
+	for i, part := range parts {
+		parts[i], _ = url.PathUnescape(part)
+	}
+
+	if len(parts) == 3 && parts[0] == "ids" {
+		id, _ := strconv.Atoi(parts[2])
+		for _, versions := range f.artifacts {
+			for _, v := range versions {
+				if (parts[1] == "globalIds" && v.GlobalID == id) || (parts[1] == "contentIds" && v.ContentID == id) {
+					_, _ = w.Write([]byte(f.contents[v.ContentID-1]))
+					return
+				}
+			}
+		}
+		f.fail(w, http.StatusNotFound, "no schema with ID "+parts[2])
+		return
+	}
+	if len(parts) < 3 || parts[0] != "groups" || parts[2] != "artifacts" {
+		f.fail(w, http.StatusNotFound, "no such path")
+		return
+	}
+	group := parts[1]
+	if len(parts) == 3 {
+		switch r.Method {
+		case "GET":
+			var page struct {
+				Artifacts []apicurioMetadata `json:"artifacts"`
+				Count     int                `json:"count"`
+			}
+			for _, key := range f.order {
+				if strings.HasPrefix(key, group+"/") {
+					page.Artifacts = append(page.Artifacts, apicurioMetadata{ID: strings.TrimPrefix(key, group+"/")})
+				}
+			}
+			page.Count = len(page.Artifacts)
+			f.reply(w, page)
+		case "POST":
+			key := group + "/" + r.Header.Get("X-Registry-ArtifactId")
+			versions, ok := f.artifacts[key]
+			contentID := f.contentID(string(body))
+			if ok && versions[len(versions)-1].ContentID == contentID {
+				f.reply(w, versions[len(versions)-1])
+				return
+			}
+			if !ok {
+				f.order = append(f.order, key)
+			}
+			f.globalIDs++
+			metadata := apicurioMetadata{
+				ID:        r.Header.Get("X-Registry-ArtifactId"),
+				Version:   strconv.Itoa(len(versions) + 1),
+				GlobalID:  f.globalIDs,
+				ContentID: contentID,
+			}
+			f.artifacts[key] = append(versions, metadata)
+			f.reply(w, metadata)
+		}
+		return
+	}
+
+	key := group + "/" + parts[3]
+	versions, ok := f.artifacts[key]
+	if !ok {
+		f.fail(w, http.StatusNotFound, "no artifact "+key)
+		return
+	}
+	rest := parts[4:]
+	switch {
+	case len(rest) == 0 && r.Method == "GET":
+		_, _ = w.Write([]byte(f.contents[versions[len(versions)-1].ContentID-1]))
+	case len(rest) == 0 && r.Method == "DELETE":
+		delete(f.artifacts, key)
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) == 1 && rest[0] == "meta" && r.Method == "GET":
+		f.reply(w, versions[len(versions)-1])
+	case len(rest) == 1 && rest[0] == "meta" && r.Method == "POST":
+		for _, v := range versions {
+			if f.contents[v.ContentID-1] == string(body) {
+				f.reply(w, v)
+				return
+			}
+		}
+		f.fail(w, http.StatusNotFound, "no such content in "+key)
+	case len(rest) == 1 && rest[0] == "versions":
+		f.reply(w, map[string]interface{}{"versions": versions, "count": len(versions)})
+	case len(rest) >= 2 && rest[0] == "versions":
+		version, _ := strconv.Atoi(rest[1])
+		if version < 1 || version > len(versions) {
+			f.fail(w, http.StatusNotFound, "no version "+rest[1])
+			return
+		}
+		if len(rest) == 3 {
+			f.reply(w, versions[version-1])
+			return
+		}
+		_, _ = w.Write([]byte(f.contents[versions[version-1].ContentID-1]))
+	default:
+		f.fail(w, http.StatusNotFound, "no such path")
+	}
+}
+
+func TestApicurioSchemaRegistry(t *testing.T) {
+	server := newFakeApicurio()
+	defer server.Close()
+	registry, err := NewApicurioSchemaRegistry(server.URL)
+	require.NoError(t, err)
+
+	id1, err := registry.RegisterNewSchema("users", userV1)
+	require.NoError(t, err)
+	id2, err := registry.RegisterNewSchema("users", userV2)
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+	again, err := registry.RegisterNewSchema("users", userV2)
+	require.NoError(t, err)
+	assert.Equal(t, id2, again, "the latest version is not registered twice")
+	_, err = registry.RegisterNewSchema("accounts", userV1)
+	require.NoError(t, err)
+
+	subjects, err := registry.Subjects()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users", "accounts"}, subjects)
+	versions, err := registry.Versions("users")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	schema, err := registry.GetSchemaByID(id1)
+	require.NoError(t, err)
+	assert.Equal(t, userV1, schema)
+	latest, err := registry.GetLatestSchema("users")
+	require.NoError(t, err)
+	assert.Equal(t, Schema{Schema: userV2, Subject: "users", Version: 2, ID: id2}, latest)
+	first, err := registry.GetSchemaBySubject("users", 1)
+	require.NoError(t, err)
+	assert.Equal(t, Schema{Schema: userV1, Subject: "users", Version: 1, ID: id1}, first)
+	latest, err = registry.GetSchemaBySubject("users", -1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, latest.Version)
+
+	registered, found, err := registry.IsRegistered("users", userV1)
+	require.NoError(t, err)
+	assert.True(t, registered)
+	assert.Equal(t, first, found)
+	registered, _, err = registry.IsRegistered("users", userV3)
+	require.NoError(t, err)
+	assert.False(t, registered)
+
+	_, err = registry.GetSchemaBySubject("users", 3)
+	var ae ApicurioError
+	require.True(t, errors.As(err, &ae), "%v is not an ApicurioError", err)
+	assert.Equal(t, http.StatusNotFound, ae.ErrorCode)
+	assert.True(t, isNotFound(err))
+
+	deleted, err := registry.DeleteSubject("users")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, deleted)
+	_, err = registry.GetLatestSchema("users")
+	assert.True(t, isNotFound(err))
+}
+
+func TestApicurioSchemaRegistry_UseContentID(t *testing.T) {
+	server := newFakeApicurio()
+	defer server.Close()
+	registry, err := NewApicurioSchemaRegistry(server.URL)
+	require.NoError(t, err)
+	registry.GroupID = "events"
+	registry.UseContentID = true
+
+	_, err = registry.RegisterNewSchema("users", userV1)
+	require.NoError(t, err)
+	id, err := registry.RegisterNewSchema("accounts", userV1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id, "the artifacts of the same content share their content ID")
+	schema, err := registry.GetSchemaByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, userV1, schema)
+}
+
+func TestApicurioSchemaRegistry_ID_overflow(t *testing.T) {
+	server := newFakeApicurio()
+	defer server.Close()
+	server.Config.Handler.(*fakeApicurio).globalIDs = math.MaxInt32
+	registry, err := NewApicurioSchemaRegistry(server.URL)
+	require.NoError(t, err)
+
+	_, err = registry.RegisterNewSchema("users", userV1)
+	assert.True(t, errors.Is(err, ErrInvalidSchemaID), "%v", err)
+	_, err = registry.GetLatestSchema("users")
+	assert.True(t, errors.Is(err, ErrInvalidSchemaID), "%v", err)
+}
+
+func TestApicurioSchemaRegistry_escaped_subjects(t *testing.T) {
+	server := newFakeApicurio()
+	defer server.Close()
+	registry, err := NewApicurioSchemaRegistry(server.URL)
+	require.NoError(t, err)
+	registry.GroupID = "my group"
+
+	// the subjects designate their own artifact, whatever their slashes and dots
+	for _, subject := range []string{"org/people", "..", ".", "a?b#c"} {
+		id, err := registry.RegisterNewSchema(subject, userV1)
+		require.NoError(t, err, subject)
+		latest, err := registry.GetLatestSchema(subject)
+		require.NoError(t, err, subject)
+		assert.Equal(t, id, latest.ID, subject)
+		versions, err := registry.Versions(subject)
+		require.NoError(t, err, subject)
+		assert.Equal(t, []int{1}, versions, subject)
+	}
+	_, err = registry.GetLatestSchema("org")
+	assert.True(t, isNotFound(err), "%v", err)
+	subjects, err := registry.Subjects()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"org/people", "..", ".", "a?b#c"}, subjects)
+}
+
+func TestCodecRegistry_ApicurioWireFormat(t *testing.T) {
+	server := newFakeApicurio()
+	defer server.Close()
+	registry, err := NewApicurioSchemaRegistry(server.URL)
+	require.NoError(t, err)
+	// the global IDs of the apicurio registry differ from the other versions
+	_, err = registry.RegisterNewSchema("other", userV3)
+	require.NoError(t, err)
+	id, err := registry.RegisterNewSchema("users", userV1)
+	require.NoError(t, err)
+
+	codecRegistry, err := NewCodecRegistryWithClient(registry, "users", userV1)
+	require.NoError(t, err)
+	require.NoError(t, codecRegistry.SetWireFormat(ApicurioWireFormat))
+
+	buf, err := codecRegistry.Marshal(map[string]interface{}{"name": "john"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, byte(id)}, buf[:9])
+
+	var decoded map[string]interface{}
+	require.NoError(t, codecRegistry.Unmarshal(buf, &decoded))
+	assert.Equal(t, map[string]interface{}{"name": "john"}, decoded)
+
+	// a payload framed by the Confluent serializers is rejected
+	_, err = codecRegistry.UnmarshalNext(buf[4:], &decoded)
+	assert.Error(t, err)
+}
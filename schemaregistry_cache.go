@@ -0,0 +1,273 @@
+package avro
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	errNoCompatibilityChecker = errors.New("the schema registry can't check compatibility")
+	errNoVersionDeleter       = errors.New("the schema registry can't delete a version")
+)
+
+// CachedRegistryOptions configures a SchemaRegistry returned by NewCachedSchemaRegistry
+type CachedRegistryOptions struct {
+	// TTL is the lifetime of the mutable lookups: the latest schemas, the subjects and the versions.
+	// 0 disables their caching.
+	TTL time.Duration
+}
+
+type subjectSchema struct {
+	subject string
+	schema  string
+}
+
+type subjectVersion struct {
+	subject string
+	version int
+}
+
+type timedSchema struct {
+	schema  Schema
+	expires time.Time
+}
+
+type timedInts struct {
+	values  []int
+	expires time.Time
+}
+
+type timedStrings struct {
+	values  []string
+	expires time.Time
+}
+
+// cachedSchemaRegistry is a SchemaRegistry decorator caching the lookups of another one
+type cachedSchemaRegistry struct {
+	inner SchemaRegistry
+	ttl   time.Duration
+	now   func() time.Time
+
+	lock       sync.RWMutex
+	byID       map[int]string
+	registered map[subjectSchema]Schema
+	byVersion  map[subjectVersion]Schema
+	latest     map[string]timedSchema
+	versions   map[string]timedInts
+	subjects   *timedStrings
+}
+
+// NewCachedSchemaRegistry returns a SchemaRegistry caching the lookups done on inner.
+// The immutable lookups (schemas by ID, registered schemas and versions of a subject) are cached forever,
+// the mutable ones (latest schemas, including the version -1 of a subject, subjects and versions lists) for opts.TTL.
+// The entries of a subject are invalidated when a schema is registered under it or when it or one of its
+// versions is deleted. The returned registry implements CompatibilityChecker and VersionDeleter, which fail
+// when inner doesn't implement them, and checks the compatibility without caching.
+func NewCachedSchemaRegistry(inner SchemaRegistry, opts CachedRegistryOptions) SchemaRegistry {
+	return &cachedSchemaRegistry{
+		inner:      inner,
+		ttl:        opts.TTL,
+		now:        time.Now,
+		byID:       make(map[int]string),
+		registered: make(map[subjectSchema]Schema),
+		byVersion:  make(map[subjectVersion]Schema),
+		latest:     make(map[string]timedSchema),
+		versions:   make(map[string]timedInts),
+	}
+}
+
+func (c *cachedSchemaRegistry) fresh(expires time.Time) bool {
+	return c.ttl > 0 && c.now().Before(expires)
+}
+
+// Subjects returns all registered subjects.
+func (c *cachedSchemaRegistry) Subjects() ([]string, error) {
+	c.lock.RLock()
+	cached := c.subjects
+	c.lock.RUnlock()
+	if cached != nil && c.fresh(cached.expires) {
+		return append([]string(nil), cached.values...), nil
+	}
+
+	subjects, err := c.inner.Subjects()
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.subjects = &timedStrings{values: subjects, expires: c.now().Add(c.ttl)}
+	c.lock.Unlock()
+	return append([]string(nil), subjects...), nil
+}
+
+// Versions returns all schema version numbers registered for this subject.
+func (c *cachedSchemaRegistry) Versions(subject string) ([]int, error) {
+	c.lock.RLock()
+	cached, ok := c.versions[subject]
+	c.lock.RUnlock()
+	if ok && c.fresh(cached.expires) {
+		return append([]int(nil), cached.values...), nil
+	}
+
+	versions, err := c.inner.Versions(subject)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.versions[subject] = timedInts{values: versions, expires: c.now().Add(c.ttl)}
+	c.lock.Unlock()
+	return append([]int(nil), versions...), nil
+}
+
+// RegisterNewSchema registers the given schema for this subject.
+func (c *cachedSchemaRegistry) RegisterNewSchema(subject, schema string) (int, error) {
+	id, err := c.inner.RegisterNewSchema(subject, schema)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key := range c.byVersion {
+		if key.subject == subject {
+			delete(c.byVersion, key)
+		}
+	}
+	delete(c.latest, subject)
+	delete(c.versions, subject)
+	c.subjects = nil
+	if err == nil {
+		c.byID[id] = schema
+	}
+	return id, err
+}
+
+// IsRegistered tells if the given schema is registred for this subject.
+// Only the registered schemas are cached.
+func (c *cachedSchemaRegistry) IsRegistered(subject, schema string) (bool, Schema, error) {
+	key := subjectSchema{subject, schema}
+	c.lock.RLock()
+	cached, ok := c.registered[key]
+	c.lock.RUnlock()
+	if ok {
+		return true, cached, nil
+	}
+
+	isRegistered, s, err := c.inner.IsRegistered(subject, schema)
+	if err != nil || !isRegistered {
+		return isRegistered, s, err
+	}
+	c.lock.Lock()
+	c.registered[key] = s
+	c.byID[s.ID] = s.Schema
+	c.lock.Unlock()
+	return true, s, nil
+}
+
+// GetSchemaByID returns the schema for some id.
+func (c *cachedSchemaRegistry) GetSchemaByID(id int) (string, error) {
+	c.lock.RLock()
+	cached, ok := c.byID[id]
+	c.lock.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	schema, err := c.inner.GetSchemaByID(id)
+	if err != nil {
+		return "", err
+	}
+	c.lock.Lock()
+	c.byID[id] = schema
+	c.lock.Unlock()
+	return schema, nil
+}
+
+// GetSchemaBySubject returns the schema for a particular subject and version.
+// The version -1 is the latest one, cached as GetLatestSchema, the other versions below 1 aren't cached.
+func (c *cachedSchemaRegistry) GetSchemaBySubject(subject string, ver int) (Schema, error) {
+	if ver == -1 {
+		return c.GetLatestSchema(subject)
+	}
+	if ver < 1 {
+		return c.inner.GetSchemaBySubject(subject, ver)
+	}
+	key := subjectVersion{subject, ver}
+	c.lock.RLock()
+	cached, ok := c.byVersion[key]
+	c.lock.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	s, err := c.inner.GetSchemaBySubject(subject, ver)
+	if err != nil {
+		return s, err
+	}
+	c.lock.Lock()
+	c.byVersion[key] = s
+	c.lock.Unlock()
+	return s, nil
+}
+
+// GetLatestSchema returns the latest version of the subject's schema.
+func (c *cachedSchemaRegistry) GetLatestSchema(subject string) (Schema, error) {
+	c.lock.RLock()
+	cached, ok := c.latest[subject]
+	c.lock.RUnlock()
+	if ok && c.fresh(cached.expires) {
+		return cached.schema, nil
+	}
+
+	s, err := c.inner.GetLatestSchema(subject)
+	if err != nil {
+		return s, err
+	}
+	c.lock.Lock()
+	c.latest[subject] = timedSchema{schema: s, expires: c.now().Add(c.ttl)}
+	c.lock.Unlock()
+	return s, nil
+}
+
+// DeleteSubject removes a list of schema under the given subject
+func (c *cachedSchemaRegistry) DeleteSubject(subject string) ([]int, error) {
+	versions, err := c.inner.DeleteSubject(subject)
+	c.invalidateSubject(subject)
+	return versions, err
+}
+
+// TestCompatibility implements CompatibilityChecker when the inner registry does
+func (c *cachedSchemaRegistry) TestCompatibility(subject, schema string, version int) (bool, error) {
+	checker, ok := c.inner.(CompatibilityChecker)
+	if !ok {
+		return false, errNoCompatibilityChecker
+	}
+	return checker.TestCompatibility(subject, schema, version)
+}
+
+// DeleteSchemaVersion implements VersionDeleter when the inner registry does
+func (c *cachedSchemaRegistry) DeleteSchemaVersion(subject string, version int) (int, error) {
+	deleter, ok := c.inner.(VersionDeleter)
+	if !ok {
+		return 0, errNoVersionDeleter
+	}
+	deleted, err := deleter.DeleteSchemaVersion(subject, version)
+	c.invalidateSubject(subject)
+	return deleted, err
+}
+
+// invalidateSubject removes all the cached entries of a subject, the schemas by ID are kept
+// as the registry keeps resolving them
+func (c *cachedSchemaRegistry) invalidateSubject(subject string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key := range c.registered {
+		if key.subject == subject {
+			delete(c.registered, key)
+		}
+	}
+	for key := range c.byVersion {
+		if key.subject == subject {
+			delete(c.byVersion, key)
+		}
+	}
+	delete(c.latest, subject)
+	delete(c.versions, subject)
+	c.subjects = nil
+}
@@ -0,0 +1,165 @@
+package avro
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRegistry counts the calls made to a registry
+func countingRegistry(inner SchemaRegistry, calls map[string]int) SchemaRegistry {
+	return &mockSchemaRegistry{
+		SubjectsFn: func() ([]string, error) {
+			calls["Subjects"]++
+			return inner.Subjects()
+		},
+		VersionsFn: func(subject string) ([]int, error) {
+			calls["Versions"]++
+			return inner.Versions(subject)
+		},
+		RegisterNewSchemaFn: func(subject, schema string) (int, error) {
+			calls["RegisterNewSchema"]++
+			return inner.RegisterNewSchema(subject, schema)
+		},
+		IsRegisteredFn: func(subject, schema string) (bool, Schema, error) {
+			calls["IsRegistered"]++
+			return inner.IsRegistered(subject, schema)
+		},
+		GetSchemaByIDFn: func(id int) (string, error) {
+			calls["GetSchemaByID"]++
+			return inner.GetSchemaByID(id)
+		},
+		GetSchemaBySubjectFn: func(subject string, ver int) (Schema, error) {
+			calls["GetSchemaBySubject"]++
+			return inner.GetSchemaBySubject(subject, ver)
+		},
+		GetLatestSchemaFn: func(subject string) (Schema, error) {
+			calls["GetLatestSchema"]++
+			return inner.GetLatestSchema(subject)
+		},
+		DeleteSubjectFn: func(subject string) ([]int, error) {
+			calls["DeleteSubject"]++
+			return inner.DeleteSubject(subject)
+		},
+	}
+}
+
+func TestCachedSchemaRegistry(t *testing.T) {
+	calls := make(map[string]int)
+	registry := NewCachedSchemaRegistry(countingRegistry(NewNOOPClient(), calls), CachedRegistryOptions{TTL: time.Minute})
+	now := time.Now()
+	registry.(*cachedSchemaRegistry).now = func() time.Time { return now }
+
+	isRegistered, _, err := registry.IsRegistered("subject", `"int"`)
+	require.NoError(t, err)
+	assert.False(t, isRegistered)
+
+	id, err := registry.RegisterNewSchema("subject", `"int"`)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		isRegistered, schema, err := registry.IsRegistered("subject", `"int"`)
+		require.NoError(t, err)
+		assert.True(t, isRegistered)
+		assert.Equal(t, id, schema.ID)
+
+		raw, err := registry.GetSchemaByID(id)
+		require.NoError(t, err)
+		assert.Equal(t, `"int"`, raw)
+
+		latest, err := registry.GetLatestSchema("subject")
+		require.NoError(t, err)
+		assert.Equal(t, id, latest.ID)
+
+		subjects, err := registry.Subjects()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"subject"}, subjects)
+	}
+	assert.Equal(t, 2, calls["IsRegistered"], "only the registered schema is cached")
+	assert.Equal(t, 0, calls["GetSchemaByID"], "the registered schema is cached by ID")
+	assert.Equal(t, 1, calls["GetLatestSchema"])
+	assert.Equal(t, 1, calls["Subjects"])
+
+	// Mutable lookups expire
+	now = now.Add(2 * time.Minute)
+	_, err = registry.GetLatestSchema("subject")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls["GetLatestSchema"])
+
+	// Registration invalidates the subject's mutable lookups
+	id2, err := registry.RegisterNewSchema("subject", `"long"`)
+	require.NoError(t, err)
+	latest, err := registry.GetLatestSchema("subject")
+	require.NoError(t, err)
+	assert.Equal(t, id2, latest.ID)
+	assert.Equal(t, 3, calls["GetLatestSchema"])
+
+	// Deletion invalidates everything about the subject
+	_, err = registry.DeleteSubject("subject")
+	require.NoError(t, err)
+	isRegistered, _, err = registry.IsRegistered("subject", `"int"`)
+	require.NoError(t, err)
+	assert.False(t, isRegistered)
+	subjects, err := registry.Subjects()
+	require.NoError(t, err)
+	assert.Empty(t, subjects)
+}
+
+func TestCachedSchemaRegistry_optional_interfaces(t *testing.T) {
+	registry := NewCachedSchemaRegistry(NewMemorySchemaRegistry(), CachedRegistryOptions{TTL: time.Minute})
+	_, err := registry.RegisterNewSchema("subject", userV1)
+	require.NoError(t, err)
+	id, err := registry.RegisterNewSchema("subject", userV2)
+	require.NoError(t, err)
+	latest, err := registry.GetLatestSchema("subject")
+	require.NoError(t, err)
+	assert.Equal(t, id, latest.ID)
+	_, err = registry.GetSchemaBySubject("subject", 2)
+	require.NoError(t, err)
+
+	compatible, err := registry.(CompatibilityChecker).TestCompatibility("subject", `"string"`, -1)
+	require.NoError(t, err)
+	assert.False(t, compatible)
+
+	// the deletion of a version invalidates the subject
+	version, err := registry.(VersionDeleter).DeleteSchemaVersion("subject", -1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	latest, err = registry.GetLatestSchema("subject")
+	require.NoError(t, err)
+	assert.Equal(t, 1, latest.Version)
+	_, err = registry.GetSchemaBySubject("subject", 2)
+	assertErrorCode(t, ErrorCodeVersionNotFound, err)
+
+	// the registries without these operations make them fail
+	registry = NewCachedSchemaRegistry(countingRegistry(NewMemorySchemaRegistry(), make(map[string]int)), CachedRegistryOptions{})
+	_, err = registry.(CompatibilityChecker).TestCompatibility("subject", userV1, -1)
+	assert.Equal(t, errNoCompatibilityChecker, err)
+	_, err = registry.(VersionDeleter).DeleteSchemaVersion("subject", -1)
+	assert.Equal(t, errNoVersionDeleter, err)
+}
+
+func TestCachedSchemaRegistry_latest_version(t *testing.T) {
+	registry := NewCachedSchemaRegistry(NewMemorySchemaRegistry(), CachedRegistryOptions{TTL: time.Minute})
+	id1, err := registry.RegisterNewSchema("subject", userV1)
+	require.NoError(t, err)
+	latest, err := registry.GetSchemaBySubject("subject", -1)
+	require.NoError(t, err)
+	assert.Equal(t, id1, latest.ID)
+	v1, err := registry.GetSchemaBySubject("subject", 1)
+	require.NoError(t, err)
+	assert.Equal(t, id1, v1.ID)
+
+	// the registration of a version invalidates the latest one
+	id2, err := registry.RegisterNewSchema("subject", userV2)
+	require.NoError(t, err)
+	latest, err = registry.GetSchemaBySubject("subject", -1)
+	require.NoError(t, err)
+	assert.Equal(t, id2, latest.ID)
+	assert.Equal(t, 2, latest.Version)
+	v1, err = registry.GetSchemaBySubject("subject", 1)
+	require.NoError(t, err)
+	assert.Equal(t, id1, v1.ID)
+}
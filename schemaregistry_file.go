@@ -0,0 +1,450 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// fileIndexName is the name of the file indexing the schema IDs
+const fileIndexName = "ids.json"
+
+// fileIndex indexes the schema IDs, LastID never decreasing so that a deleted ID is never reused
+type fileIndex struct {
+	LastID  int              `json:"last_id"`
+	Entries []fileIndexEntry `json:"ids"`
+}
+
+// fileIndexEntry is a registration of a schema ID under a subject version.
+// The entries of the deleted subjects are kept with their schema, which stays readable by ID.
+type fileIndexEntry struct {
+	ID      int    `json:"id"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+	Deleted bool   `json:"deleted,omitempty"`
+	Schema  string `json:"schema,omitempty"`
+}
+
+// FileSchemaRegistry is a SchemaRegistry stored in a directory, for local development, tests
+// and jobs without access to a schema registry service.
+// Each schema version is stored in <dir>/<subject>/<version>.avsc and the IDs are indexed in <dir>/ids.json.
+// Subjects are path escaped to be used as directory names.
+// As the soft deletes of the schema registry, DeleteSubject keeps the schemas readable by ID and their IDs are
+// never given to other schemas.
+type FileSchemaRegistry struct {
+	dir  string
+	lock sync.Mutex
+}
+
+// NewFileSchemaRegistry returns a SchemaRegistry stored in the given directory, created if needed
+func NewFileSchemaRegistry(dir string) (*FileSchemaRegistry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll error: %w", err)
+	}
+	return &FileSchemaRegistry{dir: dir}, nil
+}
+
+// ExportSchemaRegistry copies all the subjects of a registry, with their versions and IDs, into a directory
+// which can then be used by a FileSchemaRegistry
+func ExportSchemaRegistry(from SchemaRegistry, dir string) error {
+	to, err := NewFileSchemaRegistry(dir)
+	if err != nil {
+		return err
+	}
+	subjects, err := from.Subjects()
+	if err != nil {
+		return fmt.Errorf("Subjects error: %w", err)
+	}
+	for _, subject := range subjects {
+		versions, err := from.Versions(subject)
+		if err != nil {
+			return fmt.Errorf("Versions error for %s: %w", subject, err)
+		}
+		for _, version := range versions {
+			schema, err := from.GetSchemaBySubject(subject, version)
+			if err != nil {
+				return fmt.Errorf("GetSchemaBySubject error for %s version %d: %w", subject, version, err)
+			}
+			if err := to.put(subject, version, schema.ID, schema.Schema); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *FileSchemaRegistry) subjectDir(subject string) (string, error) {
+	if subject == "" || subject == "." || subject == ".." {
+		return "", subjectNotFoundError(subject)
+	}
+	return filepath.Join(c.dir, url.PathEscape(subject)), nil
+}
+
+func (c *FileSchemaRegistry) schemaPath(subject string, version int) (string, error) {
+	dir, err := c.subjectDir(subject)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strconv.Itoa(version)+".avsc"), nil
+}
+
+func (c *FileSchemaRegistry) readIndex() (fileIndex, error) {
+	var index fileIndex
+	raw, err := ioutil.ReadFile(filepath.Join(c.dir, fileIndexName))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return index, fmt.Errorf("ioutil.ReadFile error: %w", err)
+	}
+	// the first index format was the list of the entries
+	target := interface{}(&index)
+	if trimmed := strings.TrimSpace(string(raw)); strings.HasPrefix(trimmed, "[") {
+		target = &index.Entries
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return index, fmt.Errorf("json.Unmarshal error for %s: %w", fileIndexName, err)
+	}
+	for _, entry := range index.Entries {
+		if entry.ID > index.LastID {
+			index.LastID = entry.ID
+		}
+	}
+	return index, nil
+}
+
+func (c *FileSchemaRegistry) writeIndex(index fileIndex) error {
+	raw, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.dir, fileIndexName), raw)
+}
+
+// writeFileAtomic writes a file through a temporary file so readers never see a partial content
+func writeFileAtomic(path string, content []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("ioutil.WriteFile error: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("os.Rename error: %w", err)
+	}
+	return nil
+}
+
+func (c *FileSchemaRegistry) versions(subject string) ([]int, error) {
+	dir, err := c.subjectDir(subject)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, subjectNotFoundError(subject)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir error: %w", err)
+	}
+	var versions []int
+	for _, file := range files {
+		version, err := strconv.Atoi(strings.TrimSuffix(file.Name(), ".avsc"))
+		if err != nil || !strings.HasSuffix(file.Name(), ".avsc") {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		return nil, subjectNotFoundError(subject)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+func (c *FileSchemaRegistry) read(subject string, version int, index []fileIndexEntry) (Schema, error) {
+	path, err := c.schemaPath(subject, version)
+	if err != nil {
+		return Schema{}, err
+	}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Schema{}, ConfluentError{ErrorCodeVersionNotFound, fmt.Sprintf("Version %d not found.", version)}
+	}
+	if err != nil {
+		return Schema{}, fmt.Errorf("ioutil.ReadFile error: %w", err)
+	}
+	schema := Schema{Schema: string(raw), Subject: subject, Version: version, ID: int(UnknownID)}
+	for _, entry := range index {
+		if !entry.Deleted && entry.Subject == subject && entry.Version == version {
+			schema.ID = entry.ID
+		}
+	}
+	return schema, nil
+}
+
+// put writes a schema version with a known ID
+func (c *FileSchemaRegistry) put(subject string, version, id int, schema string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.putLocked(subject, version, id, schema)
+}
+
+func (c *FileSchemaRegistry) putLocked(subject string, version, id int, schema string) error {
+	path, err := c.schemaPath(subject, version)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll error: %w", err)
+	}
+	if err := writeFileAtomic(path, []byte(schema)); err != nil {
+		return err
+	}
+	index, err := c.readIndex()
+	if err != nil {
+		return err
+	}
+	for i, entry := range index.Entries {
+		if !entry.Deleted && entry.Subject == subject && entry.Version == version {
+			index.Entries = append(index.Entries[:i], index.Entries[i+1:]...)
+			break
+		}
+	}
+	index.Entries = append(index.Entries, fileIndexEntry{ID: id, Subject: subject, Version: version})
+	if id > index.LastID {
+		index.LastID = id
+	}
+	return c.writeIndex(index)
+}
+
+// Subjects returns all registered subjects.
+func (c *FileSchemaRegistry) Subjects() ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir error: %w", err)
+	}
+	subjects := []string{}
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		subject, err := url.PathUnescape(file.Name())
+		if err != nil {
+			continue
+		}
+		subjects = append(subjects, subject)
+	}
+	return subjects, nil
+}
+
+// Versions returns all schema version numbers registered for this subject.
+func (c *FileSchemaRegistry) Versions(subject string) ([]int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.versions(subject)
+}
+
+// RegisterNewSchema registers the given schema for this subject.
+// An identical schema already registered under any subject keeps its ID.
+func (c *FileSchemaRegistry) RegisterNewSchema(subject, schema string) (int, error) {
+	canonical, err := canonicalSchema(schema)
+	if err != nil {
+		return 0, ConfluentError{ErrorCodeInvalidSchema, fmt.Sprintf("Invalid schema: %s", err)}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	index, err := c.readIndex()
+	if err != nil {
+		return 0, err
+	}
+
+	id, version := index.LastID+1, 1
+	for _, entry := range index.Entries {
+		existing, err := c.entrySchema(entry, index)
+		if err != nil {
+			continue
+		}
+		if existingCanonical, err := canonicalSchema(existing); err == nil && existingCanonical == canonical {
+			if entry.Subject == subject && !entry.Deleted {
+				return entry.ID, nil
+			}
+			id = entry.ID
+		}
+	}
+	if versions, err := c.versions(subject); err == nil {
+		version = versions[len(versions)-1] + 1
+	}
+	return id, c.putLocked(subject, version, id, schema)
+}
+
+// IsRegistered tells if the given schema is registred for this subject.
+func (c *FileSchemaRegistry) IsRegistered(subject, schema string) (bool, Schema, error) {
+	canonical, err := canonicalSchema(schema)
+	if err != nil {
+		return false, Schema{}, ConfluentError{ErrorCodeInvalidSchema, fmt.Sprintf("Invalid schema: %s", err)}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	index, err := c.readIndex()
+	if err != nil {
+		return false, Schema{}, err
+	}
+	versions, err := c.versions(subject)
+	if isNotFound(err) {
+		return false, Schema{}, nil
+	}
+	if err != nil {
+		return false, Schema{}, err
+	}
+	for _, version := range versions {
+		existing, err := c.read(subject, version, index.Entries)
+		if err != nil {
+			return false, Schema{}, err
+		}
+		if existingCanonical, err := canonicalSchema(existing.Schema); err == nil && existingCanonical == canonical {
+			return true, existing, nil
+		}
+	}
+	return false, Schema{}, nil
+}
+
+// GetSchemaByID returns the schema for some id.
+func (c *FileSchemaRegistry) GetSchemaByID(id int) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	index, err := c.readIndex()
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range index.Entries {
+		if entry.ID == id {
+			return c.entrySchema(entry, index)
+		}
+	}
+	return "", ConfluentError{ErrorCodeSchemaNotFound, fmt.Sprintf("Schema %d not found", id)}
+}
+
+// GetSchemaBySubject returns the schema for a particular subject and version.
+// The version -1 designates the latest version.
+func (c *FileSchemaRegistry) GetSchemaBySubject(subject string, ver int) (Schema, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	versions, err := c.versions(subject)
+	if err != nil {
+		return Schema{}, err
+	}
+	if ver == -1 {
+		ver = versions[len(versions)-1]
+	}
+	index, err := c.readIndex()
+	if err != nil {
+		return Schema{}, err
+	}
+	return c.read(subject, ver, index.Entries)
+}
+
+// GetLatestSchema returns the latest version of the subject's schema.
+func (c *FileSchemaRegistry) GetLatestSchema(subject string) (Schema, error) {
+	return c.GetSchemaBySubject(subject, -1)
+}
+
+// DeleteSubject removes a list of schema under the given subject.
+// Their IDs stay reserved and their schemas readable by ID.
+func (c *FileSchemaRegistry) DeleteSubject(subject string) ([]int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	versions, err := c.versions(subject)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := c.subjectDir(subject)
+	if err != nil {
+		return nil, err
+	}
+	index, err := c.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range index.Entries {
+		if entry.Deleted || entry.Subject != subject {
+			continue
+		}
+		schema, err := c.read(subject, entry.Version, index.Entries)
+		if err != nil {
+			return nil, err
+		}
+		index.Entries[i].Deleted = true
+		index.Entries[i].Schema = schema.Schema
+	}
+	if err := c.writeIndex(index); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("os.RemoveAll error: %w", err)
+	}
+	return versions, nil
+}
+
+// entrySchema returns the schema of an index entry, kept in the index once its subject is deleted
+func (c *FileSchemaRegistry) entrySchema(entry fileIndexEntry, index fileIndex) (string, error) {
+	if entry.Deleted {
+		return entry.Schema, nil
+	}
+	schema, err := c.read(entry.Subject, entry.Version, index.Entries)
+	if err != nil {
+		return "", err
+	}
+	return schema.Schema, nil
+}
+
+// canonicalSchema validates a schema and returns its normalized JSON, used to compare schemas.
+// Unlike the parsing canonical form it keeps defaults, docs and aliases,
+// as the schema registry does not consider schemas differing by them identical.
+func canonicalSchema(schema string) (string, error) {
+	if _, err := goavro.NewCodec(schema); err != nil {
+		return "", err
+	}
+	decoder := json.NewDecoder(strings.NewReader(schema))
+	decoder.UseNumber()
+	var normalized interface{}
+	if err := decoder.Decode(&normalized); err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(collapseTypes(normalized))
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// collapseTypes replaces the objects only holding a type name, like {"type": "string"}, by the name
+func collapseTypes(schema interface{}) interface{} {
+	switch s := schema.(type) {
+	case map[string]interface{}:
+		if name, ok := s["type"].(string); ok && len(s) == 1 {
+			return name
+		}
+		for key, value := range s {
+			// defaults are values, not schemas
+			if key != "default" {
+				s[key] = collapseTypes(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range s {
+			s[i] = collapseTypes(value)
+		}
+	}
+	return schema
+}
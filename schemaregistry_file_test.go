@@ -0,0 +1,165 @@
+package avro
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "avrocado")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestFileSchemaRegistry(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	registry, err := NewFileSchemaRegistry(dir)
+	require.NoError(t, err)
+
+	_, err = registry.RegisterNewSchema("people", `{"type": "unknown"}`)
+	assert.Error(t, err)
+
+	id1, err := registry.RegisterNewSchema("people", `"string"`)
+	require.NoError(t, err)
+	id2, err := registry.RegisterNewSchema("people", `"int"`)
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	again, err := registry.RegisterNewSchema("people", `{"type": "string"}`)
+	require.NoError(t, err)
+	assert.Equal(t, id1, again, "an identical schema is not registered twice")
+
+	other, err := registry.RegisterNewSchema("org/people", `"int"`)
+	require.NoError(t, err)
+	assert.Equal(t, id2, other, "an identical schema keeps its ID in another subject")
+
+	assert.FileExists(t, filepath.Join(dir, "people", "2.avsc"))
+	assert.FileExists(t, filepath.Join(dir, "org%2Fpeople", "1.avsc"))
+
+	subjects, err := registry.Subjects()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"people", "org/people"}, subjects)
+
+	versions, err := registry.Versions("people")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	isRegistered, schema, err := registry.IsRegistered("people", `"int"`)
+	require.NoError(t, err)
+	assert.True(t, isRegistered)
+	assert.Equal(t, Schema{Schema: `"int"`, Subject: "people", Version: 2, ID: id2}, schema)
+	_, _, err = registry.IsRegistered("people", `{"type": "unknown"}`)
+	assertErrorCode(t, ErrorCodeInvalidSchema, err)
+
+	raw, err := registry.GetSchemaByID(id1)
+	require.NoError(t, err)
+	assert.Equal(t, `"string"`, raw)
+	_, err = registry.GetSchemaByID(42)
+	assert.True(t, isNotFound(err))
+
+	schema, err = registry.GetSchemaBySubject("people", 1)
+	require.NoError(t, err)
+	assert.Equal(t, id1, schema.ID)
+	latest, err := registry.GetLatestSchema("people")
+	require.NoError(t, err)
+	assert.Equal(t, id2, latest.ID)
+	schema, err = registry.GetSchemaBySubject("people", -1)
+	require.NoError(t, err)
+	assert.Equal(t, latest, schema)
+
+	deleted, err := registry.DeleteSubject("people")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, deleted)
+	_, err = registry.GetLatestSchema("people")
+	assert.True(t, isNotFound(err))
+	raw, err = registry.GetSchemaByID(id2)
+	require.NoError(t, err, "the schema is still registered under another subject")
+	assert.Equal(t, `"int"`, raw)
+}
+
+func TestFileSchemaRegistry_with_CodecRegistry(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	source, err := NewFileSchemaRegistry(filepath.Join(dir, "source"))
+	require.NoError(t, err)
+	_, err = source.RegisterNewSchema("other", `"string"`)
+	require.NoError(t, err)
+	id, err := source.RegisterNewSchema("people", personSchema)
+	require.NoError(t, err)
+
+	require.NoError(t, ExportSchemaRegistry(source, filepath.Join(dir, "export")))
+	registry, err := NewFileSchemaRegistry(filepath.Join(dir, "export"))
+	require.NoError(t, err)
+
+	codec, err := NewCodecRegistryWithClient(registry, "people", personSchema)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaID(id), codec.SchemaID, "the IDs are kept by the export")
+
+	avro, err := codec.Marshal(Person{"Nico", 36})
+	require.NoError(t, err)
+	var decoded Person
+	require.NoError(t, codec.Unmarshal(avro, &decoded))
+	assert.Equal(t, Person{"Nico", 36}, decoded)
+}
+
+func TestFileSchemaRegistry_DeleteSubject_keeps_IDs(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	registry, err := NewFileSchemaRegistry(dir)
+	require.NoError(t, err)
+
+	idA, err := registry.RegisterNewSchema("a", `"string"`)
+	require.NoError(t, err)
+	idB, err := registry.RegisterNewSchema("b", `"int"`)
+	require.NoError(t, err)
+	_, err = registry.DeleteSubject("b")
+	require.NoError(t, err)
+
+	idC, err := registry.RegisterNewSchema("c", `"long"`)
+	require.NoError(t, err)
+	assert.NotEqual(t, idA, idC)
+	assert.NotEqual(t, idB, idC, "the ID of a deleted subject is not reused")
+	raw, err := registry.GetSchemaByID(idB)
+	require.NoError(t, err, "the schemas of the deleted subjects stay readable by ID")
+	assert.Equal(t, `"int"`, raw)
+	raw, err = registry.GetSchemaByID(idC)
+	require.NoError(t, err)
+	assert.Equal(t, `"long"`, raw)
+
+	// the IDs survive the registry instance
+	registry, err = NewFileSchemaRegistry(dir)
+	require.NoError(t, err)
+	again, err := registry.RegisterNewSchema("b", `"int"`)
+	require.NoError(t, err)
+	assert.Equal(t, idB, again, "an identical schema keeps its ID")
+	latest, err := registry.GetLatestSchema("b")
+	require.NoError(t, err)
+	assert.Equal(t, Schema{Schema: `"int"`, Subject: "b", Version: 1, ID: idB}, latest)
+	idD, err := registry.RegisterNewSchema("d", `"double"`)
+	require.NoError(t, err)
+	assert.Equal(t, idC+1, idD)
+}
+
+func TestFileSchemaRegistry_legacy_index(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a", "1.avsc"), []byte(`"string"`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, fileIndexName), []byte(`[{"id": 3, "subject": "a", "version": 1}]`), 0644))
+
+	registry, err := NewFileSchemaRegistry(dir)
+	require.NoError(t, err)
+	raw, err := registry.GetSchemaByID(3)
+	require.NoError(t, err)
+	assert.Equal(t, `"string"`, raw)
+	id, err := registry.RegisterNewSchema("a", `"int"`)
+	require.NoError(t, err)
+	assert.Equal(t, 4, id)
+}
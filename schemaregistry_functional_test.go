@@ -1,4 +1,4 @@
-package avro
+package avro_test
 
 import (
 	"fmt"
@@ -8,13 +8,18 @@ import (
 	"testing"
 	"unicode"
 
+	avro "github.com/leboncoin/avrocado"
+	"github.com/leboncoin/avrocado/avrotest"
 	"github.com/stretchr/testify/assert"
 )
 
-var SchemaRegistryURL string
+var (
+	SchemaRegistryURL string
+	server            *avrotest.Server
+)
 
 func WipeRegistry() {
-	c, err := NewSchemaRegistry(SchemaRegistryURL)
+	c, err := avro.NewSchemaRegistry(SchemaRegistryURL)
 	if err != nil {
 		panic(fmt.Sprintf("unable to teardown: %s", err))
 	}
@@ -42,7 +47,14 @@ func stripSpaces(s string) string {
 	return strings.Map(f, s)
 }
 
+// Setup targets the schema registry of the integration environment if GO_INTEGRATION_TESTS is set,
+// a fake one otherwise
 func Setup() {
+	if os.Getenv("GO_INTEGRATION_TESTS") != "1" {
+		server = avrotest.NewServer()
+		SchemaRegistryURL = server.URL
+		return
+	}
 	SchemaRegistryURL = os.Getenv("SCHEMA_REGISTRY_URL")
 	if SchemaRegistryURL == "" {
 		SchemaRegistryURL = "http://schemaregistry:8081"
@@ -50,11 +62,10 @@ func Setup() {
 }
 
 func TearDown() {
-	if os.Getenv("GO_INTEGRATION_TESTS") != "1" {
-		return
-	}
-
 	WipeRegistry()
+	if server != nil {
+		server.Close()
+	}
 }
 
 func TestMain(m *testing.M) {
@@ -83,10 +94,6 @@ func containsSliceString(a []string, b []string) bool {
 }
 
 func TestFunctionalSubjects(t *testing.T) {
-	if os.Getenv("GO_INTEGRATION_TESTS") != "1" {
-		t.Skip("not running integration tests")
-	}
-
 	schema := `
 	{
 	    "type" : "record",
@@ -95,7 +102,7 @@ func TestFunctionalSubjects(t *testing.T) {
 	    "fields" : [{"name" : "age", "type" : "int", "default" : -1}]
 	}`
 
-	c, err := NewSchemaRegistry(SchemaRegistryURL)
+	c, err := avro.NewSchemaRegistry(SchemaRegistryURL)
 	assert.NoError(t, err)
 
 	subsIn := []string{"rollulus", "hello-subject"}
@@ -115,10 +122,6 @@ func TestFunctionalSubjects(t *testing.T) {
 }
 
 func TestFunctionalVersions(t *testing.T) {
-	if os.Getenv("GO_INTEGRATION_TESTS") != "1" {
-		t.Skip("not running integration tests")
-	}
-
 	schemas := []string{`
 	{
 	    "type" : "record",
@@ -143,7 +146,7 @@ func TestFunctionalVersions(t *testing.T) {
 	}`,
 	}
 
-	c, err := NewSchemaRegistry(SchemaRegistryURL)
+	c, err := avro.NewSchemaRegistry(SchemaRegistryURL)
 	assert.NoError(t, err)
 
 	subject := "mysubject"
@@ -161,10 +164,6 @@ func TestFunctionalVersions(t *testing.T) {
 }
 
 func TestFunctionalIsRegistered_yes(t *testing.T) {
-	if os.Getenv("GO_INTEGRATION_TESTS") != "1" {
-		t.Skip("not running integration tests")
-	}
-
 	schema := `
 	{
 	    "type" : "record",
@@ -176,9 +175,9 @@ func TestFunctionalIsRegistered_yes(t *testing.T) {
 
 	subject := "newsubject"
 
-	sIn := Schema{schema, subject, 1, 7}
+	sIn := avro.Schema{schema, subject, 1, 7}
 
-	c, err := NewSchemaRegistry(SchemaRegistryURL)
+	c, err := avro.NewSchemaRegistry(SchemaRegistryURL)
 	assert.NoError(t, err)
 
 	id, err := c.RegisterNewSchema(subject, schema)
@@ -197,11 +196,7 @@ func TestFunctionalIsRegistered_yes(t *testing.T) {
 }
 
 func TestFunctionalIsRegistered_not(t *testing.T) {
-	if os.Getenv("GO_INTEGRATION_TESTS") != "1" {
-		t.Skip("not running integration tests")
-	}
-
-	c, err := NewSchemaRegistry(SchemaRegistryURL)
+	c, err := avro.NewSchemaRegistry(SchemaRegistryURL)
 	assert.NoError(t, err)
 
 	isreg, _, err := c.IsRegistered("mysubject", "{}")
@@ -0,0 +1,268 @@
+package avro
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemorySchemaRegistry is a SchemaRegistry kept in memory which follows the semantics of the
+// Confluent schema registry, to be used as a test double:
+// - versions start at 1 and are never reused inside a subject
+// - an identical schema keeps the same ID across subjects and is not registered twice in a subject
+// - lookups of unknown subjects, versions or IDs return a ConfluentError with the registry's error code
+// - registrations breaking the compatibility level of the subject are rejected
+//
+// It is safe for concurrent use.
+type MemorySchemaRegistry struct {
+	lock                 sync.RWMutex
+	lastID               int
+	schemaByID           map[int]string
+	idByCanonical        map[string]int
+	subjects             map[string][]Schema
+	lastVersion          map[string]int
+	compatibility        CompatibilityLevel
+	subjectCompatibility map[string]CompatibilityLevel
+}
+
+// NewMemorySchemaRegistry returns an empty MemorySchemaRegistry enforcing the default compatibility
+func NewMemorySchemaRegistry() *MemorySchemaRegistry {
+	return &MemorySchemaRegistry{
+		schemaByID:           make(map[int]string),
+		idByCanonical:        make(map[string]int),
+		subjects:             make(map[string][]Schema),
+		lastVersion:          make(map[string]int),
+		compatibility:        DefaultCompatibility,
+		subjectCompatibility: make(map[string]CompatibilityLevel),
+	}
+}
+
+func subjectNotFoundError(subject string) error {
+	return ConfluentError{ErrorCodeSubjectNotFound, fmt.Sprintf("Subject '%s' not found.", subject)}
+}
+
+// Subjects returns all registered subjects.
+func (c *MemorySchemaRegistry) Subjects() ([]string, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	subjects := make([]string, 0, len(c.subjects))
+	for subject := range c.subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects, nil
+}
+
+// Versions returns all schema version numbers registered for this subject.
+func (c *MemorySchemaRegistry) Versions(subject string) ([]int, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.versionsLocked(subject)
+}
+
+func (c *MemorySchemaRegistry) versionsLocked(subject string) ([]int, error) {
+	schemas, ok := c.subjects[subject]
+	if !ok {
+		return nil, subjectNotFoundError(subject)
+	}
+	versions := make([]int, 0, len(schemas))
+	for _, schema := range schemas {
+		versions = append(versions, schema.Version)
+	}
+	return versions, nil
+}
+
+// RegisterNewSchema registers the given schema for this subject.
+func (c *MemorySchemaRegistry) RegisterNewSchema(subject, schema string) (int, error) {
+	canonical, err := canonicalSchema(schema)
+	if err != nil {
+		return 0, ConfluentError{ErrorCodeInvalidSchema, fmt.Sprintf("Invalid schema: %s", err)}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if existing, ok := c.find(subject, canonical); ok {
+		return existing.ID, nil
+	}
+	if err := c.check(subject, schema); err != nil {
+		return 0, ConfluentError{ErrorCodeIncompatibleSchema, fmt.Sprintf("Schema being registered is incompatible with an earlier schema: %s", err)}
+	}
+
+	id, ok := c.idByCanonical[canonical]
+	if !ok {
+		c.lastID++
+		id = c.lastID
+		c.idByCanonical[canonical] = id
+		c.schemaByID[id] = schema
+	}
+	c.lastVersion[subject]++
+	c.subjects[subject] = append(c.subjects[subject], Schema{
+		Schema:  schema,
+		Subject: subject,
+		Version: c.lastVersion[subject],
+		ID:      id,
+	})
+	return id, nil
+}
+
+// find returns the version of the subject matching the canonical form of a schema
+func (c *MemorySchemaRegistry) find(subject, canonical string) (Schema, bool) {
+	id, ok := c.idByCanonical[canonical]
+	if !ok {
+		return Schema{}, false
+	}
+	for _, schema := range c.subjects[subject] {
+		if schema.ID == id {
+			return schema, true
+		}
+	}
+	return Schema{}, false
+}
+
+// check checks the compatibility of a schema with the versions of a subject
+func (c *MemorySchemaRegistry) check(subject, schema string) error {
+	var previous []string
+	for _, existing := range c.subjects[subject] {
+		previous = append(previous, existing.Schema)
+	}
+	return checkCompatibility(c.compatibilityLocked(subject), schema, previous)
+}
+
+// IsRegistered tells if the given schema is registred for this subject.
+func (c *MemorySchemaRegistry) IsRegistered(subject, schema string) (bool, Schema, error) {
+	canonical, err := canonicalSchema(schema)
+	if err != nil {
+		return false, Schema{}, ConfluentError{ErrorCodeInvalidSchema, fmt.Sprintf("Invalid schema: %s", err)}
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	existing, ok := c.find(subject, canonical)
+	return ok, existing, nil
+}
+
+// GetSchemaByID returns the schema for some id.
+func (c *MemorySchemaRegistry) GetSchemaByID(id int) (string, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	schema, ok := c.schemaByID[id]
+	if !ok {
+		return "", ConfluentError{ErrorCodeSchemaNotFound, fmt.Sprintf("Schema %d not found", id)}
+	}
+	return schema, nil
+}
+
+// GetSchemaBySubject returns the schema for a particular subject and version.
+// The version -1 designates the latest version.
+func (c *MemorySchemaRegistry) GetSchemaBySubject(subject string, ver int) (Schema, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.schemaLocked(subject, ver)
+}
+
+func (c *MemorySchemaRegistry) schemaLocked(subject string, ver int) (Schema, error) {
+	schemas, ok := c.subjects[subject]
+	if !ok {
+		return Schema{}, subjectNotFoundError(subject)
+	}
+	if ver == -1 {
+		return schemas[len(schemas)-1], nil
+	}
+	for _, schema := range schemas {
+		if schema.Version == ver {
+			return schema, nil
+		}
+	}
+	return Schema{}, ConfluentError{ErrorCodeVersionNotFound, fmt.Sprintf("Version %d not found.", ver)}
+}
+
+// GetLatestSchema returns the latest version of the subject's schema.
+func (c *MemorySchemaRegistry) GetLatestSchema(subject string) (Schema, error) {
+	return c.GetSchemaBySubject(subject, -1)
+}
+
+// DeleteSubject removes a list of schema under the given subject
+func (c *MemorySchemaRegistry) DeleteSubject(subject string) ([]int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	versions, err := c.versionsLocked(subject)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.subjects, subject)
+	return versions, nil
+}
+
+// DeleteSchemaVersion removes a version of the subject, -1 designating the latest one.
+// It returns the deleted version.
+func (c *MemorySchemaRegistry) DeleteSchemaVersion(subject string, version int) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	schema, err := c.schemaLocked(subject, version)
+	if err != nil {
+		return 0, err
+	}
+	schemas := c.subjects[subject]
+	for i, existing := range schemas {
+		if existing.Version == schema.Version {
+			schemas = append(schemas[:i:i], schemas[i+1:]...)
+			break
+		}
+	}
+	if len(schemas) == 0 {
+		delete(c.subjects, subject)
+	} else {
+		c.subjects[subject] = schemas
+	}
+	return schema.Version, nil
+}
+
+// TestCompatibility tells if the schema is compatible with a version of the subject given its compatibility level.
+// The version -1 checks the schema as a registration would, against the latest version or all of them
+// for a transitive level. An unknown subject returns the ConfluentError of ErrorCodeSubjectNotFound.
+func (c *MemorySchemaRegistry) TestCompatibility(subject, schema string, version int) (bool, error) {
+	if _, err := canonicalSchema(schema); err != nil {
+		return false, ConfluentError{ErrorCodeInvalidSchema, fmt.Sprintf("Invalid schema: %s", err)}
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if _, ok := c.subjects[subject]; !ok {
+		return false, subjectNotFoundError(subject)
+	}
+	if version == -1 {
+		return c.check(subject, schema) == nil, nil
+	}
+	existing, err := c.schemaLocked(subject, version)
+	if err != nil {
+		return false, err
+	}
+	return checkCompatibility(c.compatibilityLocked(subject), schema, []string{existing.Schema}) == nil, nil
+}
+
+// Compatibility returns the compatibility level of a subject, or the global one if subject is empty
+func (c *MemorySchemaRegistry) Compatibility(subject string) CompatibilityLevel {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.compatibilityLocked(subject)
+}
+
+func (c *MemorySchemaRegistry) compatibilityLocked(subject string) CompatibilityLevel {
+	if level, ok := c.subjectCompatibility[subject]; ok {
+		return level
+	}
+	return c.compatibility
+}
+
+// SetCompatibility sets the compatibility level of a subject, or the global one if subject is empty
+func (c *MemorySchemaRegistry) SetCompatibility(subject string, level CompatibilityLevel) error {
+	if !level.IsValid() {
+		return ConfluentError{ErrorCodeInvalidCompatibilityLevel, fmt.Sprintf("Invalid compatibility level %q", level)}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if subject == "" {
+		c.compatibility = level
+	} else {
+		c.subjectCompatibility[subject] = level
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package avro
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertErrorCode(t *testing.T, code int, err error) {
+	var ce ConfluentError
+	if assert.True(t, errors.As(err, &ce), "%v is not a ConfluentError", err) {
+		assert.Equal(t, code, ce.ErrorCode)
+	}
+}
+
+const (
+	userV1 = `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}]}`
+	userV2 = `{"type": "record", "name": "user", "fields": [
+	  {"name": "name", "type": "string"},
+	  {"name": "age", "type": "int", "default": 0}
+	]}`
+	userV3 = `{"type": "record", "name": "user", "fields": [
+	  {"name": "name", "type": "string"},
+	  {"name": "age", "type": "int", "default": 0},
+	  {"name": "city", "type": "string"}
+	]}`
+)
+
+func TestMemorySchemaRegistry(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+
+	id1, err := registry.RegisterNewSchema("a", userV1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id1)
+	id2, err := registry.RegisterNewSchema("a", userV2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, id2)
+	idB, err := registry.RegisterNewSchema("b", userV1)
+	require.NoError(t, err)
+	assert.Equal(t, id1, idB, "an identical schema keeps its ID across subjects")
+	again, err := registry.RegisterNewSchema("a", `{"name": "user", "type": "record", "fields": [{"type": "string", "name": "name"}]}`)
+	require.NoError(t, err)
+	assert.Equal(t, id1, again, "an identical schema is not registered twice")
+
+	versions, err := registry.Versions("a")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+	versions, err = registry.Versions("b")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, versions)
+
+	schema, err := registry.GetSchemaBySubject("a", 2)
+	require.NoError(t, err)
+	assert.Equal(t, Schema{Schema: userV2, Subject: "a", Version: 2, ID: id2}, schema)
+	_, err = registry.GetSchemaBySubject("a", 3)
+	assertErrorCode(t, ErrorCodeVersionNotFound, err)
+	_, err = registry.GetSchemaBySubject("c", 1)
+	assertErrorCode(t, ErrorCodeSubjectNotFound, err)
+	_, err = registry.GetSchemaByID(42)
+	assertErrorCode(t, ErrorCodeSchemaNotFound, err)
+	_, err = registry.RegisterNewSchema("a", `{}`)
+	assertErrorCode(t, ErrorCodeInvalidSchema, err)
+
+	isRegistered, schema, err := registry.IsRegistered("b", userV1)
+	require.NoError(t, err)
+	assert.True(t, isRegistered)
+	assert.Equal(t, 1, schema.Version)
+	isRegistered, _, err = registry.IsRegistered("b", userV2)
+	require.NoError(t, err)
+	assert.False(t, isRegistered)
+
+	deleted, err := registry.DeleteSubject("a")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, deleted)
+	_, err = registry.DeleteSubject("a")
+	assertErrorCode(t, ErrorCodeSubjectNotFound, err)
+	subjects, err := registry.Subjects()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, subjects)
+
+	// Versions are not reused
+	_, err = registry.RegisterNewSchema("a", userV1)
+	require.NoError(t, err)
+	latest, err := registry.GetLatestSchema("a")
+	require.NoError(t, err)
+	assert.Equal(t, 3, latest.Version)
+
+	version, err := registry.DeleteSchemaVersion("a", -1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+	_, err = registry.Versions("a")
+	assertErrorCode(t, ErrorCodeSubjectNotFound, err)
+}
+
+func TestMemorySchemaRegistry_compatibility(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	assert.Equal(t, CompatibilityBackward, registry.Compatibility("a"))
+
+	_, err := registry.RegisterNewSchema("a", userV1)
+	require.NoError(t, err)
+	_, err = registry.RegisterNewSchema("a", userV3)
+	assertErrorCode(t, ErrorCodeIncompatibleSchema, err)
+
+	compatible, err := registry.TestCompatibility("a", userV2, -1)
+	require.NoError(t, err)
+	assert.True(t, compatible)
+	compatible, err = registry.TestCompatibility("a", `"string"`, 1)
+	require.NoError(t, err)
+	assert.False(t, compatible)
+	_, err = registry.TestCompatibility("a", userV2, 2)
+	assertErrorCode(t, ErrorCodeVersionNotFound, err)
+	_, err = registry.TestCompatibility("unknown", userV2, -1)
+	assertErrorCode(t, ErrorCodeSubjectNotFound, err)
+
+	assertErrorCode(t, ErrorCodeInvalidCompatibilityLevel, registry.SetCompatibility("a", "SOMETIMES"))
+	require.NoError(t, registry.SetCompatibility("a", CompatibilityForward))
+	assert.Equal(t, CompatibilityForward, registry.Compatibility("a"))
+	assert.Equal(t, CompatibilityBackward, registry.Compatibility(""))
+	_, err = registry.RegisterNewSchema("a", userV3)
+	require.NoError(t, err, "the previous schema can read the new one")
+
+	require.NoError(t, registry.SetCompatibility("", CompatibilityNone))
+	_, err = registry.RegisterNewSchema("b", userV1)
+	require.NoError(t, err)
+	_, err = registry.RegisterNewSchema("b", `"string"`)
+	require.NoError(t, err)
+}
+
+func TestNewNOOPClient_compatibility(t *testing.T) {
+	registry := NewNOOPClient()
+	assert.Equal(t, CompatibilityNone, registry.(*MemorySchemaRegistry).Compatibility(""))
+
+	_, err := registry.RegisterNewSchema("a", userV1)
+	require.NoError(t, err)
+	_, err = registry.RegisterNewSchema("a", `"string"`)
+	require.NoError(t, err, "the NOOP client accepts any schema")
+}
+
+func TestCheckCompatibility_transitive(t *testing.T) {
+	v1 := `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}]}`
+	v2 := `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string", "default": ""}]}`
+	v3 := `{"type": "record", "name": "user", "fields": []}`
+	// v3 can't be read by v1 which has no default for name
+	assert.NoError(t, checkCompatibility(CompatibilityForward, v3, []string{v1, v2}))
+	assert.Error(t, checkCompatibility(CompatibilityForwardTransitive, v3, []string{v1, v2}))
+	assert.Error(t, checkCompatibility(CompatibilityFull, v1, []string{v3}))
+}
+
+func TestMemorySchemaRegistry_concurrency(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			subject := fmt.Sprintf("subject-%d", i%4)
+			id, err := registry.RegisterNewSchema(subject, userV1)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, id)
+			_, err = registry.GetSchemaByID(id)
+			assert.NoError(t, err)
+			_, err = registry.Subjects()
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	subjects, err := registry.Subjects()
+	require.NoError(t, err)
+	assert.Len(t, subjects, 4)
+}
+
+func TestMemorySchemaRegistry_concurrent_deletions(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	for i := 0; i < 10; i++ {
+		_, err := registry.RegisterNewSchema("a", userV1)
+		require.NoError(t, err)
+		_, err = registry.RegisterNewSchema("a", userV2)
+		require.NoError(t, err)
+
+		// a version and a subject are deleted once
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		deleted := make(map[int]int)
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				version, err := registry.DeleteSchemaVersion("a", 1+2*i)
+				if err == nil {
+					lock.Lock()
+					deleted[version]++
+					lock.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Len(t, deleted, 1)
+		assert.Equal(t, 1, deleted[1+2*i])
+
+		errs := make(chan error, 4)
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := registry.DeleteSubject("a")
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		succeeded := 0
+		for err := range errs {
+			if err == nil {
+				succeeded++
+			} else {
+				assertErrorCode(t, ErrorCodeSubjectNotFound, err)
+			}
+		}
+		assert.Equal(t, 1, succeeded)
+	}
+}
@@ -1,7 +1,5 @@
 package avro
 
-import "fmt"
-
 // NewNOOPCodecRegistry returns a CodecRegistry that uses the NOOP
 // schema registry
 func NewNOOPCodecRegistry(subject string) *CodecRegistry {
@@ -57,88 +55,13 @@ func (c *mockSchemaRegistry) DeleteSubject(subject string) ([]int, error) {
 	return c.DeleteSubjectFn(subject)
 }
 
-// NewNOOPClient is a mock schema registry which can be used for testing purposes
-// nolint
+// NewNOOPClient is a mock schema registry which can be used for testing purposes.
+// It is a MemorySchemaRegistry, which follows the semantics of the Confluent schema registry,
+// except that it checks no compatibility (CompatibilityNone) as the NOOP client always did.
+//
+// Deprecated: use NewMemorySchemaRegistry.
 func NewNOOPClient() SchemaRegistry {
-	var newID int
-	ptrNewID := &newID
-	store := make(map[string][]Schema)
-	return &mockSchemaRegistry{
-		SubjectsFn: func() (subjects []string, err error) {
-			var keys []string
-			for key := range store {
-				keys = append(keys, key)
-			}
-			return keys, nil
-		},
-		VersionsFn: func(subject string) (versions []int, err error) {
-			for _, schemas := range store {
-				for i := range schemas {
-					versions = append(versions, i)
-				}
-			}
-			return versions, nil
-		},
-		RegisterNewSchemaFn: func(subject, rawSchema string) (int, error) {
-			var schema Schema
-			schema.Schema = rawSchema
-			schema.Subject = subject
-			schemas, ok := store[subject]
-			if !ok {
-				schemas = []Schema{}
-			}
-			schema.ID = *ptrNewID
-			*ptrNewID++
-			schema.Version = len(schemas)
-			schemas = append(schemas, schema)
-
-			store[subject] = schemas
-
-			return schema.ID, nil
-		},
-		IsRegisteredFn: func(subject, schema string) (bool, Schema, error) {
-			schemas, ok := store[subject]
-			if !ok {
-				return false, Schema{}, nil
-			}
-			for _, s := range schemas {
-				if schema == s.Schema {
-					return true, s, nil
-				}
-			}
-			return false, Schema{}, nil
-		},
-		GetSchemaByIDFn: func(id int) (string, error) {
-			for _, schemas := range store {
-				for _, schema := range schemas {
-					if schema.ID == id {
-						return schema.Schema, nil
-					}
-				}
-			}
-			return "", fmt.Errorf("schema not found")
-		},
-		GetSchemaBySubjectFn: func(subject string, ver int) (Schema, error) {
-			return Schema{}, nil
-		},
-		GetLatestSchemaFn: func(subject string) (Schema, error) {
-			schemas, ok := store[subject]
-			if !ok {
-				return Schema{}, fmt.Errorf("subject not found")
-			}
-			if len(schemas) == 0 {
-				return Schema{}, fmt.Errorf("no schema found in this subject")
-			}
-			return schemas[len(schemas)-1], nil
-		},
-		DeleteSubjectFn: func(subject string) (versions []int, err error) {
-			for _, schemas := range store {
-				for i := range schemas {
-					versions = append(versions, i)
-				}
-			}
-			delete(store, subject)
-			return versions, nil
-		},
-	}
+	registry := NewMemorySchemaRegistry()
+	registry.compatibility = CompatibilityNone
+	return registry
 }
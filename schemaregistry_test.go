@@ -72,7 +72,7 @@ func httpSuccess(t *testing.T, method, path string, reqBody, respBody interface{
 }
 
 func httpError(t *testing.T, status, errCode int, errMsg string) SchemaRegistry {
-	return &ConfluentSchemaRegistry{getURL(), dummyHTTPHandler(t, "", "", status, nil, confluentError{errCode, errMsg})}
+	return &ConfluentSchemaRegistry{getURL(), dummyHTTPHandler(t, "", "", status, nil, ConfluentError{errCode, errMsg})}
 }
 
 func mustEqual(t *testing.T, actual, expected interface{}) {
@@ -117,7 +117,7 @@ func TestIsRegistered_yes(t *testing.T) {
 }
 
 func TestIsRegistered_not(t *testing.T) {
-	c := httpError(t, 404, schemaNotFound, "too bad")
+	c := httpError(t, 404, ErrorCodeSchemaNotFound, "too bad")
 	isreg, _, err := c.IsRegistered("mysubject", "{}")
 	if err != nil {
 		t.Error()
@@ -126,3 +126,24 @@ func TestIsRegistered_not(t *testing.T) {
 		t.Error()
 	}
 }
+
+func TestDeleteSchemaVersion(t *testing.T) {
+	c := httpSuccess(t, "DELETE", "/subjects/mysubject/versions/latest", nil, 3)
+	version, err := c.(VersionDeleter).DeleteSchemaVersion("mysubject", -1)
+	if err != nil {
+		t.Error(err)
+	}
+	mustEqual(t, version, 3)
+}
+
+func TestTestCompatibility(t *testing.T) {
+	s := `{"x":"y"}`
+	c := httpSuccess(t, "POST", "/compatibility/subjects/mysubject/versions/2", simpleSchema{s}, map[string]bool{"is_compatible": true})
+	isCompatible, err := c.(CompatibilityChecker).TestCompatibility("mysubject", s, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if !isCompatible {
+		t.Error()
+	}
+}
@@ -0,0 +1,167 @@
+package avro
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// AppendMarshaler is implemented by the marshalers able to append the encoding of a value to a buffer
+type AppendMarshaler interface {
+	AppendMarshal(dst []byte, v interface{}) ([]byte, error)
+}
+
+// NextUnmarshaler is implemented by the unmarshalers able to decode the datum at the beginning of a buffer
+// and to return the bytes following it, as Codec, CodecRegistry and GlueCodecRegistry
+type NextUnmarshaler interface {
+	UnmarshalNext(from []byte, to interface{}) ([]byte, error)
+}
+
+// minRead is the minimal size of the reads of a Decoder
+const minRead = 4096
+
+// DefaultMaxDatumSize is the maximum size of a datum read by a Decoder, unless its MaxSize is set
+const DefaultMaxDatumSize = 64 << 20
+
+// ErrDatumTooLarge is returned when a datum exceeds the maximum size of the data buffered to decode it
+var ErrDatumTooLarge = errors.New("the datum exceeds the maximum size")
+
+// Encoder writes a sequence of datums to an io.Writer, reusing its buffer between the datums.
+// The datums are written back-to-back, without any framing.
+type Encoder struct {
+	w         io.Writer
+	marshaler AppendMarshaler
+	buf       []byte
+}
+
+// NewEncoder returns an Encoder writing to w the datums encoded by the marshaler
+func NewEncoder(w io.Writer, marshaler AppendMarshaler) *Encoder {
+	return &Encoder{w: w, marshaler: marshaler}
+}
+
+// NewEncoder returns an Encoder writing datums encoded by the codec to w
+func (c *Codec) NewEncoder(w io.Writer) *Encoder {
+	return NewEncoder(w, c)
+}
+
+// Encode writes the encoding of v
+func (e *Encoder) Encode(v interface{}) error {
+	buf, err := e.marshaler.AppendMarshal(e.buf[:0], v)
+	if err != nil {
+		return err
+	}
+	e.buf = buf
+	_, err = e.w.Write(buf)
+	return err
+}
+
+// Decoder reads a sequence of back-to-back datums from an io.Reader
+type Decoder struct {
+	// MaxSize bounds the bytes buffered to decode a datum, DefaultMaxDatumSize when zero
+	MaxSize int
+
+	r    io.Reader
+	next func(buf []byte, v interface{}) ([]byte, error)
+	// buf holds the data read and not decoded yet
+	buf []byte
+	err error
+}
+
+// NewDecoder returns a Decoder reading from r the datums decoded by the unmarshaler,
+// such as the framed payloads of a CodecRegistry
+func NewDecoder(r io.Reader, unmarshaler NextUnmarshaler) *Decoder {
+	return &Decoder{r: r, next: unmarshaler.UnmarshalNext}
+}
+
+// NewDecoder returns a Decoder reading datums written with the codec's schema from r
+func (c *Codec) NewDecoder(r io.Reader) *Decoder {
+	return NewDecoder(r, c)
+}
+
+// Decode reads the next datum into v.
+// It returns io.EOF when the reader is exhausted at the end of a datum, and an error wrapping
+// io.ErrUnexpectedEOF when it is exhausted in the middle of one. Only the datums cut by the end
+// of the buffered data are retried after reading more: the other decoding errors are returned at once,
+// and ErrDatumTooLarge is returned when a datum doesn't fit in MaxSize bytes.
+func (d *Decoder) Decode(v interface{}) error {
+	// want is the buffered size to reach before decoding again: it doubles after each short buffer,
+	// so that a datum is decoded a logarithmic number of times whatever the size of the reads
+	want := 1
+	for {
+		if len(d.buf) >= want || (d.err != nil && len(d.buf) > 0) {
+			rest, err := d.next(d.buf, v)
+			if err == nil {
+				d.buf = rest
+				return nil
+			}
+			if !isShortBuffer(err) {
+				return err
+			}
+			if d.err == io.EOF {
+				return unexpectedEOFError{err}
+			}
+			max := d.maxSize()
+			if len(d.buf) >= max {
+				return fmt.Errorf("%d bytes buffered: %w", len(d.buf), ErrDatumTooLarge)
+			}
+			if want = 2 * len(d.buf); want > max {
+				want = max
+			}
+		}
+		if d.err != nil {
+			return d.err
+		}
+		d.fill()
+	}
+}
+
+func (d *Decoder) maxSize() int {
+	if d.MaxSize > 0 {
+		return d.MaxSize
+	}
+	return DefaultMaxDatumSize
+}
+
+// isShortBuffer tells whether the decoding failed because the datum is cut by the end of the buffer:
+// the header of a framed payload is incomplete, or its encoding or compressed stream is cut.
+// goavro (v2.9.8, see TestIsShortBuffer) formats io.ErrShortBuffer in its error messages without wrapping it.
+func isShortBuffer(err error) bool {
+	return errors.Is(err, io.ErrShortBuffer) || errors.Is(err, ErrShortPayload) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), io.ErrShortBuffer.Error())
+}
+
+// unexpectedEOFError is the error of a datum cut by the end of the stream, it is io.ErrUnexpectedEOF
+// and wraps the decoding error
+type unexpectedEOFError struct {
+	cause error
+}
+
+func (e unexpectedEOFError) Error() string {
+	return fmt.Sprintf("%s: %s", io.ErrUnexpectedEOF, e.cause)
+}
+
+func (e unexpectedEOFError) Is(target error) bool {
+	return target == io.ErrUnexpectedEOF
+}
+
+func (e unexpectedEOFError) Unwrap() error {
+	return e.cause
+}
+
+// fill reads more data, up to the maximum size of a datum. The decoded values may reference the buffer,
+// which is never overwritten: a new one is allocated when it is full.
+func (d *Decoder) fill() {
+	if max := d.maxSize(); cap(d.buf)-len(d.buf) < minRead && cap(d.buf) < max {
+		size := 2*len(d.buf) + minRead
+		if size > max {
+			size = max
+		}
+		buf := make([]byte, len(d.buf), size)
+		copy(buf, d.buf)
+		d.buf = buf
+	}
+	n, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+	d.buf = d.buf[:len(d.buf)+n]
+	d.err = err
+}
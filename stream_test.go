@@ -0,0 +1,208 @@
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoder_Decoder(t *testing.T) {
+	codec, err := NewCodec(personSchema)
+	require.NoError(t, err)
+
+	people := []Person{{"Nico", 36}, {"Anne", 41}, {"", 0}}
+	var stream bytes.Buffer
+	encoder := codec.NewEncoder(&stream)
+	for _, person := range people {
+		require.NoError(t, encoder.Encode(&person))
+	}
+
+	// the datums are decoded whatever the size of the reads
+	decoder := codec.NewDecoder(iotest.OneByteReader(bytes.NewReader(stream.Bytes())))
+	for _, person := range people {
+		var decoded Person
+		require.NoError(t, decoder.Decode(&decoded))
+		assert.Equal(t, person, decoded)
+	}
+	assert.Equal(t, io.EOF, decoder.Decode(&Person{}))
+
+	decoder = codec.NewDecoder(bytes.NewReader(stream.Bytes()))
+	for _, person := range people {
+		decoded := make(map[string]interface{})
+		require.NoError(t, decoder.Decode(&decoded))
+		assert.Equal(t, person.Name, decoded["name"])
+	}
+	assert.Equal(t, io.EOF, decoder.Decode(&Person{}))
+}
+
+func TestDecoder_truncated(t *testing.T) {
+	codec, err := NewCodec(personSchema)
+	require.NoError(t, err)
+	buf, err := codec.Marshal(Person{"Nico", 36})
+	require.NoError(t, err)
+
+	decoder := codec.NewDecoder(bytes.NewReader(buf[:len(buf)-1]))
+	err = decoder.Decode(&Person{})
+	assert.Error(t, err)
+	assert.NotEqual(t, io.EOF, err)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "%v", err)
+	assert.True(t, isShortBuffer(errors.Unwrap(err)), "the decoding error is wrapped: %v", err)
+}
+
+func TestIsShortBuffer(t *testing.T) {
+	// the goavro errors of the truncated datums are detected from their messages
+	for schema, value := range map[string]interface{}{
+		`"string"`: "some text",
+		`"bytes"`:  []byte("some bytes"),
+		`"int"`:    int32(1 << 20),
+		`"long"`:   int64(1 << 40),
+		`"float"`:  float32(1.5),
+		`"double"`: 1.5,
+		`{"type": "fixed", "name": "f", "size": 4}`:                 []byte("abcd"),
+		`{"type": "array", "items": "string"}`:                      []interface{}{"a", "b"},
+		`{"type": "map", "values": "long"}`:                         map[string]interface{}{"a": int64(1)},
+		`["null", "string"]`:                                        goavro.Union("string", "text"),
+		`{"type": "enum", "name": "e", "symbols": ["A", "B", "C"]}`: "C",
+	} {
+		codec, err := goavro.NewCodec(schema)
+		require.NoError(t, err, schema)
+		buf, err := codec.BinaryFromNative(nil, value)
+		require.NoError(t, err, schema)
+		for i := 0; i < len(buf); i++ {
+			_, _, err := codec.NativeFromBinary(buf[:i])
+			require.Error(t, err, "%s cut at %d", schema, i)
+			assert.True(t, isShortBuffer(err), "%s cut at %d: %v", schema, i, err)
+		}
+	}
+
+	// the framed payloads cut in their header are short buffers too
+	_, _, err := ParseHeader([]byte{0, 0})
+	assert.True(t, isShortBuffer(err), "%v", err)
+	assert.False(t, isShortBuffer(ErrInvalidMagicByte))
+}
+
+// zeros is an endless stream of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestDecoder_malformed(t *testing.T) {
+	codec, err := NewCodec(personSchema)
+	require.NoError(t, err)
+
+	// the negative length of the name is an error whatever follows it
+	decoder := codec.NewDecoder(io.MultiReader(bytes.NewReader([]byte{1}), zeros{}))
+	err = decoder.Decode(&Person{})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrDatumTooLarge), "%v", err)
+
+	// a length of 1TB is a short buffer up to the maximum size
+	decoder = codec.NewDecoder(io.MultiReader(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x40}), zeros{}))
+	decoder.MaxSize = 1 << 20
+	err = decoder.Decode(&Person{})
+	assert.True(t, errors.Is(err, ErrDatumTooLarge), "%v", err)
+	assert.Equal(t, decoder.MaxSize, cap(decoder.buf))
+}
+
+func TestDecoder_retries(t *testing.T) {
+	codec, err := NewCodec(personSchema)
+	require.NoError(t, err)
+	buf, err := codec.Marshal(Person{strings.Repeat("a", 10000), 36})
+	require.NoError(t, err)
+
+	// the datum read byte by byte is decoded a logarithmic number of times
+	decoder := codec.NewDecoder(iotest.OneByteReader(bytes.NewReader(buf)))
+	calls := 0
+	decoder.next = func(buf []byte, v interface{}) ([]byte, error) {
+		calls++
+		return codec.UnmarshalNext(buf, v)
+	}
+	var decoded Person
+	require.NoError(t, decoder.Decode(&decoded))
+	assert.Equal(t, int32(36), decoded.Age)
+	assert.True(t, calls <= 16, "%d calls", calls)
+}
+
+func TestDecoder_read_error(t *testing.T) {
+	codec, err := NewCodec(personSchema)
+	require.NoError(t, err)
+
+	decoder := codec.NewDecoder(iotest.TimeoutReader(bytes.NewReader([]byte{8})))
+	assert.Equal(t, iotest.ErrTimeout, decoder.Decode(&Person{}))
+}
+
+func TestDecoder_CodecRegistry(t *testing.T) {
+	registry := newPersonCodecRegistry(t)
+
+	people := []Person{{"Nico", 36}, {"Anne", 41}}
+	var stream bytes.Buffer
+	encoder := NewEncoder(&stream, registry)
+	for _, person := range people {
+		require.NoError(t, encoder.Encode(person))
+	}
+
+	// the framed payloads are decoded whatever the size of the reads, their headers included
+	decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(stream.Bytes())), registry)
+	for _, person := range people {
+		var decoded Person
+		require.NoError(t, decoder.Decode(&decoded))
+		assert.Equal(t, person, decoded)
+	}
+	assert.Equal(t, io.EOF, decoder.Decode(&Person{}))
+
+	decoder = NewDecoder(bytes.NewReader(stream.Bytes()[:3]), registry)
+	err := decoder.Decode(&Person{})
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "%v", err)
+	assert.True(t, errors.Is(err, ErrShortPayload), "%v", err)
+}
+
+func TestDecoder_GlueCodecRegistry(t *testing.T) {
+	registry, _, _ := glueRegistries(t)
+
+	var stream bytes.Buffer
+	encoder := NewEncoder(&stream, registry)
+	require.NoError(t, encoder.Encode(map[string]interface{}{"name": "john", "age": 42}))
+	registry.Compression = GlueCompressionZlib
+	require.NoError(t, encoder.Encode(map[string]interface{}{"name": "jane", "age": 7}))
+
+	// the compressed payloads cut by the reads are decoded once complete
+	decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(stream.Bytes())), registry)
+	for _, name := range []string{"john", "jane"} {
+		var decoded map[string]interface{}
+		require.NoError(t, decoder.Decode(&decoded))
+		assert.Equal(t, name, decoded["name"])
+	}
+	assert.Equal(t, io.EOF, decoder.Decode(&map[string]interface{}{}))
+
+	decoder = NewDecoder(bytes.NewReader(stream.Bytes()[:stream.Len()-1]), registry)
+	require.NoError(t, decoder.Decode(&map[string]interface{}{}))
+	err := decoder.Decode(&map[string]interface{}{})
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "%v", err)
+}
+
+func TestEncoder_CodecRegistry(t *testing.T) {
+	registry := newPersonCodecRegistry(t)
+
+	var stream bytes.Buffer
+	encoder := NewEncoder(&stream, registry)
+	require.NoError(t, encoder.Encode(Person{"Nico", 36}))
+	require.NoError(t, encoder.Encode(Person{"Anne", 41}))
+
+	first, err := registry.Marshal(Person{"Nico", 36})
+	require.NoError(t, err)
+	second, err := registry.Marshal(Person{"Anne", 41})
+	require.NoError(t, err)
+	assert.Equal(t, append(first, second...), stream.Bytes())
+}
@@ -0,0 +1,419 @@
+package avro
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/leboncoin/structs"
+	"github.com/mitchellh/mapstructure"
+)
+
+// ErrFieldCollision is the error of the structs having several fields encoded under the same avro name
+// at the same depth of embedding, Go itself considering such promoted fields ambiguous
+var ErrFieldCollision = errors.New("several struct fields have the same avro name")
+
+// structField is a field of the record encoded for a struct, possibly promoted from an inlined struct
+type structField struct {
+	// name is the avro name of the field
+	name string
+	// index is the index sequence of the field, for reflect.Value.FieldByIndex
+	index []int
+	field reflect.StructField
+	// omitEmpty tells if the field is omitted when it is empty, for the default value of the schema to be encoded
+	omitEmpty bool
+	// defaultValue is the value encoded when the field is empty, given by the default tag option
+	defaultValue reflect.Value
+	// aliases are the names given by the alias tag options, under which the field is also decoded
+	aliases []string
+	// nestKey is the key of the inlined struct holding the field in the maps decoded by mapstructure,
+	// empty for the fields of the struct itself and for the fields of the squashed structs
+	nestKey string
+	// hidden tells if the field is promoted from an embedded type which is not exported
+	hidden bool
+}
+
+// structFields lists the fields of the record encoded for a struct type. As in Go, the fields of the
+// embedded structs are promoted, unless their tag gives them a name: they are then encoded as nested records.
+// The option "inline" (or "squash", as mapstructure names it) promotes the fields of any struct field.
+// The fields are also promoted through the embedded pointers, a nil pointer being encoded as empty fields,
+// and from the embedded struct types which are not exported, except through pointers which couldn't be allocated.
+type structFields struct {
+	fields []structField
+	byName map[string]int
+	// inlined tells if some fields are promoted from inlined structs
+	inlined bool
+	// hidden tells if some fields are promoted from embedded types which are not exported,
+	// which mapstructure can't set
+	hidden bool
+	// defaults tells if some fields have a default tag option
+	defaults bool
+	err      error
+}
+
+var structFieldsCache sync.Map // reflect.Type -> *structFields
+
+// fieldsOf returns the fields of the record encoded for a struct type
+func fieldsOf(t reflect.Type) *structFields {
+	if cached, ok := structFieldsCache.Load(t); ok {
+		return cached.(*structFields)
+	}
+	fields := newStructFields(t)
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+func newStructFields(t reflect.Type) *structFields {
+	var candidates []structField
+	var goNames map[string][]string
+	var tagErr error
+	var collect func(t reflect.Type, index []int, goPath string, nestKey string, hidden bool)
+	collect = func(t reflect.Type, index []int, goPath string, nestKey string, hidden bool) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options := fieldTag(field)
+			key := name
+			if key == "" {
+				key = field.Name
+			}
+			fieldIndex := append(index[:len(index):len(index)], i)
+			if isPromoting(field) {
+				fieldNestKey := nestKey
+				if fieldNestKey == "" && !hasTagOption(options, "squash") {
+					fieldNestKey = key
+				}
+				collect(indirectType(field.Type), fieldIndex, goPath+field.Name+".", fieldNestKey, hidden || field.PkgPath != "")
+				continue
+			}
+			if field.PkgPath != "" || name == "-" {
+				continue
+			}
+			defaultValue, err := tagDefault(field, options)
+			if err != nil && tagErr == nil {
+				tagErr = fmt.Errorf("%v: %w", t, err)
+			}
+			if goNames == nil {
+				goNames = make(map[string][]string)
+			}
+			goNames[key] = append(goNames[key], goPath+field.Name)
+			candidates = append(candidates, structField{
+				name:         key,
+				index:        fieldIndex,
+				field:        field,
+				omitEmpty:    hasTagOption(options, "omitempty"),
+				defaultValue: defaultValue,
+				aliases:      tagAliases(options),
+				nestKey:      nestKey,
+				hidden:       hidden,
+			})
+		}
+	}
+	collect(t, nil, "", "", false)
+
+	// the shallowest field wins, as in Go
+	depths := make(map[string]int)
+	collisions := make(map[string]bool)
+	for _, f := range candidates {
+		depth, ok := depths[f.name]
+		switch {
+		case !ok || len(f.index) < depth:
+			depths[f.name] = len(f.index)
+			collisions[f.name] = false
+		case len(f.index) == depth:
+			collisions[f.name] = true
+		}
+	}
+	fields := &structFields{byName: make(map[string]int), err: tagErr}
+	nestKeys := make(map[string]bool)
+	for _, f := range candidates {
+		if len(f.index) != depths[f.name] {
+			continue
+		}
+		if collisions[f.name] {
+			if fields.err == nil {
+				fields.err = fmt.Errorf("%v: %s is the avro name of %s: %w", t, f.name, strings.Join(goNames[f.name], ", "), ErrFieldCollision)
+			}
+			continue
+		}
+		if len(f.index) > 1 {
+			fields.inlined = true
+		}
+		if f.hidden {
+			fields.hidden = true
+		}
+		if f.defaultValue.IsValid() {
+			fields.defaults = true
+		}
+		if f.nestKey != "" {
+			nestKeys[f.nestKey] = true
+		}
+		fields.byName[f.name] = len(fields.fields)
+		fields.fields = append(fields.fields, f)
+	}
+	// the decoded maps hold the inlined structs under their key, which can't be the name of a field
+	for _, f := range fields.fields {
+		if f.nestKey == "" && nestKeys[f.name] && fields.err == nil {
+			fields.err = fmt.Errorf("%v: %s is the avro name of a field and of an inlined struct: %w", t, f.name, ErrFieldCollision)
+		}
+	}
+	return fields
+}
+
+// fieldTag returns the name and the options of the avro tag of a struct field
+func fieldTag(field reflect.StructField) (string, []string) {
+	parts := strings.Split(field.Tag.Get("avro"), ",")
+	return parts[0], parts[1:]
+}
+
+// isInlined tells if the fields of a struct field are promoted into the record of its parent.
+// mapstructure only squashes the struct values, the other options also promote through a pointer.
+func isInlined(field reflect.StructField, name string, options []string) bool {
+	t := field.Type
+	if t.Kind() == reflect.Ptr && !hasTagOption(options, "squash") {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	return hasTagOption(options, "inline") || hasTagOption(options, "squash") || (field.Anonymous && name == "")
+}
+
+// isPromoting tells if the fields of a struct field are promoted into the record of its parent,
+// the struct field being exported or an embedded struct value
+func isPromoting(field reflect.StructField) bool {
+	name, options := fieldTag(field)
+	if name == "-" || !isInlined(field, name, options) {
+		return false
+	}
+	return field.PkgPath == "" || (field.Anonymous && field.Type.Kind() == reflect.Struct)
+}
+
+// fieldByIndex returns the nested field of a struct value for its index sequence. The nil embedded pointers
+// are allocated when alloc is set, otherwise the returned value is invalid when one is met.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// exportedCopy copies the exported fields of a struct value obtained through an embedded field which is not
+// exported, whose value can't be used as an interface. The fields promoted from its own embedded struct values
+// are copied too.
+func exportedCopy(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	copyExported(c, v)
+	return c
+}
+
+func copyExported(dst reflect.Value, src reflect.Value) {
+	t := src.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		switch {
+		case field.PkgPath == "":
+			dst.Field(i).Set(src.Field(i))
+		case field.Anonymous && field.Type.Kind() == reflect.Struct:
+			copyExported(dst.Field(i), src.Field(i))
+		}
+	}
+}
+
+// lookup finds the field encoded under the given avro name, first exactly and then case insensitively
+// as mapstructure does
+func (s *structFields) lookup(name string) (structField, bool) {
+	if i, ok := s.byName[name]; ok {
+		return s.fields[i], true
+	}
+	for _, f := range s.fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// isNestKey tells if the key is the one of an inlined struct in the maps decoded by mapstructure
+func (s *structFields) isNestKey(key string) bool {
+	for _, f := range s.fields {
+		if f.nestKey == key {
+			return true
+		}
+	}
+	return false
+}
+
+var structFieldsErrorCache sync.Map // reflect.Type -> error
+
+// structFieldsError returns the error of the first struct type found in a Go type whose fields can't be encoded,
+// because of colliding names or invalid tag options
+func structFieldsError(t reflect.Type) error {
+	if t == nil {
+		return nil
+	}
+	if cached, ok := structFieldsErrorCache.Load(t); ok {
+		err, _ := cached.(error)
+		return err
+	}
+	err := walkStructFieldsErrors(t, make(map[reflect.Type]bool))
+	structFieldsErrorCache.Store(t, err)
+	return err
+}
+
+func walkStructFieldsErrors(t reflect.Type, visited map[reflect.Type]bool) error {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return walkStructFieldsErrors(t.Elem(), visited)
+	case reflect.Struct:
+		if visited[t] {
+			return nil
+		}
+		visited[t] = true
+		fields := fieldsOf(t)
+		if fields.err != nil {
+			return fields.err
+		}
+		for _, f := range fields.fields {
+			if err := walkStructFieldsErrors(f.field.Type, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// structMap converts a struct to the map encoded as its record, the fields of the inlined structs being promoted
+func (c *Codec) structMap(value reflect.Value) map[string]interface{} {
+	s := structs.New(value.Interface())
+	s.TagName = "avro"
+	s.EncodeHook = c.encodeUnionHook
+	m := s.Map()
+	fields := fieldsOf(value.Type())
+	if fields.inlined {
+		c.promoteInlinedFields(value, fields, m)
+	}
+	if fields.defaults {
+		c.encodeTagDefaults(value, fields, m)
+	}
+	return m
+}
+
+// promoteInlinedFields replaces the maps of the inlined structs by their fields
+func (c *Codec) promoteInlinedFields(value reflect.Value, fields *structFields, m map[string]interface{}) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !isPromoting(field) {
+			continue
+		}
+		name, _ := fieldTag(field)
+		if name == "" {
+			name = field.Name
+		}
+		delete(m, name)
+		inlined := value.Field(i)
+		switch {
+		case inlined.Kind() == reflect.Ptr && inlined.IsNil():
+			// the fields of a nil pointer are empty, encoded as their default if they have one
+			inlined = reflect.Zero(field.Type.Elem())
+		case inlined.Kind() == reflect.Ptr:
+			inlined = inlined.Elem()
+		case field.PkgPath != "":
+			inlined = exportedCopy(inlined)
+		}
+		for key, val := range c.structMap(inlined) {
+			if f, ok := fields.byName[key]; ok && fields.fields[f].index[0] == i {
+				m[key] = val
+			}
+		}
+	}
+}
+
+// encodeTagDefaults sets the empty fields having a default tag option to their default value
+func (c *Codec) encodeTagDefaults(value reflect.Value, fields *structFields, m map[string]interface{}) {
+	for _, f := range fields.fields {
+		if !f.defaultValue.IsValid() {
+			continue
+		}
+		if field := fieldByIndex(value, f.index, false); field.IsValid() && !isEmptyValue(field) {
+			continue
+		}
+		if encoded, err := c.encodeUnionHook(f.defaultValue.Kind(), f.defaultValue.Interface()); err == nil {
+			m[f.name] = encoded
+		}
+	}
+}
+
+// nestInlinedFields moves the fields of a decoded record promoted from the inlined structs of the output type
+// under the keys of these structs, for mapstructure to decode them into the inlined structs
+func nestInlinedFields(record map[string]interface{}, to reflect.Type) map[string]interface{} {
+	fields := fieldsOf(to)
+	if !fields.inlined {
+		return record
+	}
+	nested := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		f, ok := fields.lookup(key)
+		if !ok && fields.isNestKey(key) {
+			// an unknown field named as an inlined struct, which can't be decoded into it
+			continue
+		}
+		if !ok || f.nestKey == "" {
+			nested[key] = value
+			continue
+		}
+		inlined, ok := nested[f.nestKey].(map[string]interface{})
+		if !ok {
+			inlined = make(map[string]interface{})
+			nested[f.nestKey] = inlined
+		}
+		inlined[key] = value
+	}
+	return nested
+}
+
+// decodeHiddenFields decodes a record into a struct having fields promoted from embedded types which
+// are not exported. mapstructure can't set these embedded fields, the fields are decoded one by one.
+func (c Codec) decodeHiddenFields(record map[string]interface{}, to reflect.Type) (interface{}, error) {
+	fields := fieldsOf(to)
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	value := reflect.New(to).Elem()
+	var unused []string
+	for _, key := range keys {
+		f, ok := fields.lookup(key)
+		if !ok {
+			unused = append(unused, key)
+			continue
+		}
+		field := fieldByIndex(value, f.index, true)
+		decoded := reflect.New(field.Type())
+		decoder, err := mapstructure.NewDecoder(c.decoderConfig(decoded.Interface()))
+		if err != nil {
+			return nil, err
+		}
+		if err := decoder.Decode(record[key]); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		field.Set(decoded.Elem())
+	}
+	if c.DecodeOptions.ErrorUnused && len(unused) > 0 {
+		return nil, fmt.Errorf("has invalid keys: %s", strings.Join(unused, ", "))
+	}
+	return value.Interface(), nil
+}
@@ -0,0 +1,252 @@
+package avro
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eventSchema = `{"type": "record", "name": "Event", "fields": [
+	{"name": "id", "type": "string"},
+	{"name": "source", "type": "string"},
+	{"name": "version", "type": "int"},
+	{"name": "payload", "type": "string"},
+	{"name": "origin", "type": {"type": "record", "name": "Origin", "fields": [
+		{"name": "host", "type": "string"}
+	]}}
+]}`
+
+type EventMetadata struct {
+	ID      string `avro:"id"`
+	Source  string `avro:"source"`
+	Version int32  `avro:"version"`
+}
+
+type Origin struct {
+	Host string `avro:"host"`
+}
+
+type event struct {
+	EventMetadata
+	Payload string `avro:"payload"`
+	Origin  `avro:"origin"`
+}
+
+type shadowingEvent struct {
+	EventMetadata
+	Payload string `avro:"payload"`
+	Origin  Origin `avro:"origin"`
+	// Source shadows the field of EventMetadata, as in Go
+	Source string `avro:"source"`
+}
+
+type inlineEvent struct {
+	Metadata EventMetadata `avro:",inline"`
+	Payload  string        `avro:"payload"`
+	Origin   Origin        `avro:"origin"`
+}
+
+type pointerEvent struct {
+	*EventMetadata
+	Payload string `avro:"payload"`
+	Origin  Origin `avro:"origin"`
+}
+
+type DefaultMetadata struct {
+	ID      string `avro:"id"`
+	Source  string `avro:"source,default=batch"`
+	Version int32  `avro:"version,default=1"`
+}
+
+type defaultsEvent struct {
+	*DefaultMetadata
+	Payload string `avro:"payload"`
+	Origin  Origin `avro:"origin"`
+}
+
+type eventMetadata struct {
+	ID      string `avro:"id"`
+	Source  string `avro:"source"`
+	Version int32  `avro:"version"`
+	hash    string
+}
+
+type unexportedEvent struct {
+	eventMetadata
+	Payload string `avro:"payload"`
+	Origin  Origin `avro:"origin"`
+}
+
+type OtherMetadata struct {
+	Source string `avro:"source"`
+}
+
+type collidingEvent struct {
+	EventMetadata
+	OtherMetadata
+	Payload string `avro:"payload"`
+	Origin  Origin `avro:"origin"`
+}
+
+func TestCodec_embedded_structs(t *testing.T) {
+	codec, err := NewCodec(eventSchema)
+	require.NoError(t, err)
+
+	expected := event{
+		EventMetadata: EventMetadata{ID: "e1", Source: "api", Version: 2},
+		Payload:       "hello",
+		Origin:        Origin{Host: "h1"},
+	}
+	buf, err := codec.Marshal(expected)
+	require.NoError(t, err)
+
+	var native map[string]interface{}
+	require.NoError(t, codec.Unmarshal(buf, &native))
+	assert.Equal(t, map[string]interface{}{
+		"id":      "e1",
+		"source":  "api",
+		"version": int32(2),
+		"payload": "hello",
+		"origin":  map[string]interface{}{"host": "h1"},
+	}, native)
+
+	var decoded event
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	assert.Equal(t, expected, decoded)
+
+	var inline inlineEvent
+	require.NoError(t, codec.Unmarshal(buf, &inline))
+	assert.Equal(t, expected.EventMetadata, inline.Metadata)
+	inlineBuf, err := codec.Marshal(&inline)
+	require.NoError(t, err)
+	assert.Equal(t, buf, inlineBuf)
+
+	var shadowing shadowingEvent
+	require.NoError(t, codec.Unmarshal(buf, &shadowing))
+	assert.Equal(t, "api", shadowing.Source)
+	assert.Equal(t, "e1", shadowing.ID)
+	shadowing.Source = "batch"
+	shadowingBuf, err := codec.Marshal(shadowing)
+	require.NoError(t, err)
+	require.NoError(t, codec.Unmarshal(shadowingBuf, &native))
+	assert.Equal(t, "batch", native["source"])
+
+	metadata, err := codec.UnmarshalMetadata(buf, &struct {
+		EventMetadata
+		Extra string `avro:"extra"`
+	}{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extra"}, metadata.Unset)
+
+	require.NoError(t, codec.CheckType(reflect.TypeOf(event{})))
+}
+
+func TestCodec_embedded_structs_collisions(t *testing.T) {
+	codec, err := NewCodec(eventSchema)
+	require.NoError(t, err)
+
+	_, err = codec.Marshal(collidingEvent{})
+	assert.True(t, errors.Is(err, ErrFieldCollision))
+	assert.Contains(t, err.Error(), "EventMetadata.Source, OtherMetadata.Source")
+
+	buf, err := codec.Marshal(event{})
+	require.NoError(t, err)
+	err = codec.Unmarshal(buf, &collidingEvent{})
+	assert.True(t, errors.Is(err, ErrFieldCollision))
+	err = codec.Unmarshal(buf, &[]collidingEvent{})
+	assert.True(t, errors.Is(err, ErrFieldCollision))
+
+	err = codec.CheckType(reflect.TypeOf(collidingEvent{}))
+	assert.True(t, errors.Is(mismatches(t, err)[""], ErrFieldCollision))
+}
+
+func TestCodec_embedded_structs_FieldError(t *testing.T) {
+	codec, err := NewCodec(eventSchema)
+	require.NoError(t, err)
+	buf, err := codec.Marshal(event{})
+	require.NoError(t, err)
+
+	var mismatch struct {
+		Metadata struct {
+			Version []string `avro:"version"`
+		} `avro:",inline"`
+	}
+	err = codec.Unmarshal(buf, &mismatch)
+	fieldErr := requireFieldError(t, err)
+	assert.Equal(t, "version", fieldErr.Path)
+	assert.Equal(t, reflect.TypeOf([]string{}), fieldErr.GoType)
+	assert.Equal(t, "int", fieldErr.AvroType)
+}
+
+func TestCodec_embedded_pointers(t *testing.T) {
+	codec, err := NewCodec(eventSchema)
+	require.NoError(t, err)
+
+	expected := event{
+		EventMetadata: EventMetadata{ID: "e1", Source: "api", Version: 2},
+		Payload:       "hello",
+		Origin:        Origin{Host: "h1"},
+	}
+	buf, err := codec.Marshal(expected)
+	require.NoError(t, err)
+
+	// the decoding allocates the embedded pointer
+	var decoded pointerEvent
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	require.NotNil(t, decoded.EventMetadata)
+	assert.Equal(t, expected.EventMetadata, *decoded.EventMetadata)
+	pointerBuf, err := codec.Marshal(decoded)
+	require.NoError(t, err)
+	assert.Equal(t, buf, pointerBuf)
+
+	// a nil pointer is encoded as empty fields
+	pointerBuf, err = codec.Marshal(pointerEvent{Payload: "hello"})
+	require.NoError(t, err)
+	var native map[string]interface{}
+	require.NoError(t, codec.Unmarshal(pointerBuf, &native))
+	assert.Equal(t, "", native["id"])
+	assert.Equal(t, int32(0), native["version"])
+	assert.Equal(t, "hello", native["payload"])
+
+	// or as their default value
+	defaultsBuf, err := codec.Marshal(defaultsEvent{Payload: "hello"})
+	require.NoError(t, err)
+	require.NoError(t, codec.Unmarshal(defaultsBuf, &native))
+	assert.Equal(t, "batch", native["source"])
+	assert.Equal(t, int32(1), native["version"])
+
+	require.NoError(t, codec.CheckType(reflect.TypeOf(pointerEvent{})))
+}
+
+func TestCodec_embedded_unexported_types(t *testing.T) {
+	codec, err := NewCodec(eventSchema)
+	require.NoError(t, err)
+
+	expected := unexportedEvent{
+		eventMetadata: eventMetadata{ID: "e1", Source: "api", Version: 2, hash: "ignored"},
+		Payload:       "hello",
+		Origin:        Origin{Host: "h1"},
+	}
+	buf, err := codec.Marshal(expected)
+	require.NoError(t, err)
+
+	var native map[string]interface{}
+	require.NoError(t, codec.Unmarshal(buf, &native))
+	assert.Equal(t, map[string]interface{}{
+		"id":      "e1",
+		"source":  "api",
+		"version": int32(2),
+		"payload": "hello",
+		"origin":  map[string]interface{}{"host": "h1"},
+	}, native)
+
+	var decoded unexportedEvent
+	require.NoError(t, codec.Unmarshal(buf, &decoded))
+	expected.hash = ""
+	assert.Equal(t, expected, decoded)
+
+	require.NoError(t, codec.CheckType(reflect.TypeOf(unexportedEvent{})))
+}
@@ -0,0 +1,47 @@
+package avro
+
+import (
+	"fmt"
+
+	"github.com/leboncoin/avrocado/internal/schema"
+)
+
+// SubjectNameStrategy computes the subject under which a schema is registered for a kafka topic.
+// isKey tells if the schema describes the keys or the values of the topic.
+type SubjectNameStrategy func(topic string, isKey bool, schema string) (string, error)
+
+// TopicNameStrategy registers the schemas under "<topic>-key" or "<topic>-value".
+// It is the default strategy of the Confluent serializers: a topic only holds one record type.
+func TopicNameStrategy(topic string, isKey bool, _ string) (string, error) {
+	if isKey {
+		return topic + "-key", nil
+	}
+	return topic + "-value", nil
+}
+
+// RecordNameStrategy registers the schemas under the full name of their record,
+// so a record type has the same subject whatever the topic it is produced to.
+func RecordNameStrategy(_ string, _ bool, rawSchema string) (string, error) {
+	return recordFullName(rawSchema)
+}
+
+// TopicRecordNameStrategy registers the schemas under "<topic>-<record full name>",
+// so several record types can be produced to the same topic.
+func TopicRecordNameStrategy(topic string, _ bool, rawSchema string) (string, error) {
+	name, err := recordFullName(rawSchema)
+	if err != nil {
+		return "", err
+	}
+	return topic + "-" + name, nil
+}
+
+func recordFullName(rawSchema string) (string, error) {
+	s, err := schema.Parse(rawSchema)
+	if err != nil {
+		return "", fmt.Errorf("schema.Parse error: %w", err)
+	}
+	if !s.IsNamed() {
+		return "", fmt.Errorf("the schema has no name, it must be a record, an enum or a fixed")
+	}
+	return s.FullName(), nil
+}
@@ -0,0 +1,99 @@
+package avro
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const createdSchema = `{
+  "type": "record",
+  "name": "created",
+  "namespace": "lbc.event",
+  "fields": [{"name": "id", "type": "string"}]
+}`
+
+const deletedSchema = `{
+  "type": "record",
+  "name": "lbc.event.deleted",
+  "fields": [{"name": "id", "type": "string"}, {"name": "reason", "type": "string"}]
+}`
+
+type Created struct {
+	ID string `avro:"id"`
+}
+
+func (Created) AvroSchema() string {
+	return createdSchema
+}
+
+type Deleted struct {
+	ID     string `avro:"id"`
+	Reason string `avro:"reason"`
+}
+
+func (*Deleted) AvroSchema() string {
+	return deletedSchema
+}
+
+func TestSubjectNameStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy SubjectNameStrategy
+		isKey    bool
+		schema   string
+		expected string
+	}{
+		{"topic name value", TopicNameStrategy, false, createdSchema, "events-value"},
+		{"topic name key", TopicNameStrategy, true, `"string"`, "events-key"},
+		{"record name", RecordNameStrategy, false, createdSchema, "lbc.event.created"},
+		{"record name with full name", RecordNameStrategy, true, deletedSchema, "lbc.event.deleted"},
+		{"topic record name", TopicRecordNameStrategy, false, createdSchema, "events-lbc.event.created"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := tt.strategy("events", tt.isKey, tt.schema)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, subject)
+		})
+	}
+
+	_, err := RecordNameStrategy("events", false, `"string"`)
+	assert.Error(t, err)
+}
+
+func TestCodecRegistry_Marshal_with_subject_name_strategy(t *testing.T) {
+	registry := NewNOOPClient()
+	codec := &CodecRegistry{
+		codecByID:           make(map[SchemaID]*Codec),
+		Registry:            registry,
+		topic:               "events",
+		SubjectNameStrategy: TopicRecordNameStrategy,
+		SchemaID:            UnknownID,
+	}
+
+	_, err := codec.Marshal(Created{"1"})
+	require.Error(t, err, "the schema is not registered")
+
+	codec.AutoRegister = true
+	created, err := codec.Marshal(Created{"1"})
+	require.NoError(t, err)
+	deleted, err := codec.Marshal(&Deleted{"2", "spam"})
+	require.NoError(t, err)
+
+	subjects, err := registry.Subjects()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"events-lbc.event.created", "events-lbc.event.deleted"}, subjects)
+
+	var decodedCreated Created
+	require.NoError(t, codec.Unmarshal(created, &decodedCreated))
+	assert.Equal(t, Created{"1"}, decodedCreated)
+
+	var decodedDeleted Deleted
+	require.NoError(t, codec.Unmarshal(deleted, &decodedDeleted))
+	assert.Equal(t, Deleted{"2", "spam"}, decodedDeleted)
+
+	_, err = codec.Marshal(map[string]interface{}{"id": "3"})
+	assert.Equal(t, ErrNoEncodeSchema, err)
+}
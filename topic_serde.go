@@ -0,0 +1,121 @@
+package avro
+
+import "fmt"
+
+// TopicCodecs gives the codecs of the keys or the values of kafka topics, as used by the adapters
+// of the kafka clients (see the avrosarama, avrokafkago and avroconfluent packages)
+type TopicCodecs interface {
+	TopicCodec(topic string, isKey bool) (*CodecRegistry, error)
+}
+
+// TopicCodecsFunc is a function used as TopicCodecs, ex: to serve the serdes of several topics
+type TopicCodecsFunc func(topic string, isKey bool) (*CodecRegistry, error)
+
+// TopicCodec calls f(topic, isKey)
+func (f TopicCodecsFunc) TopicCodec(topic string, isKey bool) (*CodecRegistry, error) {
+	return f(topic, isKey)
+}
+
+// TopicSerde is an avro serializer and unserializer for both the keys and the values of a kafka topic.
+// The key and value schemas are registered under the "<topic>-key" and "<topic>-value" subjects
+// (see TopicNameStrategy), each side being handled by its own CodecRegistry.
+type TopicSerde struct {
+	Topic string
+	Key   *CodecRegistry
+	Value *CodecRegistry
+}
+
+// NewTopicSerde configures the key and value codecs of a topic connected to the schema registry.
+// - registryURL (required) is the complete URL of the schema registry
+// - topic (required) is the name of the kafka topic
+// - keySchema (optional) is the schema which will be used for encoding keys
+// - valueSchema (optional) is the schema which will be used for encoding values
+//
+// As for NewCodecRegistry, the given schemas must already be registered and an empty schema
+// only allows decoding.
+func NewTopicSerde(registryURL, topic, keySchema, valueSchema string) (*TopicSerde, error) {
+	schemaRegistry, err := NewSchemaRegistry(registryURL)
+	if err != nil {
+		return nil, err
+	}
+	return newTopicSerde(schemaRegistry, topic, keySchema, valueSchema, func(r *CodecRegistry, rawSchema string) error {
+		return r.init(rawSchema, nil)
+	})
+}
+
+// NewTopicSerdeAndRegister does a NewTopicSerde() and registers the schemas which are not registered yet
+func NewTopicSerdeAndRegister(registryURL, topic, keySchema, valueSchema string) (*TopicSerde, error) {
+	schemaRegistry, err := NewSchemaRegistry(registryURL)
+	if err != nil {
+		return nil, err
+	}
+	return newTopicSerde(schemaRegistry, topic, keySchema, valueSchema, func(r *CodecRegistry, rawSchema string) error {
+		return r.initAndRegister(rawSchema)
+	})
+}
+
+func newTopicSerde(schemaRegistry SchemaRegistry, topic, keySchema, valueSchema string, initFunc func(*CodecRegistry, string) error) (*TopicSerde, error) {
+	newSide := func(isKey bool, schema string) (*CodecRegistry, error) {
+		return newRegistryWithClient(schemaRegistry, "", schema, func(r *CodecRegistry, rawSchema string) error {
+			r.topic = topic
+			r.isKey = isKey
+			r.SubjectNameStrategy = TopicNameStrategy
+			return initFunc(r, rawSchema)
+		})
+	}
+
+	key, err := newSide(true, keySchema)
+	if err != nil {
+		return nil, fmt.Errorf("key codec error for topic %s: %w", topic, err)
+	}
+	value, err := newSide(false, valueSchema)
+	if err != nil {
+		return nil, fmt.Errorf("value codec error for topic %s: %w", topic, err)
+	}
+	return &TopicSerde{Topic: topic, Key: key, Value: value}, nil
+}
+
+// SetTypeNameEncoder sets the TypeNameEncoder of both the key and value codecs
+func (s *TopicSerde) SetTypeNameEncoder(typeNameEncoder TypeNameEncoder) {
+	s.Key.SetTypeNameEncoder(typeNameEncoder)
+	s.Value.SetTypeNameEncoder(typeNameEncoder)
+}
+
+// SetWireFormat changes the framing of the keys and the values
+func (s *TopicSerde) SetWireFormat(format WireFormat) error {
+	if err := s.Key.SetWireFormat(format); err != nil {
+		return err
+	}
+	return s.Value.SetWireFormat(format)
+}
+
+// TopicCodec returns the key or the value codec of the serde's topic
+func (s *TopicSerde) TopicCodec(topic string, isKey bool) (*CodecRegistry, error) {
+	if topic != s.Topic {
+		return nil, fmt.Errorf("topic %s is not handled by the serde of topic %s", topic, s.Topic)
+	}
+	if isKey {
+		return s.Key, nil
+	}
+	return s.Value, nil
+}
+
+// MarshalKey encodes a key of the topic
+func (s *TopicSerde) MarshalKey(key interface{}) ([]byte, error) {
+	return s.Key.Marshal(key)
+}
+
+// MarshalValue encodes a value of the topic
+func (s *TopicSerde) MarshalValue(value interface{}) ([]byte, error) {
+	return s.Value.Marshal(value)
+}
+
+// UnmarshalKey decodes a key of the topic
+func (s *TopicSerde) UnmarshalKey(from []byte, to interface{}) error {
+	return s.Key.Unmarshal(from, to)
+}
+
+// UnmarshalValue decodes a value of the topic
+func (s *TopicSerde) UnmarshalValue(from []byte, to interface{}) error {
+	return s.Value.Unmarshal(from, to)
+}
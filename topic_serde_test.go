@@ -0,0 +1,89 @@
+package avro
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicSerde(t *testing.T) {
+	keySchema := `{
+	  "type": "record",
+	  "name": "person_key",
+	  "fields": [{"name": "name", "type": "string"}]
+	}`
+	type PersonKey struct {
+		Name string `avro:"name"`
+	}
+
+	registry := NewNOOPClient()
+	_, err := newTopicSerde(registry, "people", keySchema, personSchema, func(r *CodecRegistry, rawSchema string) error {
+		return r.init(rawSchema, nil)
+	})
+	require.Error(t, err, "the schemas are not registered")
+
+	serde, err := newTopicSerde(registry, "people", keySchema, personSchema, func(r *CodecRegistry, rawSchema string) error {
+		return r.initAndRegister(rawSchema)
+	})
+	require.NoError(t, err)
+
+	subjects, err := registry.Subjects()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"people-key", "people-value"}, subjects)
+	assert.NotEqual(t, serde.Key.SchemaID, serde.Value.SchemaID)
+
+	key, err := serde.MarshalKey(PersonKey{"Nico"})
+	require.NoError(t, err)
+	value, err := serde.MarshalValue(Person{"Nico", 36})
+	require.NoError(t, err)
+
+	var decodedKey PersonKey
+	require.NoError(t, serde.UnmarshalKey(key, &decodedKey))
+	assert.Equal(t, PersonKey{"Nico"}, decodedKey)
+
+	var decodedValue Person
+	require.NoError(t, serde.UnmarshalValue(value, &decodedValue))
+	assert.Equal(t, Person{"Nico", 36}, decodedValue)
+
+	// A consumer without encoding schemas can still decode
+	consumer, err := newTopicSerde(registry, "people", "", "", func(r *CodecRegistry, rawSchema string) error {
+		return r.init(rawSchema, nil)
+	})
+	require.NoError(t, err)
+	decodedValue = Person{}
+	require.NoError(t, consumer.UnmarshalValue(value, &decodedValue))
+	assert.Equal(t, Person{"Nico", 36}, decodedValue)
+	_, err = consumer.MarshalKey(PersonKey{"Nico"})
+	assert.Equal(t, ErrNoEncodeSchema, err)
+}
+
+func TestTopicSerde_TopicCodec(t *testing.T) {
+	serde := &TopicSerde{Topic: "people", Key: &CodecRegistry{}, Value: &CodecRegistry{}}
+
+	key, err := serde.TopicCodec("people", true)
+	require.NoError(t, err)
+	assert.True(t, key == serde.Key)
+	value, err := serde.TopicCodec("people", false)
+	require.NoError(t, err)
+	assert.True(t, value == serde.Value)
+
+	_, err = serde.TopicCodec("other", false)
+	assert.Error(t, err)
+
+	var codecs TopicCodecs = TopicCodecsFunc(func(topic string, isKey bool) (*CodecRegistry, error) {
+		return serde.TopicCodec("people", isKey)
+	})
+	value, err = codecs.TopicCodec("other", false)
+	require.NoError(t, err)
+	assert.True(t, value == serde.Value)
+}
+
+func TestTopicSerde_SetWireFormat(t *testing.T) {
+	serde := &TopicSerde{Topic: "people", Key: &CodecRegistry{}, Value: &CodecRegistry{}}
+
+	require.NoError(t, serde.SetWireFormat(ApicurioWireFormat))
+	assert.Equal(t, ApicurioWireFormat, serde.Key.WireFormat())
+	assert.Equal(t, ApicurioWireFormat, serde.Value.WireFormat())
+	assert.Error(t, serde.SetWireFormat(WireFormat{}))
+}
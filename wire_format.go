@@ -0,0 +1,122 @@
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// ErrShortPayload is the error returned when a payload is shorter than the header of its wire format
+	ErrShortPayload = errors.New("payload shorter than its header")
+	// ErrInvalidMagicByte is the error returned when a payload doesn't start with the magic byte of its wire format
+	ErrInvalidMagicByte = errors.New("invalid magic byte")
+	// ErrInvalidSchemaID is the error returned when the schema ID of a payload doesn't fit in a SchemaID
+	ErrInvalidSchemaID = errors.New("invalid schema ID")
+)
+
+// WireFormat is the framing of the avro payloads produced and consumed by a CodecRegistry:
+// a magic byte followed by the ID of the writer schema, and the avro encoding of the datum.
+type WireFormat struct {
+	MagicByte byte
+	// IDSize is the size of the schema ID in bytes, 4 or 8
+	IDSize int
+	// ByteOrder is the byte order of the schema ID
+	ByteOrder binary.ByteOrder
+}
+
+// ConfluentWireFormat is the framing of the Confluent serializers: the magic byte 0 and a 4 bytes schema ID
+var ConfluentWireFormat = WireFormat{MagicByte: MagicByte, IDSize: 4, ByteOrder: binary.BigEndian}
+
+// ApicurioWireFormat is the default framing of the Apicurio serializers: the magic byte 0 and a 8 bytes ID,
+// the global ID of the schema or its content ID depending on the configuration of the serializers.
+// The IDs are decoded into an int32 SchemaID: the payloads holding an ID above math.MaxInt32 fail
+// with an error wrapping ErrInvalidSchemaID.
+var ApicurioWireFormat = WireFormat{MagicByte: 0, IDSize: 8, ByteOrder: binary.BigEndian}
+
+// HeaderSize returns the size of the header preceding the avro encoding
+func (f WireFormat) HeaderSize() int {
+	return 1 + f.IDSize
+}
+
+func (f WireFormat) validate() error {
+	if f.IDSize != 4 && f.IDSize != 8 {
+		return fmt.Errorf("invalid wire format: the schema IDs take 4 or 8 bytes, not %d", f.IDSize)
+	}
+	if f.ByteOrder == nil {
+		return errors.New("invalid wire format: no byte order")
+	}
+	return nil
+}
+
+// AppendHeader appends the header of a payload encoded with the given schema to dst
+func (f WireFormat) AppendHeader(dst []byte, id SchemaID) ([]byte, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	var header [9]byte
+	header[0] = f.MagicByte
+	if f.IDSize == 8 {
+		f.ByteOrder.PutUint64(header[1:], uint64(id))
+	} else {
+		f.ByteOrder.PutUint32(header[1:], uint32(id))
+	}
+	return append(dst, header[:f.HeaderSize()]...), nil
+}
+
+// ParseHeader reads the header of a payload, and returns it with the avro encoding following it.
+// The payloads too short to hold the header, starting with another magic byte or holding an ID
+// overflowing SchemaID give an error wrapping ErrShortPayload, ErrInvalidMagicByte or ErrInvalidSchemaID.
+func (f WireFormat) ParseHeader(b []byte) (Header, []byte, error) {
+	if err := f.validate(); err != nil {
+		return Header{}, nil, err
+	}
+	if len(b) < f.HeaderSize() {
+		return Header{}, nil, fmt.Errorf("the payload of %d bytes is shorter than the header of %d bytes: %w", len(b), f.HeaderSize(), ErrShortPayload)
+	}
+	header := Header{MagicByte: b[0]}
+	if header.MagicByte != f.MagicByte {
+		return Header{}, nil, fmt.Errorf("the parsed magic byte %q is not correct (expected %q): %w", header.MagicByte, f.MagicByte, ErrInvalidMagicByte)
+	}
+	if f.IDSize == 8 {
+		id := f.ByteOrder.Uint64(b[1:])
+		if id > math.MaxInt32 {
+			return Header{}, nil, fmt.Errorf("the schema ID %d overflows SchemaID: %w", id, ErrInvalidSchemaID)
+		}
+		header.ID = SchemaID(id)
+	} else {
+		header.ID = SchemaID(int32(f.ByteOrder.Uint32(b[1:])))
+	}
+	return header, b[f.HeaderSize():], nil
+}
+
+// PeekSchemaID returns the ID of the writer schema of a payload, without decoding it
+func (f WireFormat) PeekSchemaID(b []byte) (SchemaID, error) {
+	header, _, err := f.ParseHeader(b)
+	if err != nil {
+		return UnknownID, err
+	}
+	return header.ID, nil
+}
+
+// defaultWireFormat is the Confluent wire format, which doesn't depend on any package variable
+func defaultWireFormat() WireFormat {
+	return WireFormat{MagicByte: MagicByte, IDSize: 4, ByteOrder: binary.BigEndian}
+}
+
+// ParseHeader reads the header of a payload framed by the Confluent serializers, see WireFormat.ParseHeader
+func ParseHeader(b []byte) (Header, []byte, error) {
+	return defaultWireFormat().ParseHeader(b)
+}
+
+// PeekSchemaID returns the ID of the writer schema of a payload framed by the Confluent serializers,
+// allowing to route the payloads without decoding them
+func PeekSchemaID(b []byte) (SchemaID, error) {
+	return defaultWireFormat().PeekSchemaID(b)
+}
+
+// AppendHeader appends the header of the Confluent serializers for the given schema to dst
+func AppendHeader(dst []byte, id SchemaID) ([]byte, error) {
+	return defaultWireFormat().AppendHeader(dst, id)
+}
@@ -0,0 +1,51 @@
+package avro
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeader(t *testing.T) {
+	buf, err := AppendHeader([]byte{0xff}, 258)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xff, 0, 0, 0, 1, 2}, buf)
+
+	header, payload, err := ParseHeader(append(buf[1:], 0x0a, 0x0b))
+	require.NoError(t, err)
+	assert.Equal(t, Header{MagicByte: MagicByte, ID: 258}, header)
+	assert.Equal(t, []byte{0x0a, 0x0b}, payload)
+
+	id, err := PeekSchemaID(buf[1:])
+	require.NoError(t, err)
+	assert.Equal(t, SchemaID(258), id)
+
+	for _, short := range [][]byte{nil, {0}, {0, 0, 0}, {0, 0, 0, 1}} {
+		_, _, err := ParseHeader(short)
+		assert.True(t, errors.Is(err, ErrShortPayload), "%v", err)
+		id, err := PeekSchemaID(short)
+		assert.True(t, errors.Is(err, ErrShortPayload), "%v", err)
+		assert.Equal(t, UnknownID, id)
+	}
+	_, _, err = ParseHeader([]byte{1, 0, 0, 0, 1})
+	assert.True(t, errors.Is(err, ErrInvalidMagicByte), "%v", err)
+}
+
+func TestWireFormat_ParseHeader(t *testing.T) {
+	buf, err := ApicurioWireFormat.AppendHeader(nil, 7)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 7}, buf)
+	id, err := ApicurioWireFormat.PeekSchemaID(buf)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaID(7), id)
+
+	_, err = ApicurioWireFormat.PeekSchemaID(buf[:5])
+	assert.True(t, errors.Is(err, ErrShortPayload), "%v", err)
+	_, err = ApicurioWireFormat.PeekSchemaID([]byte{0, 0, 0, 0, 1, 0, 0, 0, 0})
+	assert.True(t, errors.Is(err, ErrInvalidSchemaID), "%v", err)
+
+	_, err = WireFormat{IDSize: 2}.AppendHeader(nil, 1)
+	assert.Error(t, err)
+}